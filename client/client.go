@@ -16,12 +16,17 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"go.opencensus.io/plugin/ocgrpc"
+	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
 )
 
 // ReaperClient is a gRPC client for communicating with the reaper manager server.
@@ -31,11 +36,35 @@ type ReaperClient struct {
 	ctx    context.Context
 }
 
+// Options configures how a client connects to the server.
+type Options struct {
+	// TLS is the TLS config the client connects with. The client connects without TLS if
+	// it is nil.
+	TLS *tls.Config
+	// TokenSource provides the bearer tokens sent with each request, such as Google ID
+	// tokens. Tokens can only be sent over TLS. No tokens are sent if it is nil.
+	TokenSource oauth2.TokenSource
+}
+
 // StartClient returns a client with a gRPC connection with the server running on address:port.
-func StartClient(ctx context.Context, address, port string) *ReaperClient {
-	conn, err := grpc.Dial(fmt.Sprintf("%s:%s", address, port), grpc.WithInsecure())
+// An error is returned if the options set a TokenSource without TLS, as the tokens would be
+// sent in the clear.
+func StartClient(ctx context.Context, address, port string, options Options) (*ReaperClient, error) {
+	if options.TokenSource != nil && options.TLS == nil {
+		return nil, errors.New("bearer tokens can only be sent over TLS, so a TokenSource requires a TLS config")
+	}
+	dialOptions := []grpc.DialOption{grpc.WithStatsHandler(&ocgrpc.ClientHandler{})}
+	if options.TLS != nil {
+		dialOptions = append(dialOptions, grpc.WithTransportCredentials(credentials.NewTLS(options.TLS)))
+	} else {
+		dialOptions = append(dialOptions, grpc.WithInsecure())
+	}
+	if options.TokenSource != nil {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(oauth.TokenSource{TokenSource: options.TokenSource}))
+	}
+	conn, err := grpc.Dial(fmt.Sprintf("%s:%s", address, port), dialOptions...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	reaperManagerClient := reaperconfig.NewReaperManagerClient(conn)
 
@@ -43,7 +72,7 @@ func StartClient(ctx context.Context, address, port string) *ReaperClient {
 		client: reaperManagerClient,
 		conn:   conn,
 		ctx:    ctx,
-	}
+	}, nil
 }
 
 // AddReaper adds a new reaper the reaper manager.
@@ -91,6 +120,15 @@ func (c *ReaperClient) ShutdownManager() error {
 	return err
 }
 
+// QueryAuditLog returns the records in the server's audit log that match the query.
+func (c *ReaperClient) QueryAuditLog(query *reaperconfig.AuditLogQuery) ([]*reaperconfig.AuditRecord, error) {
+	res, err := c.client.QueryAuditLog(c.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return res.Records, nil
+}
+
 // Close closes the ReaperClient connection to the gRPC server.
 func (c *ReaperClient) Close() {
 	c.conn.Close()
@@ -19,28 +19,64 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/client"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/auth"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
 )
 
 func main() {
+	address := flag.String("address", "localhost", "address of the reaper manager server")
+	port := flag.String("port", "8000", "port of the reaper manager server")
+	useTLS := flag.Bool("tls", false, "connect to the server over TLS, which is implied by the other TLS flags")
+	tlsCA := flag.String("tls-ca", "", "PEM file of the CAs to verify the server's certificate with, instead of the system's CAs")
+	tlsCert := flag.String("tls-cert", "", "PEM file of the client certificate to present to servers that use mutual TLS")
+	tlsKey := flag.String("tls-key", "", "PEM file of the client certificate's key")
+	tlsServerName := flag.String("tls-server-name", "", "name to verify the server's certificate against, instead of the address")
+	idTokenAudience := flag.String("id-token-audience", "", "audience of the Google ID tokens to authenticate with, using the default credentials")
+	tokenFile := flag.String("token-file", "", "file containing a bearer token to authenticate with")
+
 	deleteCmd := flag.NewFlagSet("delete", flag.ExitOnError)
 	deleteUUID := deleteCmd.String("uuid", "", "UUID of the reaper")
 
-	if len(os.Args) < 2 {
-		fmt.Println("expected 'create', 'update', 'list', 'delete', 'start', or 'shutdown' commands")
+	auditCmd := flag.NewFlagSet("audit", flag.ExitOnError)
+	auditStart := auditCmd.String("start", "", "earliest time of the records to show, in RFC 3339 format")
+	auditEnd := auditCmd.String("end", "", "latest time of the records to show, in RFC 3339 format")
+	auditSince := auditCmd.Duration("since", 0, "show the records from this long ago, such as 24h, instead of from a start time")
+	auditUUID := auditCmd.String("uuid", "", "UUID of the reaper whose records to show")
+	auditProject := auditCmd.String("project", "", "GCP Project ID of the resources whose records to show")
+	auditResource := auditCmd.String("resource", "", "regex of the names of the resources whose records to show")
+
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("expected 'create', 'update', 'list', 'delete', 'audit', 'start', or 'shutdown' commands")
 		os.Exit(1)
 	}
+	command, commandArgs := flag.Arg(0), flag.Args()[1:]
 
-	reaperClient := client.StartClient(context.Background(), "localhost", "8000")
+	clientOptions, err := createClientOptions(*useTLS, *tlsCA, *tlsCert, *tlsKey, *tlsServerName, *idTokenAudience, *tokenFile)
+	if err != nil {
+		fmt.Println("Configuring the client failed with the following error: ", err.Error())
+		os.Exit(1)
+	}
+	reaperClient, err := client.StartClient(context.Background(), *address, *port, clientOptions)
+	if err != nil {
+		fmt.Println("Connecting to the server failed with the following error: ", err.Error())
+		os.Exit(1)
+	}
 	defer reaperClient.Close()
 
-	switch os.Args[1] {
+	switch command {
 	case "create":
 		config, err := createReaperConfigPrompt()
 		if err != nil {
@@ -76,7 +112,7 @@ func main() {
 		fmt.Println("Running Reaper UUIDs: ", strings.Join(reapers, ", "))
 
 	case "delete":
-		deleteCmd.Parse(os.Args[2:])
+		deleteCmd.Parse(commandArgs)
 		if len(*deleteUUID) == 0 {
 			var err error
 			reader := bufio.NewReader(os.Stdin)
@@ -94,6 +130,22 @@ func main() {
 		}
 		fmt.Printf("Reaper with UUID %s successfully deleted\n", *deleteUUID)
 
+	case "audit":
+		auditCmd.Parse(commandArgs)
+		query, err := createAuditLogQuery(*auditStart, *auditEnd, *auditSince, *auditUUID, *auditProject, *auditResource)
+		if err != nil {
+			fmt.Println("Creating audit log query failed with the following error: ", err.Error())
+			os.Exit(1)
+		}
+		records, err := reaperClient.QueryAuditLog(query)
+		if err != nil {
+			fmt.Println("Query audit log failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		for _, record := range records {
+			fmt.Println(auditRecordString(record))
+		}
+
 	case "start":
 		err := reaperClient.StartManager()
 		if err != nil {
@@ -109,11 +161,98 @@ func main() {
 		fmt.Println("Reaper manager shutdown")
 
 	default:
-		fmt.Println("expected 'create', 'update', 'list', 'delete', 'start', or 'shutdown' commands")
+		fmt.Println("expected 'create', 'update', 'list', 'delete', 'audit', 'start', or 'shutdown' commands")
 		os.Exit(1)
 	}
 }
 
+// createClientOptions creates the options the client connects to the server with from the
+// command's flags. TLS is used if it is requested or any TLS files or server name are given,
+// and ID tokens are used in place of the token file if an audience is given.
+func createClientOptions(useTLS bool, caFile, certFile, keyFile, serverName, idTokenAudience, tokenFile string) (client.Options, error) {
+	var options client.Options
+	if useTLS || len(caFile) > 0 || len(certFile) > 0 || len(keyFile) > 0 || len(serverName) > 0 {
+		tlsConfig, err := auth.ClientTLSConfig(caFile, certFile, keyFile, serverName)
+		if err != nil {
+			return options, err
+		}
+		options.TLS = tlsConfig
+	}
+	if len(idTokenAudience) > 0 {
+		tokenSource, err := idtoken.NewTokenSource(context.Background(), idTokenAudience)
+		if err != nil {
+			return options, err
+		}
+		options.TokenSource = tokenSource
+	} else if len(tokenFile) > 0 {
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return options, err
+		}
+		options.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: strings.TrimSpace(string(token)), TokenType: "Bearer"})
+	}
+	return options, nil
+}
+
+// createAuditLogQuery creates an audit log query from the audit command's flags. A non-zero
+// since is used as the start time in place of start.
+func createAuditLogQuery(start, end string, since time.Duration, uuid, projectID, resourceFilter string) (*reaperconfig.AuditLogQuery, error) {
+	query := &reaperconfig.AuditLogQuery{
+		ReaperUuid:     uuid,
+		ProjectId:      projectID,
+		ResourceFilter: resourceFilter,
+	}
+	var err error
+	if since > 0 {
+		query.StartTime, err = ptypes.TimestampProto(time.Now().Add(-since))
+	} else if len(start) > 0 {
+		query.StartTime, err = parseTimestamp(start)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(end) > 0 {
+		if query.EndTime, err = parseTimestamp(end); err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// parseTimestamp parses a time in RFC 3339 format into a timestamp proto.
+func parseTimestamp(value string) (*timestamp.Timestamp, error) {
+	parsedTime, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return ptypes.TimestampProto(parsedTime)
+}
+
+// auditRecordString returns a single line describing an audit record.
+func auditRecordString(record *reaperconfig.AuditRecord) string {
+	recordTime, _ := ptypes.Timestamp(record.GetTime())
+	resource := record.GetResource()
+	if record.GetOutcome() == reaperconfig.AuditOutcome_DENIED {
+		return fmt.Sprintf(
+			"%s %-7s principal=%s method=%s reaper=%s project=%s error=%q",
+			recordTime.Format(time.RFC3339), record.GetOutcome().String(), record.GetPrincipal(), record.GetMethod(),
+			record.GetReaperUuid(), resource.GetProjectId(), record.GetError(),
+		)
+	}
+	line := fmt.Sprintf(
+		"%s %-7s reaper=%s project=%s type=%s zone=%s resource=%s ttl=%q",
+		recordTime.Format(time.RFC3339), record.GetOutcome().String(), record.GetReaperUuid(), resource.GetProjectId(),
+		resource.GetType().String(), resource.GetZone(), resource.GetName(), record.GetTtl(),
+	)
+	if deletionTime, err := ptypes.Timestamp(record.GetDeletionTime()); err == nil {
+		line += fmt.Sprintf(" deletion_time=%s", deletionTime.Format(time.RFC3339))
+	}
+	if len(record.GetError()) > 0 {
+		line += fmt.Sprintf(" error=%q", record.GetError())
+	}
+	return line
+}
+
 // createReaperConfigPrompt is a command line prompt that walks the user through creating
 // a new reaper config.
 func createReaperConfigPrompt() (*reaperconfig.ReaperConfig, error) {
@@ -163,10 +302,24 @@ func createReaperConfigPrompt() (*reaperconfig.ReaperConfig, error) {
 		switch resourceTypeString {
 		case "GCE_VM":
 			resourceType = reaperconfig.ResourceType_GCE_VM
+		case "GCE_Snapshot":
+			resourceType = reaperconfig.ResourceType_GCE_SNAPSHOT
 		case "GCS_Bucket":
 			resourceType = reaperconfig.ResourceType_GCS_BUCKET
 		case "GCS_Object":
 			resourceType = reaperconfig.ResourceType_GCS_OBJECT
+		case "GKE_Cluster":
+			resourceType = reaperconfig.ResourceType_GKE_CLUSTER
+		case "Cloud_SQL_Instance":
+			resourceType = reaperconfig.ResourceType_CLOUD_SQL_INSTANCE
+		case "PubSub_Topic":
+			resourceType = reaperconfig.ResourceType_PUBSUB_TOPIC
+		case "PubSub_Subscription":
+			resourceType = reaperconfig.ResourceType_PUBSUB_SUBSCRIPTION
+		case "Cloud_Run_Service":
+			resourceType = reaperconfig.ResourceType_CLOUD_RUN_SERVICE
+		case "Cloud_Function":
+			resourceType = reaperconfig.ResourceType_CLOUD_FUNCTION
 		default:
 			return nil, fmt.Errorf("Invalid resource type %s", resourceTypeString)
 		}
@@ -16,31 +16,240 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/audit"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/auth"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/credentials"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/manager"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/metrics"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
 )
 
 func main() {
 	port := flag.String("port", "8000", "port to run gRPC server on")
+	reflection := flag.Bool("reflection", false, "serve the gRPC server reflection service")
+	tlsCert := flag.String("tls-cert", "", "PEM file of the server's TLS certificate; the server is served without TLS if empty")
+	tlsKey := flag.String("tls-key", "", "PEM file of the server's TLS key")
+	tlsClientCA := flag.String("tls-client-ca", "", "PEM file of the CAs that client certificates must be signed by, which enables mutual TLS")
+	authAudience := flag.String("auth-id-token-audience", "", "audience of the Google ID tokens that authenticate requests")
+	authTokensFile := flag.String("auth-tokens-file", "", "JSON file mapping static bearer tokens to the principals they authenticate")
+	allowInsecureTokens := flag.Bool("allow-insecure-tokens", false, "accept ID tokens and static tokens without TLS, which sends them in plaintext; only for local testing")
+	authPolicyFile := flag.String("auth-policy", "", "JSON file listing the principals that may call each method")
+	rolePolicyFile := flag.String("role-policy", "", "JSON file granting principals viewer, operator or admin roles in projects")
 	projectID := flag.String("project-id", "", "GCP Project ID for where to store logs")
 	logsName := flag.String("logs-name", "", "name of logs")
+	logLevel := flag.String("log-level", "info", "lowest level of the entries to log: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "format of the local logs: text or json")
+	logFile := flag.String("log-file", "logs.txt", "file to write local logs to, or empty to not write a log file")
+	logMaxSizeMB := flag.Int64("log-max-size-mb", 0, "size in megabytes at which the log file is rotated, or 0 to not rotate by size")
+	logMaxAge := flag.Duration("log-max-age", 0, "how long to write to the log file before rotating it, or 0 to not rotate by age")
+	logMaxBackups := flag.Int("log-max-backups", 0, "number of rotated log files to keep, or 0 to keep all of them")
+	logStdout := flag.Bool("log-stdout", false, "also write local logs to stdout")
+	firstSeenFile := flag.String("first-seen-file", "first_seen.json", "file for persisting when resources without a creation time were first seen")
+	credentialsDir := flag.String("credentials-dir", "", "directory that the credentials files of reapers are resolved against; reapers cannot use credentials files if empty")
+	protectionPolicyFile := flag.String("protection-policy", "", "JSON file describing resources that no reaper may delete")
+	auditLogFile := flag.String("audit-log", "audit_log.jsonl", "append-only file for the audit log of every attempt to delete a resource")
+	auditLogRepair := flag.Bool("audit-log-repair", false, "repair a damaged audit log by removing a partial last line and accepting any records missing from its end")
+	eventsTopic := flag.String("events-topic", "", "Pub/Sub topic, of the form projects/{project}/topics/{topic}, to publish reaper events to")
+	metricsPort := flag.String("metrics-port", "", "port to serve Prometheus metrics on at /metrics")
+	traceExporters := flag.String("trace-exporters", "", "comma separated trace exporters to send spans to, from: log")
+	traceSampleFraction := flag.Float64("trace-sample-fraction", 1, "fraction of traces to sample, between 0 and 1")
 
 	flag.Parse()
 
-	if err := logger.CreateLogger(); err != nil {
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
 		log.Fatal(err)
 	}
+	format, err := logger.ParseFormat(*logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	serverLogger, err := logger.New(logger.Options{
+		Path:       *logFile,
+		MaxSize:    *logMaxSizeMB * 1024 * 1024,
+		MaxAge:     *logMaxAge,
+		MaxBackups: *logMaxBackups,
+		Stdout:     *logStdout,
+		Level:      level,
+		Format:     format,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger.SetLogger(serverLogger)
 	defer logger.Close()
 	if len(*projectID) > 0 && len(*logsName) > 0 {
 		err := logger.AddCloudLogger(context.Background(), *projectID, *logsName)
 		if err != nil {
 			log.Fatal(err)
 		}
-		logger.Logf("Logging to %s in project", *logsName, *projectID)
+		logger.Logf("Logging to %s in project %s", *logsName, *projectID)
+	}
+
+	firstSeen, err := resources.NewFirstSeenTracker(*firstSeenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(*credentialsDir) > 0 {
+		credentials.SetCredentialsDir(*credentialsDir)
+		logger.Logf("Resolving reaper credentials files in %s", *credentialsDir)
+	}
+
+	var protection *resources.ProtectionPolicy
+	if len(*protectionPolicyFile) > 0 {
+		protection, err = resources.LoadProtectionPolicy(*protectionPolicyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Logf("Loaded protection policy from %s", *protectionPolicyFile)
+	}
+
+	if *auditLogRepair {
+		if err := audit.Repair(*auditLogFile); err != nil {
+			log.Fatal(err)
+		}
+		logger.Logf("Repaired audit log %s", *auditLogFile)
+	}
+	auditLog, err := audit.NewLog(*auditLogFile)
+	if errors.Is(err, audit.ErrPartialLine) || errors.Is(err, audit.ErrHeadMismatch) {
+		log.Fatalf("%v. Check the audit log, then restart with -audit-log-repair to accept it as it is", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer auditLog.Close()
+	logger.Logf("Recording audit log in %s", *auditLogFile)
+
+	var eventSink events.Sink
+	if len(*eventsTopic) > 0 {
+		eventSink, err = events.NewPubSubSink(context.Background(), *eventsTopic)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Logf("Publishing reaper events to %s", *eventsTopic)
+	}
+
+	if len(*traceExporters) > 0 {
+		if err := tracing.Configure(strings.Split(*traceExporters, ","), *traceSampleFraction); err != nil {
+			log.Fatal(err)
+		}
+		logger.Logf("Exporting traces to %s", *traceExporters)
 	}
 
-	manager.StartServer(*port)
+	if len(*metricsPort) > 0 {
+		go func() {
+			logger.Logf("Serving metrics on :%s/metrics", *metricsPort)
+			if err := metrics.ListenAndServe(*metricsPort); err != nil {
+				logger.Error(fmt.Errorf("Serving metrics failed with the following error: %s", err.Error()))
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	forceStop := make(chan struct{})
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		received := <-signals
+		logger.Logf("Received %s, shutting down", received)
+		cancel()
+		received = <-signals
+		logger.Logf("Received %s again, stopping immediately", received)
+		close(forceStop)
+	}()
+
+	serverOptions := manager.ServerOptions{
+		FirstSeen:  firstSeen,
+		Protection: protection,
+		EventSink:  eventSink,
+		AuditLog:   auditLog,
+		Reflection: *reflection,
+		ForceStop:  forceStop,
+	}
+	if len(*tlsCert) > 0 {
+		serverOptions.TLS, err = auth.ServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if len(*tlsClientCA) > 0 {
+		log.Fatal("mutual TLS requires a server certificate")
+	}
+	serverOptions.Auth, err = createAuthInterceptor(*authAudience, *authTokensFile, *authPolicyFile, serverOptions.TLS != nil, len(*tlsClientCA) > 0, *allowInsecureTokens)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*rolePolicyFile) > 0 {
+		if serverOptions.Auth == nil {
+			log.Fatal("a role policy requires ID tokens, a tokens file or mutual TLS to authenticate requests")
+		}
+		serverOptions.Roles, err = auth.LoadRolePolicy(*rolePolicyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Logf("Loaded role policy from %s", *rolePolicyFile)
+	}
+	if err := manager.StartServer(ctx, *port, serverOptions); err != nil {
+		logger.Error(fmt.Errorf("Serving gRPC failed with the following error: %s", err.Error()))
+		auditLog.Close()
+		logger.Close()
+		os.Exit(1)
+	}
+}
+
+// createAuthInterceptor creates the interceptor that authenticates requests with the ID tokens
+// of the audience, the tokens in the tokens file and, with mutual TLS, client certificates, and
+// that authorizes them with the policy file. Requests are not authenticated if none of these
+// are set. Tokens are refused without TLS, as they would be sent in plaintext, unless
+// allowInsecureTokens is set.
+func createAuthInterceptor(audience, tokensFile, policyFile string, useTLS, mutualTLS, allowInsecureTokens bool) (*auth.Interceptor, error) {
+	var authenticators auth.Authenticators
+	if len(audience) > 0 {
+		authenticators = append(authenticators, auth.IDTokenAuthenticator{Audience: audience})
+	}
+	if len(tokensFile) > 0 {
+		tokenAuthenticator, err := auth.LoadStaticTokenAuthenticator(tokensFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, tokenAuthenticator)
+	}
+	if len(authenticators) > 0 && !useTLS {
+		if !allowInsecureTokens {
+			return nil, fmt.Errorf("ID tokens and static tokens require TLS, as they would otherwise be sent in plaintext; set -tls-cert, or -allow-insecure-tokens for local testing")
+		}
+		logger.Warnf("Accepting tokens without TLS, so they are sent in plaintext")
+	}
+	var policy *auth.MethodPolicy
+	if len(policyFile) > 0 {
+		var err error
+		if policy, err = auth.LoadMethodPolicy(policyFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(authenticators) == 0 && policy == nil && !mutualTLS {
+		logger.Warnf("Serving gRPC without authentication, so anyone who can reach the server can manage reapers")
+		return nil, nil
+	}
+	if len(authenticators) == 0 && !mutualTLS {
+		return nil, fmt.Errorf("an authorization policy requires ID tokens, a tokens file or mutual TLS to authenticate requests")
+	}
+	var authenticator auth.Authenticator
+	if len(authenticators) > 0 {
+		authenticator = authenticators
+	}
+	logger.Logf("Authenticating gRPC requests")
+	return auth.NewInterceptor(authenticator, policy), nil
 }
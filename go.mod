@@ -8,8 +8,10 @@ require (
 	github.com/BurntSushi/xgb v0.0.0-20160522181843-27f122750802
 	github.com/golang/protobuf v1.4.2
 	github.com/googleapis/google-cloud-go-testing v0.0.0-20191008195207-8e1d251e947d
+	github.com/prometheus/client_golang v1.5.1
 	github.com/robfig/cron/v3 v3.0.1
 	go.opencensus.io v0.22.3
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	google.golang.org/api v0.26.0
 	google.golang.org/grpc v1.28.0
 	google.golang.org/protobuf v1.24.0
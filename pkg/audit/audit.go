@@ -0,0 +1,624 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+var (
+	// ErrPartialLine is returned when an audit log file ends with a partial line, which
+	// is left behind when writing a record is interrupted. Repair removes the line.
+	ErrPartialLine = errors.New("audit log ends with a partial line")
+
+	// ErrHeadMismatch is returned when an audit log file does not match its head file,
+	// which happens when records are removed from the end of the log, or when the head
+	// file is missing. Repair rewrites the head file to match the log.
+	ErrHeadMismatch = errors.New("audit log does not match its head file")
+
+	// ErrClosed is returned when a record is written to an audit log that has been closed.
+	ErrClosed = errors.New("audit log is closed")
+)
+
+// recentDeletionsWindow is how long before its latest record an audit log keeps its
+// records of deleted resources in memory, which covers the reapers' daily deletion budgets.
+const recentDeletionsWindow = 24 * time.Hour
+
+// Log is an append-only audit log of the reapers' attempts to delete resources. Each record
+// is written as a line of JSON that is chained to the record before it by a SHA-256 hash,
+// so that any record that is changed, removed or reordered after it is written breaks the
+// chain. If the log has a file path, the records are appended to that file, and the hash
+// and number of the last record are kept in a head file next to it, so that records removed
+// from the end of the log are also detected. Otherwise the records are only kept in memory.
+// The records are verified when the log is opened, and again as they are read by each query.
+// Only the deletions within recentDeletionsWindow of the latest record are kept in memory.
+type Log struct {
+	path            string
+	file            logFile
+	memory          *bytes.Buffer
+	size            int64
+	lines           int
+	lastHash        string
+	recentDeletions []recentDeletion
+	latestTime      time.Time
+	closed          bool
+	mux             *sync.Mutex
+}
+
+// logFile is the file an audit log appends its records to.
+type logFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// recentDeletion is the record of a deleted resource, kept in memory for counting recent
+// deletions.
+type recentDeletion struct {
+	reaperUUID string
+	time       time.Time
+}
+
+// entry is a line of the audit log. Hash is the hash of PreviousHash followed by Record,
+// which is the record encoded as compact JSON.
+type entry struct {
+	Record       json.RawMessage `json:"record"`
+	PreviousHash string          `json:"previous_hash"`
+	Hash         string          `json:"hash"`
+}
+
+// head is the contents of an audit log's head file: the hash of the last entry in the log,
+// and the number of entries.
+type head struct {
+	Hash  string `json:"hash"`
+	Lines int    `json:"lines"`
+}
+
+// logContents describes the verified contents of an audit log file.
+type logContents struct {
+	lines    int
+	lastHash string
+	// headHash is the hash of the entry at the line given when reading the entries.
+	headHash string
+	// size is the size in bytes of the file's complete lines.
+	size int64
+	// partialLine is whether the file ends with a line that is missing its newline.
+	partialLine bool
+}
+
+// NewLog creates an audit log that appends to the file at path, creating the file if it
+// does not exist. The records already in the file are verified against each other and
+// against the head file, and an error is returned if they have been tampered with. An error
+// wrapping ErrPartialLine or ErrHeadMismatch is returned if the file was damaged, in which
+// case it can be checked and then fixed with Repair. An empty path creates a log that is
+// only kept in memory.
+func NewLog(path string) (*Log, error) {
+	auditLog := &Log{path: path, mux: &sync.Mutex{}}
+	if len(path) == 0 {
+		auditLog.memory = &bytes.Buffer{}
+		return auditLog, nil
+	}
+	logHead, err := readHead(path)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := readEntries(path, logHead.lastLine(), func(record *reaperconfig.AuditRecord) {
+		auditLog.addRecentDeletion(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if contents.partialLine {
+		return nil, fmt.Errorf("opening audit log %s failed: %w", path, ErrPartialLine)
+	}
+	if err := checkHead(path, logHead, contents); err != nil {
+		return nil, err
+	}
+	auditLog.lines = contents.lines
+	auditLog.size = contents.size
+	auditLog.lastHash = contents.lastHash
+	if err := writeHead(path, auditLog.lastHash, auditLog.lines); err != nil {
+		return nil, err
+	}
+	auditLog.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return auditLog, nil
+}
+
+// Repair fixes the audit log file at path after NewLog reported that it was damaged. A
+// partial last line is removed, and the head file is rewritten to match the remaining
+// records, which must still be chained to each other. Repair accepts any records removed
+// from the end of the log, so the log should be checked before it is repaired.
+func Repair(path string) error {
+	contents, err := readEntries(path, 0, nil)
+	if err != nil {
+		return err
+	}
+	if contents.partialLine {
+		if err := os.Truncate(path, contents.size); err != nil {
+			return err
+		}
+	}
+	return writeHead(path, contents.lastHash, contents.lines)
+}
+
+// Record appends the record to the audit log. The record is written to the log's file
+// before Record returns. If writing the record fails, the file is truncated back to the
+// records before it, so that the log is not left with a partial line. An error wrapping
+// ErrClosed is returned if the log has been closed.
+func (auditLog *Log) Record(record *reaperconfig.AuditRecord) error {
+	var recordJSON bytes.Buffer
+	if err := (&jsonpb.Marshaler{}).Marshal(&recordJSON, record); err != nil {
+		return err
+	}
+	var compactRecord bytes.Buffer
+	if err := json.Compact(&compactRecord, recordJSON.Bytes()); err != nil {
+		return err
+	}
+
+	auditLog.mux.Lock()
+	defer auditLog.mux.Unlock()
+	if auditLog.closed {
+		return fmt.Errorf("recording in audit log %s failed: %w", auditLog.path, ErrClosed)
+	}
+	newEntry := entry{Record: compactRecord.Bytes(), PreviousHash: auditLog.lastHash}
+	newEntry.Hash = newEntry.computeHash()
+	line, err := json.Marshal(newEntry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if auditLog.file != nil {
+		if err := auditLog.appendLine(line); err != nil {
+			return err
+		}
+	} else {
+		auditLog.memory.Write(line)
+	}
+	auditLog.size += int64(len(line))
+	auditLog.lines++
+	auditLog.lastHash = newEntry.Hash
+	auditLog.addRecentDeletion(record)
+	if auditLog.file == nil {
+		return nil
+	}
+	return writeHead(auditLog.path, newEntry.Hash, auditLog.lines)
+}
+
+// appendLine writes the line to the end of the log's file and syncs it. If either fails,
+// the file is truncated back to its size before the line was written.
+func (auditLog *Log) appendLine(line []byte) error {
+	_, err := auditLog.file.Write(line)
+	if err == nil {
+		err = auditLog.file.Sync()
+	}
+	if err == nil {
+		return nil
+	}
+	if truncateErr := auditLog.file.Truncate(auditLog.size); truncateErr != nil {
+		return fmt.Errorf("writing to audit log %s failed, and removing the partial record failed with %v: %v", auditLog.path, truncateErr, err)
+	}
+	return err
+}
+
+// addRecentDeletion keeps the record in memory if it records a deleted resource, and drops
+// the deletions that are no longer within recentDeletionsWindow of the latest record.
+func (auditLog *Log) addRecentDeletion(record *reaperconfig.AuditRecord) {
+	recordTime, err := ptypes.Timestamp(record.GetTime())
+	if err != nil {
+		return
+	}
+	if recordTime.After(auditLog.latestTime) {
+		auditLog.latestTime = recordTime
+	}
+	windowStart := auditLog.latestTime.Add(-recentDeletionsWindow)
+	if record.GetOutcome() == reaperconfig.AuditOutcome_DELETED && !recordTime.Before(windowStart) {
+		auditLog.recentDeletions = append(auditLog.recentDeletions, recentDeletion{record.GetReaperUuid(), recordTime})
+	}
+	if len(auditLog.recentDeletions) == 0 || !auditLog.recentDeletions[0].time.Before(windowStart) {
+		return
+	}
+	var recentDeletions []recentDeletion
+	for _, deletion := range auditLog.recentDeletions {
+		if !deletion.time.Before(windowStart) {
+			recentDeletions = append(recentDeletions, deletion)
+		}
+	}
+	auditLog.recentDeletions = recentDeletions
+}
+
+// DeletionsSince returns the number of resources that the audit log records the reaper with
+// the given UUID deleted since the given time. Recent deletions are counted from memory, and
+// older ones by querying the log.
+func (auditLog *Log) DeletionsSince(reaperUUID string, since time.Time) (int, error) {
+	auditLog.mux.Lock()
+	inWindow := !since.Before(auditLog.latestTime.Add(-recentDeletionsWindow))
+	deleted := 0
+	for _, deletion := range auditLog.recentDeletions {
+		if deletion.reaperUUID == reaperUUID && !deletion.time.Before(since) {
+			deleted++
+		}
+	}
+	auditLog.mux.Unlock()
+	if inWindow {
+		return deleted, nil
+	}
+
+	startTime, err := ptypes.TimestampProto(since)
+	if err != nil {
+		return 0, err
+	}
+	records, err := auditLog.Query(&reaperconfig.AuditLogQuery{StartTime: startTime, ReaperUuid: reaperUUID})
+	if err != nil {
+		return 0, err
+	}
+	deleted = 0
+	for _, record := range records {
+		if record.GetOutcome() == reaperconfig.AuditOutcome_DELETED {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Query returns the records in the audit log that match the query, in the order they were
+// written. The records are streamed from the log's file, and are verified as they are read
+// against the records the log has verified or written, so an error is returned if the file
+// has been tampered with.
+func (auditLog *Log) Query(query *reaperconfig.AuditLogQuery) ([]*reaperconfig.AuditRecord, error) {
+	matcher, err := newQueryMatcher(query)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog.mux.Lock()
+	size, lines, lastHash := auditLog.size, auditLog.lines, auditLog.lastHash
+	var reader io.Reader
+	if auditLog.memory != nil {
+		reader = bytes.NewReader(auditLog.memory.Bytes()[:size])
+	}
+	auditLog.mux.Unlock()
+	if reader == nil {
+		file, err := os.Open(auditLog.path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = io.LimitReader(file, size)
+	}
+
+	var records []*reaperconfig.AuditRecord
+	contents, err := scanEntries(reader, auditLog.path, 0, func(record *reaperconfig.AuditRecord) {
+		if matcher.matches(record) {
+			records = append(records, record)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if contents.partialLine || contents.size != size || contents.lines != lines || contents.lastHash != lastHash {
+		return nil, fmt.Errorf("audit log %s has been changed since it was verified: it has %d records in %d bytes; want %d in %d", auditLog.path, contents.lines, contents.size, lines, size)
+	}
+	return records, nil
+}
+
+// Verify rereads the audit log's file and its head file, and returns an error if they no
+// longer match the records the log has verified or written.
+func (auditLog *Log) Verify() error {
+	auditLog.mux.Lock()
+	defer auditLog.mux.Unlock()
+	if len(auditLog.path) == 0 {
+		return nil
+	}
+	logHead, err := readHead(auditLog.path)
+	if err != nil {
+		return err
+	}
+	contents, err := readEntries(auditLog.path, logHead.lastLine(), nil)
+	if err != nil {
+		return err
+	}
+	if contents.partialLine {
+		return fmt.Errorf("verifying audit log %s failed: %w", auditLog.path, ErrPartialLine)
+	}
+	if err := checkHead(auditLog.path, logHead, contents); err != nil {
+		return err
+	}
+	if contents.lines != auditLog.lines || contents.size != auditLog.size {
+		return fmt.Errorf("audit log %s has %d records; want %d", auditLog.path, contents.lines, auditLog.lines)
+	}
+	if contents.lastHash != auditLog.lastHash {
+		return fmt.Errorf("audit log %s has been tampered with", auditLog.path)
+	}
+	return nil
+}
+
+// Close closes the audit log's file. Records can no longer be written to the log once it
+// is closed, but it can still be queried.
+func (auditLog *Log) Close() error {
+	auditLog.mux.Lock()
+	defer auditLog.mux.Unlock()
+	auditLog.closed = true
+	if auditLog.file == nil {
+		return nil
+	}
+	err := auditLog.file.Close()
+	auditLog.file = nil
+	return err
+}
+
+// computeHash returns the hash that chains the entry's record to the previous entry.
+func (lineEntry entry) computeHash() string {
+	hash := sha256.New()
+	hash.Write([]byte(lineEntry.PreviousHash))
+	hash.Write(lineEntry.Record)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// headPath returns the path of the head file of the audit log file at path.
+func headPath(path string) string {
+	return path + ".head"
+}
+
+// readHead reads the head file of the audit log file at path. A missing head file is
+// returned as nil.
+func readHead(path string) (*head, error) {
+	contents, err := ioutil.ReadFile(headPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var logHead head
+	if err := json.Unmarshal(contents, &logHead); err != nil {
+		return nil, fmt.Errorf("parsing head file of audit log %s failed: %v", path, err)
+	}
+	return &logHead, nil
+}
+
+// lastLine returns the number of the last line recorded in the head file, which is zero
+// for a missing head file.
+func (logHead *head) lastLine() int {
+	if logHead == nil {
+		return 0
+	}
+	return logHead.Lines
+}
+
+// checkHead returns an error wrapping ErrHeadMismatch if the contents of the audit log file
+// at path, read with the head's line, do not match its head file. The log may have more
+// entries than its head file, as happens when the reaper stops between writing a record and
+// updating the head file. A missing head file only matches an empty log.
+func checkHead(path string, logHead *head, contents *logContents) error {
+	if logHead == nil {
+		if contents.lines == 0 {
+			return nil
+		}
+		return fmt.Errorf("audit log %s has %d records but no head file: %w", path, contents.lines, ErrHeadMismatch)
+	}
+	if logHead.Lines > contents.lines {
+		return fmt.Errorf("audit log %s has %d records; its head file expects %d: %w", path, contents.lines, logHead.Lines, ErrHeadMismatch)
+	}
+	if logHead.Lines > 0 && contents.headHash != logHead.Hash {
+		return fmt.Errorf("record %d of audit log %s does not match its head file: %w", logHead.Lines, path, ErrHeadMismatch)
+	}
+	return nil
+}
+
+// writeHead atomically replaces the head file of the audit log file at path.
+func writeHead(path, lastHash string, lines int) error {
+	contents, err := json.Marshal(head{Hash: lastHash, Lines: lines})
+	if err != nil {
+		return err
+	}
+	tempPath := headPath(path) + ".tmp"
+	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(contents); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, headPath(path))
+}
+
+// readEntries reads the audit log file at path with scanEntries. A file that does not
+// exist has no entries.
+func readEntries(path string, headLine int, visit func(*reaperconfig.AuditRecord)) (*logContents, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &logContents{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return scanEntries(file, path, headLine, visit)
+}
+
+// scanEntries reads the entries of the audit log at path from the reader one at a time,
+// and verifies that each of them is chained to the one before it. If visit is set, it is
+// called with the record of each entry. The hash of the entry at headLine is kept in the
+// contents' headHash. A last line that is missing its newline is not parsed, and is
+// reported in the contents' partialLine.
+func scanEntries(reader io.Reader, path string, headLine int, visit func(*reaperconfig.AuditRecord)) (*logContents, error) {
+	contents := &logContents{}
+	bufferedReader := bufio.NewReader(reader)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := bufferedReader.ReadBytes('\n')
+		if err == io.EOF {
+			contents.partialLine = len(line) > 0
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var lineEntry entry
+		if err := json.Unmarshal(line, &lineEntry); err != nil {
+			return nil, fmt.Errorf("parsing line %d of audit log %s failed: %v", lineNumber, path, err)
+		}
+		if lineEntry.PreviousHash != contents.lastHash || lineEntry.Hash != lineEntry.computeHash() {
+			return nil, fmt.Errorf("audit log %s has been tampered with at line %d", path, lineNumber)
+		}
+		if visit != nil {
+			record := &reaperconfig.AuditRecord{}
+			if err := jsonpb.Unmarshal(bytes.NewReader(lineEntry.Record), record); err != nil {
+				return nil, fmt.Errorf("parsing record %d of audit log %s failed: %v", lineNumber, path, err)
+			}
+			visit(record)
+		}
+		if lineNumber == headLine {
+			contents.headHash = lineEntry.Hash
+		}
+		contents.lastHash = lineEntry.Hash
+		contents.lines = lineNumber
+		contents.size += int64(len(line))
+	}
+	return contents, nil
+}
+
+// queryMatcher checks records against an audit log query.
+type queryMatcher struct {
+	query          *reaperconfig.AuditLogQuery
+	startTime      time.Time
+	endTime        time.Time
+	resourceFilter *regexp.Regexp
+}
+
+// newQueryMatcher creates a matcher for the query, returning an error if any of its fields
+// are malformed.
+func newQueryMatcher(query *reaperconfig.AuditLogQuery) (*queryMatcher, error) {
+	matcher := &queryMatcher{query: query}
+	var err error
+	if query.GetStartTime() != nil {
+		if matcher.startTime, err = ptypes.Timestamp(query.GetStartTime()); err != nil {
+			return nil, err
+		}
+	}
+	if query.GetEndTime() != nil {
+		if matcher.endTime, err = ptypes.Timestamp(query.GetEndTime()); err != nil {
+			return nil, err
+		}
+	}
+	if len(query.GetResourceFilter()) > 0 {
+		if matcher.resourceFilter, err = regexp.Compile(query.GetResourceFilter()); err != nil {
+			return nil, fmt.Errorf("parsing resource filter failed: %v", err)
+		}
+	}
+	return matcher, nil
+}
+
+// matches returns whether the record matches every field that is set in the query.
+func (matcher *queryMatcher) matches(record *reaperconfig.AuditRecord) bool {
+	recordTime, _ := ptypes.Timestamp(record.GetTime())
+	if !matcher.startTime.IsZero() && recordTime.Before(matcher.startTime) {
+		return false
+	}
+	if !matcher.endTime.IsZero() && !recordTime.Before(matcher.endTime) {
+		return false
+	}
+	if len(matcher.query.GetReaperUuid()) > 0 && record.GetReaperUuid() != matcher.query.GetReaperUuid() {
+		return false
+	}
+	if len(matcher.query.GetProjectId()) > 0 && record.GetResource().GetProjectId() != matcher.query.GetProjectId() {
+		return false
+	}
+	return matcher.resourceFilter == nil || matcher.resourceFilter.MatchString(record.GetResource().GetName())
+}
+
+// NewRecord creates an audit record of an attempt by a reaper to delete a watched resource
+// in the given project at the given time. The error is nil if the resource was deleted,
+// and otherwise explains why it was not.
+func NewRecord(reaperUUID, projectID string, watchedResource *resources.WatchedResource, outcome reaperconfig.AuditOutcome, err error, attemptTime time.Time) *reaperconfig.AuditRecord {
+	record := &reaperconfig.AuditRecord{
+		Time:       timestampProto(attemptTime),
+		ReaperUuid: reaperUUID,
+		Resource: &reaperconfig.EventResource{
+			Name:        watchedResource.Name,
+			Zone:        watchedResource.Zone,
+			ProjectId:   projectID,
+			Type:        watchedResource.Type,
+			TimeCreated: timestampProto(watchedResource.TimeCreated),
+			Labels:      watchedResource.Labels,
+		},
+		ResourceConfig: watchedResource.Config,
+		Ttl:            watchedResource.TTL,
+		Outcome:        outcome,
+	}
+	if deletionTime, deletionTimeErr := watchedResource.GetDeletionTime(); deletionTimeErr == nil {
+		record.DeletionTime = timestampProto(deletionTime)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// NewDenialRecord creates an audit record of a request by the principal to call the reaper
+// manager method, for the reaper with the given UUID in the project, that was denied at the
+// given time for the reason in err.
+func NewDenialRecord(principal, method, reaperUUID, projectID string, err error, denialTime time.Time) *reaperconfig.AuditRecord {
+	return &reaperconfig.AuditRecord{
+		Time:       timestampProto(denialTime),
+		ReaperUuid: reaperUUID,
+		Resource:   &reaperconfig.EventResource{ProjectId: projectID},
+		Outcome:    reaperconfig.AuditOutcome_DENIED,
+		Error:      err.Error(),
+		Principal:  principal,
+		Method:     method,
+	}
+}
+
+// timestampProto converts a time to a timestamp proto, returning nil for the zero time.
+func timestampProto(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	timestampProto, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil
+	}
+	return timestampProto
+}
@@ -0,0 +1,360 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+var currentTime, _ = time.Parse("2006-01-02 15:04:05 -0700", "2020-06-17 10:00:00 -0400")
+
+func createTestRecord(name, projectID string, outcome reaperconfig.AuditOutcome, err error, attemptTime time.Time) *reaperconfig.AuditRecord {
+	resourceConfig := &reaperconfig.ResourceConfig{ResourceType: reaperconfig.ResourceType_GCE_VM, NameFilter: "test", Ttl: "@every 1h"}
+	resource := resources.NewResource(name, "testZone", currentTime.Add(-2*time.Hour), reaperconfig.ResourceType_GCE_VM)
+	watchedResource := resources.NewWatchedResource(resource, resourceConfig.GetTtl())
+	watchedResource.Config = resourceConfig
+	return NewRecord("TestUUID", projectID, watchedResource, outcome, err, attemptTime)
+}
+
+func createTestLog(t *testing.T) (*Log, string, func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "audit_log.jsonl")
+	auditLog, err := NewLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auditLog, path, func() {
+		auditLog.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewRecord(t *testing.T) {
+	record := createTestRecord("TestResource", "testProject", reaperconfig.AuditOutcome_FAILED, errors.New("permission denied"), currentTime)
+
+	recordTime, _ := ptypes.Timestamp(record.GetTime())
+	deletionTime, _ := ptypes.Timestamp(record.GetDeletionTime())
+	if !recordTime.Equal(currentTime) || !deletionTime.Equal(currentTime.Add(-time.Hour)) {
+		t.Errorf("Record times = %v and %v; want %v and %v", recordTime, deletionTime, currentTime, currentTime.Add(-time.Hour))
+	}
+	if record.GetResource().GetName() != "TestResource" || record.GetResource().GetProjectId() != "testProject" {
+		t.Errorf("Record resource = %v; want TestResource in testProject", record.GetResource())
+	}
+	if record.GetTtl() != "@every 1h" || record.GetResourceConfig().GetNameFilter() != "test" {
+		t.Errorf("Record TTL and resource config = %s and %v", record.GetTtl(), record.GetResourceConfig())
+	}
+	if record.GetOutcome() != reaperconfig.AuditOutcome_FAILED || record.GetError() != "permission denied" {
+		t.Errorf("Record outcome = %s with error %q; want FAILED with permission denied", record.GetOutcome(), record.GetError())
+	}
+}
+
+func TestRecordAndReopen(t *testing.T) {
+	auditLog, path, cleanup := createTestLog(t)
+	defer cleanup()
+
+	deleted := createTestRecord("Deleted", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime)
+	failed := createTestRecord("Failed", "testProject", reaperconfig.AuditOutcome_FAILED, errors.New("not found"), currentTime)
+	for _, record := range []*reaperconfig.AuditRecord{deleted, failed} {
+		if err := auditLog.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	auditLog.Close()
+
+	reopened, err := NewLog(path)
+	if err != nil {
+		t.Fatalf("Reopening audit log failed: %v", err)
+	}
+	defer reopened.Close()
+	blocked := createTestRecord("Blocked", "testProject", reaperconfig.AuditOutcome_BLOCKED, errors.New("protected"), currentTime)
+	if err := reopened.Record(blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := reopened.Query(&reaperconfig.AuditLogQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*reaperconfig.AuditRecord{deleted, failed, blocked}
+	if len(records) != len(expected) {
+		t.Fatalf("Audit log has %d records; want %d", len(records), len(expected))
+	}
+	for idx := range expected {
+		if !proto.Equal(records[idx], expected[idx]) {
+			t.Errorf("Record %d = %v; want %v", idx, records[idx], expected[idx])
+		}
+	}
+}
+
+func TestTamperedLog(t *testing.T) {
+	auditLog, path, cleanup := createTestLog(t)
+	defer cleanup()
+	for _, name := range []string{"First", "Second", "Third"} {
+		auditLog.Record(createTestRecord(name, "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime))
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(contents), "\n")
+	tamperedLogs := map[string]string{
+		"edited":  strings.Replace(string(contents), "Second", "Other", 1),
+		"removed": lines[0] + lines[2],
+		"swapped": lines[1] + lines[0] + lines[2],
+	}
+	for tampering, tamperedContents := range tamperedLogs {
+		if err := ioutil.WriteFile(path, []byte(tamperedContents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := auditLog.Verify(); err == nil {
+			t.Errorf("Verifying %s audit log did not fail", tampering)
+		}
+		if _, err := auditLog.Query(&reaperconfig.AuditLogQuery{}); err == nil {
+			t.Errorf("Querying %s audit log did not fail", tampering)
+		}
+		if _, err := NewLog(path); err == nil {
+			t.Errorf("Opening %s audit log did not fail", tampering)
+		}
+	}
+}
+
+func TestQueryChangedLog(t *testing.T) {
+	auditLog, path, cleanup := createTestLog(t)
+	defer cleanup()
+	auditLog.Record(createTestRecord("First", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime))
+	if err := auditLog.Verify(); err != nil {
+		t.Errorf("Verifying audit log failed: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auditLog.Query(&reaperconfig.AuditLogQuery{}); err == nil {
+		t.Errorf("Querying emptied audit log did not fail")
+	}
+}
+
+func TestRecordAfterClose(t *testing.T) {
+	fileLog, _, cleanup := createTestLog(t)
+	defer cleanup()
+	memoryLog, _ := NewLog("")
+
+	for _, auditLog := range []*Log{fileLog, memoryLog} {
+		auditLog.Close()
+		err := auditLog.Record(createTestRecord("Late", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime))
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Recording to closed audit log %q returned %v; want ErrClosed", auditLog.path, err)
+		}
+	}
+}
+
+// failingFile is a log file whose writes fail after writing half of the data.
+type failingFile struct {
+	*os.File
+}
+
+func (file failingFile) Write(data []byte) (int, error) {
+	written, _ := file.File.Write(data[:len(data)/2])
+	return written, errors.New("disk full")
+}
+
+func TestFailedWrite(t *testing.T) {
+	auditLog, path, cleanup := createTestLog(t)
+	defer cleanup()
+	auditLog.Record(createTestRecord("First", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime))
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := auditLog.file.(*os.File)
+	auditLog.file = failingFile{file}
+	if err := auditLog.Record(createTestRecord("Second", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime)); err == nil {
+		t.Errorf("Recording with a failing write did not fail")
+	}
+	if failedInfo, err := os.Stat(path); err != nil || failedInfo.Size() != fileInfo.Size() {
+		t.Errorf("Audit log is %d bytes after a failed write; want it truncated back to %d", failedInfo.Size(), fileInfo.Size())
+	}
+
+	auditLog.file = file
+	if err := auditLog.Record(createTestRecord("Third", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime)); err != nil {
+		t.Fatalf("Recording after a failed write failed: %v", err)
+	}
+	if err := auditLog.Verify(); err != nil {
+		t.Errorf("Verifying audit log after a failed write failed: %v", err)
+	}
+	auditLog.Close()
+	reopened, err := NewLog(path)
+	if err != nil {
+		t.Fatalf("Reopening audit log after a failed write failed: %v", err)
+	}
+	defer reopened.Close()
+	records, _ := reopened.Query(&reaperconfig.AuditLogQuery{})
+	if len(records) != 2 || records[0].GetResource().GetName() != "First" || records[1].GetResource().GetName() != "Third" {
+		t.Errorf("Audit log has records %v; want First and Third", records)
+	}
+}
+
+func TestDeletionsSince(t *testing.T) {
+	auditLog, path, cleanup := createTestLog(t)
+	defer cleanup()
+	auditLog.Record(createTestRecord("Old", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime.Add(-30*time.Hour)))
+	otherReaperRecord := createTestRecord("Other", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime.Add(-2*time.Hour))
+	otherReaperRecord.ReaperUuid = "OtherUUID"
+	auditLog.Record(otherReaperRecord)
+	auditLog.Record(createTestRecord("Recent", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime.Add(-time.Hour)))
+	auditLog.Record(createTestRecord("Failed", "testProject", reaperconfig.AuditOutcome_FAILED, errors.New("failed"), currentTime))
+
+	// Only the deletions within a day of the latest record are kept in memory.
+	if len(auditLog.recentDeletions) != 2 {
+		t.Errorf("Audit log keeps %d deletions in memory; want 2", len(auditLog.recentDeletions))
+	}
+	reopened, err := NewLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for _, openLog := range []*Log{auditLog, reopened} {
+		if deleted, err := openLog.DeletionsSince("TestUUID", currentTime.Add(-24*time.Hour)); err != nil || deleted != 1 {
+			t.Errorf("Deletions in the last day = %d, %v; want 1", deleted, err)
+		}
+		if deleted, err := openLog.DeletionsSince("TestUUID", currentTime.Add(-48*time.Hour)); err != nil || deleted != 2 {
+			t.Errorf("Deletions in the last two days = %d, %v; want 2", deleted, err)
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	auditLog, path, cleanup := createTestLog(t)
+	defer cleanup()
+	for _, name := range []string{"First", "Second"} {
+		auditLog.Record(createTestRecord(name, "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime))
+	}
+	auditLog.Close()
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(contents), "\n")
+
+	damagedLogs := map[string]struct {
+		contents      string
+		expectedErr   error
+		expectedNames []string
+	}{
+		"partial line": {contents: string(contents) + lines[0][:20], expectedErr: ErrPartialLine, expectedNames: []string{"First", "Second"}},
+		"truncated":    {contents: lines[0], expectedErr: ErrHeadMismatch, expectedNames: []string{"First"}},
+	}
+	for damage, damagedLog := range damagedLogs {
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := Repair(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(damagedLog.contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewLog(path); !errors.Is(err, damagedLog.expectedErr) {
+			t.Errorf("Opening %s audit log returned error %v; want %v", damage, err, damagedLog.expectedErr)
+			continue
+		}
+		if err := Repair(path); err != nil {
+			t.Errorf("Repairing %s audit log failed: %v", damage, err)
+			continue
+		}
+		repaired, err := NewLog(path)
+		if err != nil {
+			t.Errorf("Opening repaired %s audit log failed: %v", damage, err)
+			continue
+		}
+		if err := repaired.Record(createTestRecord("Third", "testProject", reaperconfig.AuditOutcome_DELETED, nil, currentTime)); err != nil {
+			t.Errorf("Recording to repaired %s audit log failed: %v", damage, err)
+		}
+		records, err := repaired.Query(&reaperconfig.AuditLogQuery{})
+		repaired.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, record := range records {
+			names = append(names, record.GetResource().GetName())
+		}
+		expectedNames := append(damagedLog.expectedNames, "Third")
+		if !reflect.DeepEqual(names, expectedNames) {
+			t.Errorf("Repaired %s audit log has records %v; want %v", damage, names, expectedNames)
+		}
+	}
+}
+
+type QueryTestCase struct {
+	Query         *reaperconfig.AuditLogQuery
+	ExpectedNames []string
+}
+
+func TestQuery(t *testing.T) {
+	auditLog, err := NewLog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog.Record(createTestRecord("vm-1", "projectA", reaperconfig.AuditOutcome_DELETED, nil, currentTime.Add(-2*time.Hour)))
+	auditLog.Record(createTestRecord("vm-2", "projectB", reaperconfig.AuditOutcome_DELETED, nil, currentTime.Add(-time.Hour)))
+	auditLog.Record(createTestRecord("db-1", "projectA", reaperconfig.AuditOutcome_FAILED, errors.New("failed"), currentTime))
+
+	startTime, _ := ptypes.TimestampProto(currentTime.Add(-time.Hour))
+	endTime, _ := ptypes.TimestampProto(currentTime)
+	testCases := []QueryTestCase{
+		{&reaperconfig.AuditLogQuery{}, []string{"vm-1", "vm-2", "db-1"}},
+		{&reaperconfig.AuditLogQuery{StartTime: startTime}, []string{"vm-2", "db-1"}},
+		{&reaperconfig.AuditLogQuery{EndTime: endTime}, []string{"vm-1", "vm-2"}},
+		{&reaperconfig.AuditLogQuery{StartTime: startTime, EndTime: endTime}, []string{"vm-2"}},
+		{&reaperconfig.AuditLogQuery{ProjectId: "projectA"}, []string{"vm-1", "db-1"}},
+		{&reaperconfig.AuditLogQuery{ResourceFilter: "^vm-"}, []string{"vm-1", "vm-2"}},
+		{&reaperconfig.AuditLogQuery{ReaperUuid: "OtherUUID"}, nil},
+	}
+	for _, testCase := range testCases {
+		records, err := auditLog.Query(testCase.Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, record := range records {
+			names = append(names, record.GetResource().GetName())
+		}
+		if strings.Join(names, ",") != strings.Join(testCase.ExpectedNames, ",") {
+			t.Errorf("Query %v returned %v; want %v", testCase.Query, names, testCase.ExpectedNames)
+		}
+	}
+
+	if _, err := auditLog.Query(&reaperconfig.AuditLogQuery{ResourceFilter: "("}); err == nil {
+		t.Errorf("Query with malformed resource filter did not fail")
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// healthService is the prefix of the methods of the gRPC health service, which are never
+// authenticated so that the server can be probed.
+const healthService = "/grpc.health.v1.Health/"
+
+// AnyPrincipal in a method policy allows every authenticated principal to call a method.
+const AnyPrincipal = "*"
+
+// errNoToken is returned when a request has no bearer token.
+var errNoToken = errors.New("no bearer token")
+
+// An Authenticator verifies the bearer tokens sent with requests, and returns the principal
+// that a token identifies, such as the email of a user or service account.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (string, error)
+}
+
+// IDTokenAuthenticator authenticates Google ID tokens issued for its audience. The principal
+// of a token is its email, or its subject if it has no email.
+type IDTokenAuthenticator struct {
+	Audience string
+}
+
+// Authenticate implements Authenticator.
+func (authenticator IDTokenAuthenticator) Authenticate(ctx context.Context, token string) (string, error) {
+	payload, err := idtoken.Validate(ctx, token, authenticator.Audience)
+	if err != nil {
+		return "", err
+	}
+	if email, hasEmail := payload.Claims["email"].(string); hasEmail && len(email) > 0 {
+		return email, nil
+	}
+	return payload.Subject, nil
+}
+
+// StaticTokenAuthenticator authenticates a fixed set of tokens, each of which identifies a
+// principal.
+type StaticTokenAuthenticator struct {
+	principals map[string]string
+}
+
+// NewStaticTokenAuthenticator creates an authenticator for the tokens in the given map to the
+// principals they identify.
+func NewStaticTokenAuthenticator(principals map[string]string) *StaticTokenAuthenticator {
+	return &StaticTokenAuthenticator{principals: principals}
+}
+
+// LoadStaticTokenAuthenticator creates an authenticator for the tokens in a JSON file, which
+// maps each token to the principal it identifies.
+func LoadStaticTokenAuthenticator(path string) (*StaticTokenAuthenticator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var principals map[string]string
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return nil, fmt.Errorf("parsing token file %s failed: %v", path, err)
+	}
+	return NewStaticTokenAuthenticator(principals), nil
+}
+
+// Authenticate implements Authenticator. Tokens are compared in constant time.
+func (authenticator *StaticTokenAuthenticator) Authenticate(ctx context.Context, token string) (string, error) {
+	principal := ""
+	for knownToken, knownPrincipal := range authenticator.principals {
+		if subtle.ConstantTimeCompare([]byte(knownToken), []byte(token)) == 1 {
+			principal = knownPrincipal
+		}
+	}
+	if len(principal) == 0 {
+		return "", errors.New("unknown token")
+	}
+	return principal, nil
+}
+
+// Authenticators tries each of its authenticators in turn, and returns the principal from
+// the first that accepts a token.
+type Authenticators []Authenticator
+
+// Authenticate implements Authenticator.
+func (authenticators Authenticators) Authenticate(ctx context.Context, token string) (string, error) {
+	var errs []string
+	for _, authenticator := range authenticators {
+		principal, err := authenticator.Authenticate(ctx, token)
+		if err == nil {
+			return principal, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return "", errors.New(strings.Join(errs, "; "))
+}
+
+// MethodPolicy lists the principals that may call each method of the server, by the name
+// of the method, such as AddReaper. The principals listed for the method "*" may call
+// methods that are not listed, and AnyPrincipal allows every authenticated principal.
+type MethodPolicy struct {
+	Methods map[string][]string `json:"methods"`
+}
+
+// LoadMethodPolicy reads a method policy from a JSON file.
+func LoadMethodPolicy(path string) (*MethodPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &MethodPolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("parsing method policy %s failed: %v", path, err)
+	}
+	return policy, nil
+}
+
+// Allows returns whether the principal may call the method with the given full name, such
+// as /reaperconfig.ReaperManager/AddReaper. A nil policy allows every principal.
+func (policy *MethodPolicy) Allows(fullMethod, principal string) bool {
+	if policy == nil {
+		return true
+	}
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	principals, isListed := policy.Methods[method]
+	if !isListed {
+		principals = policy.Methods[AnyPrincipal]
+	}
+	for _, allowed := range principals {
+		if allowed == AnyPrincipal || allowed == principal {
+			return true
+		}
+	}
+	return false
+}
+
+// principalKey is the context key of the principal that made a request.
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context with the principal that made the request.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal that made the request, and whether the request
+// was authenticated.
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	principal, isAuthenticated := ctx.Value(principalKey{}).(string)
+	return principal, isAuthenticated
+}
+
+// Interceptor authenticates the requests to a gRPC server and authorizes them by method. A
+// request is authenticated by the bearer token in its authorization metadata, or if it has
+// none, by the client certificate it presented over mutual TLS. Requests to the gRPC health
+// service are never authenticated.
+type Interceptor struct {
+	authenticator Authenticator
+	policy        *MethodPolicy
+	onDeny        DenialHandler
+}
+
+// A DenialHandler is called with each request that an Interceptor denies, with the full
+// name of the method called and the reason it was denied. The principal is empty if the
+// request could not be authenticated.
+type DenialHandler func(principal, fullMethod string, err error)
+
+// NewInterceptor creates an interceptor that authenticates bearer tokens with the given
+// authenticator and authorizes requests with the policy. A nil authenticator only accepts
+// client certificates, and a nil policy allows every authenticated principal.
+func NewInterceptor(authenticator Authenticator, policy *MethodPolicy) *Interceptor {
+	return &Interceptor{authenticator: authenticator, policy: policy}
+}
+
+// SetDenialHandler sets the handler called with each request that the interceptor denies,
+// such as to record the denials in an audit log.
+func (interceptor *Interceptor) SetDenialHandler(onDeny DenialHandler) {
+	interceptor.onDeny = onDeny
+}
+
+// Unary returns a server option that intercepts unary requests.
+func (interceptor *Interceptor) Unary() grpc.ServerOption {
+	return grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := interceptor.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	})
+}
+
+// Stream returns a server option that intercepts streaming requests.
+func (interceptor *Interceptor) Stream() grpc.ServerOption {
+	return grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := interceptor.authorize(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &principalStream{stream, ctx})
+	})
+}
+
+// authorize authenticates the request with the given context and checks that its principal
+// may call the method. The returned context holds the principal. Denied requests are logged
+// and passed to the interceptor's denial handler.
+func (interceptor *Interceptor) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if strings.HasPrefix(fullMethod, healthService) {
+		return ctx, nil
+	}
+	principal, err := interceptor.authenticate(ctx)
+	if err != nil {
+		logger.With(logger.F("method", fullMethod), logger.Err(err)).Warnf("Unauthenticated request to %s: %s", fullMethod, err.Error())
+		err = fmt.Errorf("authentication failed: %v", err)
+		interceptor.denied("", fullMethod, err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if !interceptor.policy.Allows(fullMethod, principal) {
+		logger.With(logger.F("method", fullMethod), logger.F("principal", principal)).Warnf("Denied %s from calling %s", principal, fullMethod)
+		err := fmt.Errorf("%s may not call %s", principal, fullMethod)
+		interceptor.denied(principal, fullMethod, err)
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return WithPrincipal(ctx, principal), nil
+}
+
+// denied passes a denied request to the interceptor's denial handler, if it has one.
+func (interceptor *Interceptor) denied(principal, fullMethod string, err error) {
+	if interceptor.onDeny != nil {
+		interceptor.onDeny(principal, fullMethod, err)
+	}
+}
+
+// authenticate returns the principal of the bearer token in the request's metadata, or of
+// the client certificate if there is no token.
+func (interceptor *Interceptor) authenticate(ctx context.Context) (string, error) {
+	token, err := bearerToken(ctx)
+	if err == nil {
+		if interceptor.authenticator == nil {
+			return "", errors.New("bearer tokens are not accepted")
+		}
+		return interceptor.authenticator.Authenticate(ctx, token)
+	}
+	if err != errNoToken {
+		return "", err
+	}
+	if certificatePrincipal := peerCertificatePrincipal(ctx); len(certificatePrincipal) > 0 {
+		return certificatePrincipal, nil
+	}
+	return "", errNoToken
+}
+
+// bearerToken returns the bearer token in the authorization metadata of the request.
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", errNoToken
+	}
+	const prefix = "bearer "
+	if len(values[0]) <= len(prefix) || !strings.EqualFold(values[0][:len(prefix)], prefix) {
+		return "", errors.New("authorization metadata is not a bearer token")
+	}
+	return values[0][len(prefix):], nil
+}
+
+// peerCertificatePrincipal returns the principal of the verified client certificate of the
+// request, or an empty string if there is none. The principal is the certificate's first
+// email address, or its common name if it has none.
+func peerCertificatePrincipal(ctx context.Context) string {
+	requestPeer, hasPeer := peer.FromContext(ctx)
+	if !hasPeer {
+		return ""
+	}
+	tlsInfo, isTLS := requestPeer.AuthInfo.(credentials.TLSInfo)
+	if !isTLS || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return certificatePrincipal(tlsInfo.State.VerifiedChains[0][0])
+}
+
+// certificatePrincipal returns the first email address of the certificate, or its common
+// name if it has none.
+func certificatePrincipal(certificate *x509.Certificate) string {
+	if len(certificate.EmailAddresses) > 0 {
+		return certificate.EmailAddresses[0]
+	}
+	return certificate.Subject.CommonName
+}
+
+// principalStream is a server stream whose context holds the principal of the request.
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream, which holds the principal of the request.
+func (stream *principalStream) Context() context.Context {
+	return stream.ctx
+}
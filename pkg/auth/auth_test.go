@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var testContext = context.Background()
+
+const addReaperMethod = "/reaperconfig.ReaperManager/AddReaper"
+
+type MethodPolicyTestCase struct {
+	Method    string
+	Principal string
+	Expected  bool
+}
+
+func TestMethodPolicy(t *testing.T) {
+	policy := &MethodPolicy{Methods: map[string][]string{
+		"AddReaper":          []string{"alice@example.com"},
+		"ListRunningReapers": []string{AnyPrincipal},
+		AnyPrincipal:         []string{"admin@example.com"},
+	}}
+	testCases := []MethodPolicyTestCase{
+		{addReaperMethod, "alice@example.com", true},
+		{addReaperMethod, "bob@example.com", false},
+		{addReaperMethod, "admin@example.com", false},
+		{"/reaperconfig.ReaperManager/ListRunningReapers", "bob@example.com", true},
+		{"/reaperconfig.ReaperManager/DeleteReaper", "admin@example.com", true},
+		{"/reaperconfig.ReaperManager/DeleteReaper", "alice@example.com", false},
+	}
+	for _, testCase := range testCases {
+		if allowed := policy.Allows(testCase.Method, testCase.Principal); allowed != testCase.Expected {
+			t.Errorf("Policy allows %s to call %s = %t; want %t", testCase.Principal, testCase.Method, allowed, testCase.Expected)
+		}
+	}
+	var nilPolicy *MethodPolicy
+	if !nilPolicy.Allows(addReaperMethod, "bob@example.com") {
+		t.Errorf("Nil policy denied a principal")
+	}
+}
+
+func TestStaticTokenAuthenticator(t *testing.T) {
+	authenticator := NewStaticTokenAuthenticator(map[string]string{"secret": "alice@example.com"})
+	if principal, err := authenticator.Authenticate(testContext, "secret"); err != nil || principal != "alice@example.com" {
+		t.Errorf("Authenticate(secret) = %s, %v; want alice@example.com", principal, err)
+	}
+	if _, err := authenticator.Authenticate(testContext, "guess"); err == nil {
+		t.Errorf("Authenticate(guess) did not fail")
+	}
+	authenticators := Authenticators{NewStaticTokenAuthenticator(nil), authenticator}
+	if principal, err := authenticators.Authenticate(testContext, "secret"); err != nil || principal != "alice@example.com" {
+		t.Errorf("Authenticators.Authenticate(secret) = %s, %v; want alice@example.com", principal, err)
+	}
+}
+
+type AuthorizeTestCase struct {
+	Authorization     string
+	Method            string
+	ExpectedCode      codes.Code
+	ExpectedPrincipal string
+}
+
+func TestInterceptorAuthorize(t *testing.T) {
+	interceptor := NewInterceptor(
+		NewStaticTokenAuthenticator(map[string]string{"alice-token": "alice@example.com", "bob-token": "bob@example.com"}),
+		&MethodPolicy{Methods: map[string][]string{"AddReaper": []string{"alice@example.com"}}},
+	)
+	testCases := []AuthorizeTestCase{
+		{"Bearer alice-token", addReaperMethod, codes.OK, "alice@example.com"},
+		{"bearer alice-token", addReaperMethod, codes.OK, "alice@example.com"},
+		{"Bearer bob-token", addReaperMethod, codes.PermissionDenied, ""},
+		{"Bearer wrong-token", addReaperMethod, codes.Unauthenticated, ""},
+		{"Basic YWxpY2U6cGFzc3dvcmQ=", addReaperMethod, codes.Unauthenticated, ""},
+		{"", addReaperMethod, codes.Unauthenticated, ""},
+		{"", "/grpc.health.v1.Health/Check", codes.OK, ""},
+	}
+	var denials []string
+	interceptor.SetDenialHandler(func(principal, fullMethod string, err error) {
+		denials = append(denials, principal+" "+fullMethod)
+	})
+	for _, testCase := range testCases {
+		ctx := testContext
+		if len(testCase.Authorization) > 0 {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", testCase.Authorization))
+		}
+		authorizedCtx, err := interceptor.authorize(ctx, testCase.Method)
+		if code := status.Code(err); code != testCase.ExpectedCode {
+			t.Errorf("Authorizing %q for %s returned %s; want %s", testCase.Authorization, testCase.Method, code, testCase.ExpectedCode)
+			continue
+		}
+		if err != nil || len(testCase.ExpectedPrincipal) == 0 {
+			continue
+		}
+		if principal, _ := PrincipalFromContext(authorizedCtx); principal != testCase.ExpectedPrincipal {
+			t.Errorf("Authorizing %q gave principal %s; want %s", testCase.Authorization, principal, testCase.ExpectedPrincipal)
+		}
+	}
+	expectedDenials := []string{"bob@example.com " + addReaperMethod, " " + addReaperMethod, " " + addReaperMethod, " " + addReaperMethod}
+	if !reflect.DeepEqual(denials, expectedDenials) {
+		t.Errorf("Denial handler was called with %v; want %v", denials, expectedDenials)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certificates, err := utils.CreateTestCertificates(dir, "client@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := ServerTLSConfig(certificates.ServerCert, certificates.ServerKey, certificates.CA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig, err := ClientTLSConfig(certificates.CA, certificates.ClientCert, certificates.ClientKey, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	tlsServer := tls.Server(serverConn, serverConfig)
+	handshakeErr := make(chan error, 1)
+	go func() {
+		handshakeErr <- tls.Client(clientConn, clientConfig).Handshake()
+	}()
+	if err := tlsServer.Handshake(); err != nil {
+		t.Fatalf("Server handshake failed: %v", err)
+	}
+	if err := <-handshakeErr; err != nil {
+		t.Fatalf("Client handshake failed: %v", err)
+	}
+
+	// The verified client certificate authenticates requests without a bearer token.
+	ctx := peer.NewContext(testContext, &peer.Peer{AuthInfo: credentials.TLSInfo{State: tlsServer.ConnectionState()}})
+	authorizedCtx, err := NewInterceptor(nil, nil).authorize(ctx, addReaperMethod)
+	if err != nil {
+		t.Fatalf("Authorizing client certificate failed: %v", err)
+	}
+	if principal, _ := PrincipalFromContext(authorizedCtx); principal != "client@example.com" {
+		t.Errorf("Client certificate principal = %s; want client@example.com", principal)
+	}
+
+	if _, err := ClientTLSConfig(certificates.ServerKey, "", "", ""); err == nil {
+		t.Errorf("Loading a CA file without certificates did not fail")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// AllProjects in a role binding grants the role in every project. Operations on the whole
+// reaper manager, such as starting it, require a role in AllProjects.
+const AllProjects = "*"
+
+// Role is the level of access that a principal has to the reapers of a project. Each role
+// grants everything that the roles below it do.
+type Role string
+
+const (
+	// Viewer may list the reapers of a project and query its audit records.
+	Viewer Role = "viewer"
+	// Operator may also add, update and delete the reapers of a project. Reapers that find
+	// their projects through a parent or project filter, or that set credentials, require
+	// the role in AllProjects.
+	Operator Role = "operator"
+	// Admin may also start and shut down the reaper manager, when granted in AllProjects.
+	Admin Role = "admin"
+)
+
+// roleRanks orders the roles by the access they grant.
+var roleRanks = map[Role]int{
+	Viewer:   1,
+	Operator: 2,
+	Admin:    3,
+}
+
+// RoleBinding grants a role to a principal in a set of projects. AnyPrincipal grants the
+// role to every authenticated principal.
+type RoleBinding struct {
+	Principal string   `json:"principal"`
+	Role      Role     `json:"role"`
+	Projects  []string `json:"projects"`
+}
+
+// RolePolicy grants principals roles scoped to the projects that their reapers watch.
+type RolePolicy struct {
+	Bindings []RoleBinding `json:"bindings"`
+}
+
+// LoadRolePolicy reads a role policy from a JSON file, returning an error if any of its
+// bindings are malformed.
+func LoadRolePolicy(path string) (*RolePolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &RolePolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("parsing role policy %s failed: %v", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("role policy %s is invalid: %v", path, err)
+	}
+	return policy, nil
+}
+
+// Validate returns an error if any of the policy's bindings has no principal, an unknown
+// role or an empty project.
+func (policy *RolePolicy) Validate() error {
+	for i, binding := range policy.Bindings {
+		if len(binding.Principal) == 0 {
+			return fmt.Errorf("binding %d has no principal", i)
+		}
+		if _, isRole := roleRanks[binding.Role]; !isRole {
+			return fmt.Errorf("binding %d has unknown role %q", i, binding.Role)
+		}
+		if len(binding.Projects) == 0 {
+			return fmt.Errorf("binding %d has no projects", i)
+		}
+		for _, project := range binding.Projects {
+			if len(project) == 0 {
+				return fmt.Errorf("binding %d has an empty project", i)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows returns whether the principal has the role, or a role above it, in the project. The
+// project AllProjects is only allowed by bindings in AllProjects. A nil policy allows every
+// principal.
+func (policy *RolePolicy) Allows(principal string, role Role, projectID string) bool {
+	if policy == nil {
+		return true
+	}
+	for _, binding := range policy.Bindings {
+		if binding.Principal != AnyPrincipal && binding.Principal != principal {
+			continue
+		}
+		if roleRanks[binding.Role] < roleRanks[role] {
+			continue
+		}
+		for _, project := range binding.Projects {
+			if project == AllProjects || project == projectID {
+				return true
+			}
+		}
+	}
+	return false
+}
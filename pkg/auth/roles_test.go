@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type RolePolicyTestCase struct {
+	Principal string
+	Role      Role
+	ProjectID string
+	Expected  bool
+}
+
+func TestRolePolicy(t *testing.T) {
+	policy := &RolePolicy{Bindings: []RoleBinding{
+		{Principal: "alice@example.com", Role: Operator, Projects: []string{"team-a"}},
+		{Principal: "bob@example.com", Role: Viewer, Projects: []string{"team-a", "team-b"}},
+		{Principal: "admin@example.com", Role: Admin, Projects: []string{AllProjects}},
+		{Principal: AnyPrincipal, Role: Viewer, Projects: []string{"shared"}},
+	}}
+	testCases := []RolePolicyTestCase{
+		{"alice@example.com", Operator, "team-a", true},
+		{"alice@example.com", Viewer, "team-a", true},
+		{"alice@example.com", Admin, "team-a", false},
+		{"alice@example.com", Operator, "team-b", false},
+		{"alice@example.com", Viewer, AllProjects, false},
+		{"bob@example.com", Viewer, "team-b", true},
+		{"bob@example.com", Operator, "team-a", false},
+		{"admin@example.com", Admin, AllProjects, true},
+		{"admin@example.com", Operator, "team-c", true},
+		{"carol@example.com", Viewer, "shared", true},
+		{"carol@example.com", Operator, "shared", false},
+		{"carol@example.com", Viewer, "team-a", false},
+	}
+	for _, testCase := range testCases {
+		if allowed := policy.Allows(testCase.Principal, testCase.Role, testCase.ProjectID); allowed != testCase.Expected {
+			t.Errorf("Policy allows %s as %s in %s = %t; want %t", testCase.Principal, testCase.Role, testCase.ProjectID, allowed, testCase.Expected)
+		}
+	}
+	var nilPolicy *RolePolicy
+	if !nilPolicy.Allows("carol@example.com", Admin, AllProjects) {
+		t.Errorf("Nil policy denied a principal")
+	}
+}
+
+func TestLoadRolePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policyFiles := map[string]string{
+		"valid.json":          `{"bindings": [{"principal": "alice@example.com", "role": "operator", "projects": ["team-a"]}]}`,
+		"unknown_role.json":   `{"bindings": [{"principal": "alice@example.com", "role": "owner", "projects": ["team-a"]}]}`,
+		"no_principal.json":   `{"bindings": [{"role": "viewer", "projects": ["team-a"]}]}`,
+		"no_projects.json":    `{"bindings": [{"principal": "alice@example.com", "role": "viewer"}]}`,
+		"empty_project.json":  `{"bindings": [{"principal": "alice@example.com", "role": "viewer", "projects": [""]}]}`,
+		"malformed_json.json": `{"bindings": [`,
+	}
+	for name, contents := range policyFiles {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err := LoadRolePolicy(filepath.Join(dir, "valid.json"))
+	if err != nil {
+		t.Fatalf("Loading valid role policy failed: %v", err)
+	}
+	if !policy.Allows("alice@example.com", Operator, "team-a") {
+		t.Errorf("Loaded role policy denied alice@example.com as operator in team-a")
+	}
+	for name := range policyFiles {
+		if name == "valid.json" {
+			continue
+		}
+		if _, err := LoadRolePolicy(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Loading role policy %s succeeded; want error", name)
+		}
+	}
+}
@@ -18,8 +18,13 @@ import (
 	"context"
 	"errors"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/cloudfunctions"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/cloudrun"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/cloudsql"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gce"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gcs"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gke"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/pubsub"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
 	"google.golang.org/api/option"
@@ -39,16 +44,58 @@ type Client interface {
 	DeleteResource(projectID string, resource *resources.Resource) error
 }
 
+// A BatchDeleter is a Client that can delete many resources more efficiently than
+// one DeleteResource call at a time. DeleteResources returns one error per resource,
+// in the same order as the given resources, and the error is nil for each resource
+// that was deleted.
+type BatchDeleter interface {
+	DeleteResources(projectID string, resources []*resources.Resource) []error
+}
+
+// A Quarantiner is a Client that can make a resource unusable without deleting it, so
+// that the resource can still be recovered until it is deleted. Quarantine labels the
+// resource with the given labels, which include resources.QuarantineLabel.
+type Quarantiner interface {
+	Quarantine(projectID string, resource *resources.Resource, labels map[string]string) error
+}
+
+// A BackupCreator is a Client that can back up a resource before it is deleted. Backup
+// returns once the backup has been taken, and the backup is labeled with the given labels.
+type BackupCreator interface {
+	Backup(projectID string, resource *resources.Resource, config *reaperconfig.BackupConfig, labels map[string]string) error
+}
+
+// A ProtectionEnforcer is a Client that can delete more than the resources it is asked
+// to delete, such as the objects in a force deleted GCS bucket. It must not delete any of
+// those that the protection policy set with SetProtectionPolicy protects.
+type ProtectionEnforcer interface {
+	SetProtectionPolicy(policy *resources.ProtectionPolicy)
+}
+
 // NewClient is the factory method that returns the correct implementation of the GCP
 // client based on the resource type.
 func NewClient(resourceType reaperconfig.ResourceType) (Client, error) {
 	switch resourceType {
 	case reaperconfig.ResourceType_GCE_VM:
 		return gce.NewGCEClient(), nil
+	case reaperconfig.ResourceType_GCE_SNAPSHOT:
+		return gce.NewGCESnapshotClient(), nil
 	case reaperconfig.ResourceType_GCS_BUCKET:
 		return gcs.NewGCSBucketClient(), nil
 	case reaperconfig.ResourceType_GCS_OBJECT:
 		return gcs.NewGCSObjectClient(), nil
+	case reaperconfig.ResourceType_GKE_CLUSTER:
+		return gke.NewGKEClient(), nil
+	case reaperconfig.ResourceType_CLOUD_SQL_INSTANCE:
+		return cloudsql.NewCloudSQLClient(), nil
+	case reaperconfig.ResourceType_PUBSUB_TOPIC:
+		return pubsub.NewPubSubTopicClient(), nil
+	case reaperconfig.ResourceType_PUBSUB_SUBSCRIPTION:
+		return pubsub.NewPubSubSubscriptionClient(), nil
+	case reaperconfig.ResourceType_CLOUD_RUN_SERVICE:
+		return cloudrun.NewCloudRunClient(), nil
+	case reaperconfig.ResourceType_CLOUD_FUNCTION:
+		return cloudfunctions.NewCloudFunctionsClient(), nil
 	default:
 		return nil, errors.New("Unsupported Resource Type")
 	}
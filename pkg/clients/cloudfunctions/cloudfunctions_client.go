@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudfunctions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	functions "google.golang.org/api/cloudfunctions/v1"
+	"google.golang.org/api/option"
+)
+
+// operationPollInterval is how long to wait between checks on the status of a
+// long-running function operation.
+var operationPollInterval = 5 * time.Second
+
+// CloudFunctionsClient is a client for Cloud Functions. Note that the Zone for a
+// Cloud Function is its region.
+type CloudFunctionsClient struct {
+	Client *functions.Service
+	ctx    context.Context
+}
+
+// NewCloudFunctionsClient creates a new Cloud Functions client.
+func NewCloudFunctionsClient() *CloudFunctionsClient {
+	return &CloudFunctionsClient{}
+}
+
+// Auth authenticates the client to access Cloud Functions resources. See
+// https://pkg.go.dev/google.golang.org/api/option?tab=doc for more
+// information about passing options.
+func (client *CloudFunctionsClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	authedClient, err := functions.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.Client = authedClient
+	client.ctx = ctx
+	return nil
+}
+
+// GetResources gets the Cloud Functions that pass the filters defined in the ResourceConfig.
+// The API does not report when a function was created, so the update time is used for
+// functions that have only been deployed once. The creation time of functions that have
+// been redeployed is left unset, in which case the reaper uses the time it first saw them.
+func (client *CloudFunctionsClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var cloudFunctions []*resources.Resource
+	for _, region := range config.GetZones() {
+		functionsInRegion, err := client.getFunctionsInRegion(projectID, region, config)
+		if err != nil {
+			return nil, err
+		}
+		cloudFunctions = append(cloudFunctions, functionsInRegion...)
+	}
+	return cloudFunctions, nil
+}
+
+// getFunctionsInRegion gets the Cloud Functions in a single region that pass the filters
+// defined in the ResourceConfig, tracing the listing as its own span.
+func (client *CloudFunctionsClient) getFunctionsInRegion(projectID, region string, config *reaperconfig.ResourceConfig) (cloudFunctions []*resources.Resource, err error) {
+	ctx, span := tracing.StartZoneSpan(client.ctx, reaperconfig.ResourceType_CLOUD_FUNCTION, projectID, region)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	listFunctionsCall := client.Client.Projects.Locations.Functions.List(locationPath(projectID, region))
+	err = listFunctionsCall.Pages(ctx, func(page *functions.ListFunctionsResponse) error {
+		for _, function := range page.Functions {
+			var timeCreated time.Time
+			if function.VersionId == 1 {
+				timeCreated, _ = time.Parse(time.RFC3339, function.UpdateTime)
+			}
+			name := function.Name[strings.LastIndex(function.Name, "/")+1:]
+			parsedResource := resources.NewResource(name, region, timeCreated, reaperconfig.ResourceType_CLOUD_FUNCTION)
+			parsedResource.Labels = function.Labels
+			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+				cloudFunctions = append(cloudFunctions, parsedResource)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cloudFunctions, nil
+}
+
+// DeleteResource deletes the given Cloud Function, and waits for the delete operation
+// to complete.
+func (client *CloudFunctionsClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	functionPath := fmt.Sprintf("%s/functions/%s", locationPath(projectID, resource.Zone), resource.Name)
+	operation, err := client.Client.Projects.Locations.Functions.Delete(functionPath).Context(client.ctx).Do()
+	if err != nil {
+		return err
+	}
+	return client.waitForOperation(operation)
+}
+
+// waitForOperation polls the given operation until it is done, and returns an error if
+// the operation failed.
+func (client *CloudFunctionsClient) waitForOperation(operation *functions.Operation) error {
+	for !operation.Done {
+		select {
+		case <-client.ctx.Done():
+			return client.ctx.Err()
+		case <-time.After(operationPollInterval):
+		}
+
+		var err error
+		operation, err = client.Client.Operations.Get(operation.Name).Context(client.ctx).Do()
+		if err != nil {
+			return err
+		}
+	}
+	if operation.Error != nil {
+		return fmt.Errorf("operation %s failed: %s", operation.Name, operation.Error.Message)
+	}
+	return nil
+}
+
+// locationPath returns the resource path of a location in a project.
+func locationPath(projectID, location string) string {
+	return fmt.Sprintf("projects/%s/locations/%s", projectID, location)
+}
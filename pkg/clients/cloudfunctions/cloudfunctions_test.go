@@ -0,0 +1,209 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudfunctions
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// A mock object to represent a Cloud Function. Only the fields used by the
+// client are included.
+type Function struct {
+	Name       string `json:"name"`
+	UpdateTime string `json:"updateTime"`
+	VersionID  string `json:"versionId"`
+}
+
+// A mock object to represent a long-running operation.
+type Operation struct {
+	Name  string            `json:"name"`
+	Done  bool              `json:"done"`
+	Error map[string]string `json:"error,omitempty"`
+}
+
+var (
+	timeCreatedString = "2019-10-12T07:20:50.52Z"
+	timeCreated, _    = time.Parse(time.RFC3339, timeCreatedString)
+
+	testContext = context.Background()
+
+	// Map of project -> region -> functions in the region.
+	testFunctions map[string]map[string][]Function
+
+	// Map of operation name -> number of polls before the operation is done.
+	pendingOperations map[string]int
+	failedOperations  map[string]bool
+	deletedFunctions  []string
+)
+
+func init() {
+	operationPollInterval = time.Millisecond
+}
+
+func TestAuth(t *testing.T) {
+	client := NewCloudFunctionsClient()
+	if err := client.Auth(testContext); err != nil {
+		t.Errorf("Cloud Functions Auth failed with following error: %s", err.Error())
+	}
+}
+
+type GetResourcesTestCase struct {
+	ProjectID  string
+	NameFilter string
+	SkipFilter string
+	Regions    []string
+	Expected   []*resources.Resource
+}
+
+var getResourcesTestCases = []GetResourcesTestCase{
+	GetResourcesTestCase{"project1", "test", "", []string{"us-east1"}, []*resources.Resource{
+		resources.NewResource("test-function-1", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_FUNCTION),
+		resources.NewResource("test-function-redeployed", "us-east1", time.Time{}, reaperconfig.ResourceType_CLOUD_FUNCTION),
+	}},
+	GetResourcesTestCase{"project1", "test", "redeployed", []string{"us-east1", "us-central1"}, []*resources.Resource{
+		resources.NewResource("test-function-1", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_FUNCTION),
+		resources.NewResource("test-function-2", "us-central1", timeCreated, reaperconfig.ResourceType_CLOUD_FUNCTION),
+	}},
+	GetResourcesTestCase{"project2", "test", "", []string{"us-east1"}, nil},
+}
+
+func TestGetResources(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	client := NewCloudFunctionsClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	setupTestFunctions()
+	for _, testCase := range getResourcesTestCases {
+		config := &reaperconfig.ResourceConfig{
+			Zones:      testCase.Regions,
+			NameFilter: testCase.NameFilter,
+			SkipFilter: testCase.SkipFilter,
+		}
+		result, err := client.GetResources(testCase.ProjectID, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(result, testCase.Expected) {
+			t.Errorf("Resources not same as expected for name filter %s in %v", testCase.NameFilter, testCase.Regions)
+		}
+	}
+}
+
+type DeleteResourceTestCase struct {
+	Name            string
+	PendingPolls    int
+	Fails           bool
+	ExpectedDeleted []string
+}
+
+var deleteResourceTestCases = []DeleteResourceTestCase{
+	DeleteResourceTestCase{"test-function-1", 0, false, []string{"test-function-1"}},
+	DeleteResourceTestCase{"test-function-redeployed", 2, false, []string{"test-function-redeployed"}},
+	DeleteResourceTestCase{"test-function-1", 1, true, []string{"test-function-1"}},
+}
+
+func TestDeleteResource(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	client := NewCloudFunctionsClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	for _, testCase := range deleteResourceTestCases {
+		deletedFunctions = nil
+		operationName := "operations/delete-" + testCase.Name
+		pendingOperations = map[string]int{operationName: testCase.PendingPolls}
+		failedOperations = map[string]bool{operationName: testCase.Fails}
+
+		resource := resources.NewResource(testCase.Name, "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_FUNCTION)
+		err := client.DeleteResource("project1", resource)
+		if testCase.Fails && err == nil {
+			t.Errorf("Expected delete of %s to fail", testCase.Name)
+		}
+		if !testCase.Fails && err != nil {
+			t.Errorf("Cloud Functions delete resource failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(deletedFunctions, testCase.ExpectedDeleted) {
+			t.Errorf("Deleted functions = %v; want %v", deletedFunctions, testCase.ExpectedDeleted)
+		}
+		if pendingOperations[operationName] > 0 {
+			t.Errorf("Delete of %s returned before the operation was done", testCase.Name)
+		}
+	}
+}
+
+// Mock server's http handler for the Cloud Functions API.
+func testHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoints of the form: /v1/projects/{ProjectID}/locations/{Region}/functions[/{Name}]
+	// and /v1/operations/{Name}
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+
+	var operationName string
+	switch {
+	case splitEndpoint[2] == "operations":
+		operationName = strings.TrimPrefix(req.URL.Path, "/v1/")
+		pendingOperations[operationName]--
+	case len(splitEndpoint) == 7:
+		projectID, region := splitEndpoint[3], splitEndpoint[5]
+		var fullFunctions []Function
+		for _, function := range testFunctions[projectID][region] {
+			function.Name = strings.TrimPrefix(req.URL.Path, "/v1/") + "/" + function.Name
+			fullFunctions = append(fullFunctions, function)
+		}
+		utils.SendResponse(w, map[string][]Function{"functions": fullFunctions})
+		return
+	default:
+		name := splitEndpoint[7]
+		deletedFunctions = append(deletedFunctions, name)
+		operationName = "operations/delete-" + name
+	}
+
+	operation := Operation{Name: operationName, Done: pendingOperations[operationName] <= 0}
+	if operation.Done && failedOperations[operationName] {
+		operation.Error = map[string]string{"message": "function is in use"}
+	}
+	utils.SendResponse(w, operation)
+}
+
+func setupTestFunctions() {
+	testFunctions = map[string]map[string][]Function{
+		"project1": {
+			"us-east1": []Function{
+				Function{"test-function-1", timeCreatedString, "1"},
+				Function{"test-function-redeployed", timeCreatedString, "3"},
+				Function{"other-function", timeCreatedString, "1"},
+			},
+			"us-central1": []Function{
+				Function{"test-function-2", timeCreatedString, "1"},
+			},
+		},
+		"project2": {
+			"us-east1": []Function{
+				Function{"other-function", timeCreatedString, "1"},
+			},
+		},
+	}
+}
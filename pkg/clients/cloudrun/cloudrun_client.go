@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudrun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	run "google.golang.org/api/run/v1"
+)
+
+// ServiceLabel is the label Cloud Run puts on each revision that names the
+// service the revision belongs to.
+const ServiceLabel = "serving.knative.dev/service"
+
+// operationPollInterval is how long to wait between checks on whether a service
+// has finished being deleted.
+var operationPollInterval = 5 * time.Second
+
+// CloudRunClient is a client for Cloud Run services. Note that the Zone for a
+// Cloud Run service is its region. Revisions are not reaped on their own, and
+// are instead deleted along with the service they belong to.
+type CloudRunClient struct {
+	Client *run.APIService
+	ctx    context.Context
+}
+
+// NewCloudRunClient creates a new Cloud Run client.
+func NewCloudRunClient() *CloudRunClient {
+	return &CloudRunClient{}
+}
+
+// Auth authenticates the client to access Cloud Run resources. See
+// https://pkg.go.dev/google.golang.org/api/option?tab=doc for more
+// information about passing options.
+func (client *CloudRunClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	authedClient, err := run.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.Client = authedClient
+	client.ctx = ctx
+	return nil
+}
+
+// GetResources gets the Cloud Run services that pass the filters defined in the ResourceConfig.
+func (client *CloudRunClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var services []*resources.Resource
+	for _, region := range config.GetZones() {
+		servicesInRegion, err := client.getServicesInRegion(projectID, region, config)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, servicesInRegion...)
+	}
+	return services, nil
+}
+
+// getServicesInRegion gets the Cloud Run services in a single region that pass the filters
+// defined in the ResourceConfig, tracing the listing as its own span.
+func (client *CloudRunClient) getServicesInRegion(projectID, region string, config *reaperconfig.ResourceConfig) (services []*resources.Resource, err error) {
+	ctx, span := tracing.StartZoneSpan(client.ctx, reaperconfig.ResourceType_CLOUD_RUN_SERVICE, projectID, region)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	continueToken := ""
+	for {
+		listServicesCall := client.Client.Projects.Locations.Services.List(locationPath(projectID, region))
+		if len(continueToken) > 0 {
+			listServicesCall = listServicesCall.Continue(continueToken)
+		}
+		servicesInRegion, err := listServicesCall.Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range servicesInRegion.Items {
+			if service.Metadata == nil {
+				continue
+			}
+			// An unparsable timestamp leaves the creation time unset, in which case the reaper
+			// uses the time it first saw the service.
+			timeCreated, _ := time.Parse(time.RFC3339, service.Metadata.CreationTimestamp)
+			parsedResource := resources.NewResource(service.Metadata.Name, region, timeCreated, reaperconfig.ResourceType_CLOUD_RUN_SERVICE)
+			parsedResource.Labels = service.Metadata.Labels
+			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+				services = append(services, parsedResource)
+			}
+		}
+		if servicesInRegion.Metadata == nil || len(servicesInRegion.Metadata.Continue) == 0 {
+			return services, nil
+		}
+		continueToken = servicesInRegion.Metadata.Continue
+	}
+}
+
+// DeleteResource deletes the given Cloud Run service, and waits for the deletion to
+// complete. Any revisions of the service that are left behind are then deleted.
+func (client *CloudRunClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	servicePath := fmt.Sprintf("%s/services/%s", locationPath(projectID, resource.Zone), resource.Name)
+	_, err := client.Client.Projects.Locations.Services.Delete(servicePath).Context(client.ctx).Do()
+	if err != nil {
+		return err
+	}
+	if err := client.waitForDeletion(servicePath); err != nil {
+		return err
+	}
+	return client.deleteRevisions(projectID, resource)
+}
+
+// waitForDeletion polls the service at the given path until it no longer exists.
+func (client *CloudRunClient) waitForDeletion(servicePath string) error {
+	for {
+		_, err := client.Client.Projects.Locations.Services.Get(servicePath).Context(client.ctx).Do()
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-client.ctx.Done():
+			return client.ctx.Err()
+		case <-time.After(operationPollInterval):
+		}
+	}
+}
+
+// deleteRevisions deletes the revisions that belong to the given service. Revisions
+// that have already been deleted by Cloud Run are ignored.
+func (client *CloudRunClient) deleteRevisions(projectID string, resource *resources.Resource) error {
+	parent := locationPath(projectID, resource.Zone)
+	revisionNames, err := client.listRevisions(parent, resource.Name)
+	if err != nil {
+		return err
+	}
+	for _, revisionName := range revisionNames {
+		revisionPath := fmt.Sprintf("%s/revisions/%s", parent, revisionName)
+		_, err := client.Client.Projects.Locations.Revisions.Delete(revisionPath).Context(client.ctx).Do()
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// listRevisions returns the names of the revisions in the given location that belong to
+// the service, following every page of the listing.
+func (client *CloudRunClient) listRevisions(parent, serviceName string) ([]string, error) {
+	var revisionNames []string
+	continueToken := ""
+	for {
+		listRevisionsCall := client.Client.Projects.Locations.Revisions.List(parent)
+		listRevisionsCall = listRevisionsCall.LabelSelector(fmt.Sprintf("%s=%s", ServiceLabel, serviceName))
+		if len(continueToken) > 0 {
+			listRevisionsCall = listRevisionsCall.Continue(continueToken)
+		}
+		revisions, err := listRevisionsCall.Context(client.ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		for _, revision := range revisions.Items {
+			if revision.Metadata != nil {
+				revisionNames = append(revisionNames, revision.Metadata.Name)
+			}
+		}
+		if revisions.Metadata == nil || len(revisions.Metadata.Continue) == 0 {
+			return revisionNames, nil
+		}
+		continueToken = revisions.Metadata.Continue
+	}
+}
+
+// isNotFound returns whether the given error is a not found error from the API.
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == http.StatusNotFound
+}
+
+// locationPath returns the resource path of a location in a project.
+func locationPath(projectID, location string) string {
+	return fmt.Sprintf("projects/%s/locations/%s", projectID, location)
+}
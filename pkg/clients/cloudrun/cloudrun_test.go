@@ -0,0 +1,258 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudrun
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// A mock object to represent both Cloud Run services and revisions. Only the
+// fields used by the client are included.
+type KnativeObject struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	CreationTimestamp string            `json:"creationTimestamp,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+}
+
+var (
+	timeCreatedString = "2019-10-12T07:20:50.52Z"
+	timeCreated, _    = time.Parse(time.RFC3339, timeCreatedString)
+
+	testContext = context.Background()
+
+	// Map of project -> region -> collection (services or revisions) -> objects.
+	testObjects map[string]map[string]map[string][]KnativeObject
+
+	// Map of service name -> number of polls before the service is gone.
+	pendingDeletions map[string]int
+	deletedPaths     []string
+)
+
+// listPageSize is the number of objects the mock server returns in each page of a listing,
+// so that the client has to follow the continue token.
+const listPageSize = 2
+
+func init() {
+	operationPollInterval = time.Millisecond
+}
+
+func TestAuth(t *testing.T) {
+	client := NewCloudRunClient()
+	if err := client.Auth(testContext); err != nil {
+		t.Errorf("Cloud Run Auth failed with following error: %s", err.Error())
+	}
+}
+
+type GetResourcesTestCase struct {
+	ProjectID  string
+	NameFilter string
+	SkipFilter string
+	Regions    []string
+	Expected   []*resources.Resource
+}
+
+var getResourcesTestCases = []GetResourcesTestCase{
+	GetResourcesTestCase{"project1", "test", "", []string{"us-east1"}, []*resources.Resource{
+		resources.NewResource("test-service-1", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_RUN_SERVICE),
+		resources.NewResource("test-service-2", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_RUN_SERVICE),
+	}},
+	GetResourcesTestCase{"project1", "test", "2", []string{"us-east1", "us-central1"}, []*resources.Resource{
+		resources.NewResource("test-service-1", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_RUN_SERVICE),
+		resources.NewResource("test-service-3", "us-central1", time.Time{}, reaperconfig.ResourceType_CLOUD_RUN_SERVICE),
+	}},
+	GetResourcesTestCase{"project2", "test", "", []string{"us-east1"}, nil},
+}
+
+func TestGetResources(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	client := NewCloudRunClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	setupTestObjects()
+	for _, testCase := range getResourcesTestCases {
+		config := &reaperconfig.ResourceConfig{
+			Zones:      testCase.Regions,
+			NameFilter: testCase.NameFilter,
+			SkipFilter: testCase.SkipFilter,
+		}
+		result, err := client.GetResources(testCase.ProjectID, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(result, testCase.Expected) {
+			t.Errorf("Resources not same as expected for name filter %s in %v", testCase.NameFilter, testCase.Regions)
+		}
+	}
+}
+
+type DeleteResourceTestCase struct {
+	Name            string
+	PendingPolls    int
+	ExpectedDeleted []string
+	ExpectError     bool
+}
+
+var deleteResourceTestCases = []DeleteResourceTestCase{
+	DeleteResourceTestCase{"test-service-1", 0, []string{
+		"projects/project1/locations/us-east1/services/test-service-1",
+		"projects/project1/locations/us-east1/revisions/test-service-1-00001",
+		"projects/project1/locations/us-east1/revisions/test-service-1-00002",
+		"projects/project1/locations/us-east1/revisions/test-service-1-00003",
+	}, false},
+	DeleteResourceTestCase{"test-service-2", 2, []string{
+		"projects/project1/locations/us-east1/services/test-service-2",
+	}, false},
+	DeleteResourceTestCase{"does-not-exist", 0, nil, true},
+}
+
+func TestDeleteResource(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	client := NewCloudRunClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	for _, testCase := range deleteResourceTestCases {
+		setupTestObjects()
+		deletedPaths = nil
+		pendingDeletions = map[string]int{testCase.Name: testCase.PendingPolls}
+
+		resource := resources.NewResource(testCase.Name, "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_RUN_SERVICE)
+		err := client.DeleteResource("project1", resource)
+		if testCase.ExpectError && err == nil {
+			t.Errorf("Expected delete of %s to fail", testCase.Name)
+		}
+		if !testCase.ExpectError && err != nil {
+			t.Errorf("Cloud Run delete resource failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(deletedPaths, testCase.ExpectedDeleted) {
+			t.Errorf("Deleted = %v; want %v", deletedPaths, testCase.ExpectedDeleted)
+		}
+		if pendingDeletions[testCase.Name] > 0 {
+			t.Errorf("Delete of %s returned before the service was gone", testCase.Name)
+		}
+	}
+}
+
+// Mock server's http handler for the Cloud Run API.
+func testHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoints of the form: /v1/projects/{ProjectID}/locations/{Region}/{services|revisions}[/{Name}]
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+	projectID := splitEndpoint[3]
+	region := splitEndpoint[5]
+	collection := splitEndpoint[6]
+	objects := testObjects[projectID][region][collection]
+
+	if len(splitEndpoint) == 7 {
+		selector := strings.SplitN(req.URL.Query().Get("labelSelector"), "=", 2)
+		var items []KnativeObject
+		for _, object := range objects {
+			if len(selector) < 2 || object.Metadata.Labels[selector[0]] == selector[1] {
+				items = append(items, object)
+			}
+		}
+		utils.SendResponse(w, listPage(items, req.URL.Query().Get("continue")))
+		return
+	}
+
+	name := splitEndpoint[7]
+	for i, object := range objects {
+		if object.Metadata.Name != name {
+			continue
+		}
+		if req.Method == "DELETE" {
+			deletedPaths = append(deletedPaths, strings.TrimPrefix(req.URL.Path, "/v1/"))
+			utils.SendResponse(w, map[string]string{"status": "Success"})
+			return
+		}
+		// The service is removed once it has been polled enough times.
+		if pendingDeletions[name] > 0 {
+			pendingDeletions[name]--
+			utils.SendResponse(w, object)
+			return
+		}
+		testObjects[projectID][region][collection] = append(objects[:i], objects[i+1:]...)
+		break
+	}
+	http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+}
+
+// listPage returns the page of a listing of the items that starts at the continue token,
+// along with the token of the next page if there is one.
+func listPage(items []KnativeObject, continueToken string) map[string]interface{} {
+	start, _ := strconv.Atoi(continueToken)
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + listPageSize
+	if end >= len(items) {
+		return map[string]interface{}{"items": items[start:]}
+	}
+	return map[string]interface{}{
+		"items":    items[start:end],
+		"metadata": map[string]string{"continue": strconv.Itoa(end)},
+	}
+}
+
+func setupTestObjects() {
+	serviceLabel := func(service string) map[string]string {
+		return map[string]string{ServiceLabel: service}
+	}
+	testObjects = map[string]map[string]map[string][]KnativeObject{
+		"project1": {
+			"us-east1": {
+				"services": []KnativeObject{
+					KnativeObject{ObjectMeta{Name: "test-service-1", CreationTimestamp: timeCreatedString}},
+					KnativeObject{ObjectMeta{Name: "test-service-2", CreationTimestamp: timeCreatedString}},
+					KnativeObject{ObjectMeta{Name: "other-service", CreationTimestamp: timeCreatedString}},
+				},
+				"revisions": []KnativeObject{
+					KnativeObject{ObjectMeta{Name: "test-service-1-00001", Labels: serviceLabel("test-service-1")}},
+					KnativeObject{ObjectMeta{Name: "test-service-1-00002", Labels: serviceLabel("test-service-1")}},
+					KnativeObject{ObjectMeta{Name: "test-service-1-00003", Labels: serviceLabel("test-service-1")}},
+					KnativeObject{ObjectMeta{Name: "other-service-00001", Labels: serviceLabel("other-service")}},
+				},
+			},
+			"us-central1": {
+				"services": []KnativeObject{
+					KnativeObject{ObjectMeta{Name: "test-service-3"}},
+				},
+			},
+		},
+		"project2": {
+			"us-east1": {
+				"services": []KnativeObject{
+					KnativeObject{ObjectMeta{Name: "other-service", CreationTimestamp: timeCreatedString}},
+				},
+			},
+		},
+	}
+}
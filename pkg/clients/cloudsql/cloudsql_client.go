@@ -0,0 +1,242 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// operationPollInterval is how long to wait between checks on the status of a
+// Cloud SQL operation.
+var operationPollInterval = 5 * time.Second
+
+// CloudSQLClient is a client for Cloud SQL instances. Note that the Zone for a
+// Cloud SQL instance is its region.
+type CloudSQLClient struct {
+	Client *sqladmin.Service
+
+	ctx        context.Context
+	httpClient *http.Client
+}
+
+// instance holds the fields of a Cloud SQL instance needed by the reaper. The
+// generated sqladmin types predate the createTime and deletionProtectionEnabled
+// fields, so instances are decoded from the raw API response instead.
+type instance struct {
+	Name         string `json:"name"`
+	Region       string `json:"region"`
+	CreateTime   string `json:"createTime"`
+	ServerCaCert *struct {
+		CreateTime string `json:"createTime"`
+	} `json:"serverCaCert"`
+	Settings *struct {
+		DeletionProtectionEnabled bool              `json:"deletionProtectionEnabled"`
+		UserLabels                map[string]string `json:"userLabels"`
+	} `json:"settings"`
+}
+
+// NewCloudSQLClient creates a new Cloud SQL client.
+func NewCloudSQLClient() *CloudSQLClient {
+	return &CloudSQLClient{}
+}
+
+// Auth authenticates the client to access Cloud SQL resources. See
+// https://pkg.go.dev/google.golang.org/api/option?tab=doc for more
+// information about passing options.
+func (client *CloudSQLClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	opts = append([]option.ClientOption{option.WithScopes(sqladmin.CloudPlatformScope)}, opts...)
+	httpClient, endpoint, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	authedClient, err := sqladmin.New(httpClient)
+	if err != nil {
+		return err
+	}
+	if len(endpoint) > 0 {
+		authedClient.BasePath = endpoint
+	}
+	client.Client = authedClient
+	client.ctx = ctx
+	client.httpClient = httpClient
+	return nil
+}
+
+// GetResources gets the Cloud SQL instances that pass the filters defined in the ResourceConfig.
+// Instances with deletion protection enabled are never added to the watchlist. The zones in the
+// config are matched against the instances' regions.
+func (client *CloudSQLClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var instances []*resources.Resource
+	projectInstances, err := client.listInstances(projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range projectInstances {
+		if !isInRegions(instance.Region, config.GetZones()) || instance.hasDeletionProtection() {
+			continue
+		}
+		parsedResource := resources.NewResource(instance.Name, instance.Region, instance.timeCreated(), reaperconfig.ResourceType_CLOUD_SQL_INSTANCE)
+		parsedResource.Labels = instance.labels()
+		if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+			instances = append(instances, parsedResource)
+		}
+	}
+	return instances, nil
+}
+
+// DeleteResource deletes the given Cloud SQL instance, and waits for the delete operation to
+// complete. The instance is not deleted if deletion protection has been enabled on it.
+func (client *CloudSQLClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	instance, err := client.getInstance(projectID, resource.Name)
+	if err != nil {
+		return err
+	}
+	if instance.hasDeletionProtection() {
+		return fmt.Errorf("Cloud SQL instance %s has deletion protection enabled", resource.Name)
+	}
+
+	deleteInstanceCall := client.Client.Instances.Delete(projectID, resource.Name)
+	operation, err := deleteInstanceCall.Context(client.ctx).Do()
+	if err != nil {
+		return err
+	}
+	return client.waitForOperation(projectID, operation)
+}
+
+// waitForOperation polls the given operation until it is done, and returns an error if
+// the operation failed.
+func (client *CloudSQLClient) waitForOperation(projectID string, operation *sqladmin.Operation) error {
+	for operation.Status != "DONE" {
+		select {
+		case <-client.ctx.Done():
+			return client.ctx.Err()
+		case <-time.After(operationPollInterval):
+		}
+
+		var err error
+		operation, err = client.Client.Operations.Get(projectID, operation.Name).Context(client.ctx).Do()
+		if err != nil {
+			return err
+		}
+	}
+	if operation.Error != nil && len(operation.Error.Errors) > 0 {
+		var messages []string
+		for _, operationError := range operation.Error.Errors {
+			messages = append(messages, fmt.Sprintf("%s: %s", operationError.Code, operationError.Message))
+		}
+		return fmt.Errorf("operation %s failed: %s", operation.Name, strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// listInstances lists all the Cloud SQL instances in a project.
+func (client *CloudSQLClient) listInstances(projectID string) ([]*instance, error) {
+	var instances []*instance
+	pageToken := ""
+	for {
+		listPath := fmt.Sprintf("sql/v1beta4/projects/%s/instances", url.PathEscape(projectID))
+		if len(pageToken) > 0 {
+			listPath += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+		var response struct {
+			Items         []*instance `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		if err := client.get(listPath, &response); err != nil {
+			return nil, err
+		}
+		instances = append(instances, response.Items...)
+		if len(response.NextPageToken) == 0 {
+			return instances, nil
+		}
+		pageToken = response.NextPageToken
+	}
+}
+
+// getInstance gets a single Cloud SQL instance.
+func (client *CloudSQLClient) getInstance(projectID, name string) (*instance, error) {
+	instancePath := fmt.Sprintf("sql/v1beta4/projects/%s/instances/%s", url.PathEscape(projectID), url.PathEscape(name))
+	result := &instance{}
+	if err := client.get(instancePath, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// get sends a GET request to the Cloud SQL Admin API, and decodes the JSON response
+// into result.
+func (client *CloudSQLClient) get(path string, result interface{}) error {
+	req, err := http.NewRequest("GET", googleapi.ResolveRelative(client.Client.BasePath, path), nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.httpClient.Do(req.WithContext(client.ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// timeCreated returns when the instance was created. Older API responses do not include
+// the creation time, in which case the creation time of the instance's server CA
+// certificate is used, since it is created along with the instance.
+func (i *instance) timeCreated() time.Time {
+	createTime := i.CreateTime
+	if len(createTime) == 0 && i.ServerCaCert != nil {
+		createTime = i.ServerCaCert.CreateTime
+	}
+	timeCreated, _ := time.Parse(time.RFC3339, createTime)
+	return timeCreated
+}
+
+// hasDeletionProtection returns whether deletion protection is enabled on the instance.
+func (i *instance) hasDeletionProtection() bool {
+	return i.Settings != nil && i.Settings.DeletionProtectionEnabled
+}
+
+// labels returns the user labels of the instance.
+func (i *instance) labels() map[string]string {
+	if i.Settings == nil {
+		return nil
+	}
+	return i.Settings.UserLabels
+}
+
+// isInRegions returns whether region is one of the given regions.
+func isInRegions(region string, regions []string) bool {
+	for _, configRegion := range regions {
+		if strings.EqualFold(region, configRegion) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// A mock object to represent a Cloud SQL instance. Only the fields used
+// by the client are included.
+type Instance struct {
+	Name         string    `json:"name"`
+	Region       string    `json:"region"`
+	CreateTime   string    `json:"createTime,omitempty"`
+	ServerCaCert *SslCert  `json:"serverCaCert,omitempty"`
+	Settings     *Settings `json:"settings,omitempty"`
+}
+
+type SslCert struct {
+	CreateTime string `json:"createTime"`
+}
+
+type Settings struct {
+	DeletionProtectionEnabled bool `json:"deletionProtectionEnabled"`
+}
+
+var (
+	timeCreatedString = "2019-10-12T07:20:50.52Z"
+	timeCreated, _    = time.Parse(time.RFC3339, timeCreatedString)
+
+	testContext = context.Background()
+
+	// Map of project -> Instances in project.
+	testInstances map[string][]Instance
+
+	// Map of operation name -> number of polls before the operation is done.
+	pendingOperations map[string]int
+	deletedInstances  []string
+)
+
+func init() {
+	operationPollInterval = time.Millisecond
+}
+
+func TestAuth(t *testing.T) {
+	client := NewCloudSQLClient()
+	if err := client.Auth(testContext); err != nil {
+		t.Errorf("Cloud SQL Auth failed with following error: %s", err.Error())
+	}
+}
+
+type GetResourcesTestCase struct {
+	ProjectID  string
+	NameFilter string
+	SkipFilter string
+	Regions    []string
+	Expected   []*resources.Resource
+}
+
+var getResourcesTestCases = []GetResourcesTestCase{
+	GetResourcesTestCase{"project1", "test", "", []string{"us-east1"}, []*resources.Resource{
+		resources.NewResource("test-db-1", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_SQL_INSTANCE),
+		resources.NewResource("test-db-old", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_SQL_INSTANCE),
+	}},
+	GetResourcesTestCase{"project1", "test", "old", []string{"us-east1", "us-central1"}, []*resources.Resource{
+		resources.NewResource("test-db-1", "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_SQL_INSTANCE),
+		resources.NewResource("test-db-2", "us-central1", timeCreated, reaperconfig.ResourceType_CLOUD_SQL_INSTANCE),
+	}},
+	GetResourcesTestCase{"project1", "protected", "", []string{"us-east1", "us-central1"}, nil},
+	GetResourcesTestCase{"project2", "test", "", []string{"us-east1"}, nil},
+}
+
+func TestGetResources(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	client := NewCloudSQLClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	setupTestInstances()
+	for _, testCase := range getResourcesTestCases {
+		config := &reaperconfig.ResourceConfig{
+			Zones:      testCase.Regions,
+			NameFilter: testCase.NameFilter,
+			SkipFilter: testCase.SkipFilter,
+		}
+		result, err := client.GetResources(testCase.ProjectID, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(result, testCase.Expected) {
+			t.Errorf("Resources not same as expected for name filter %s in %v", testCase.NameFilter, testCase.Regions)
+		}
+	}
+}
+
+type DeleteResourceTestCase struct {
+	ProjectID       string
+	Name            string
+	PendingPolls    int
+	ExpectedDeleted []string
+	ExpectError     bool
+}
+
+var deleteResourceTestCases = []DeleteResourceTestCase{
+	DeleteResourceTestCase{"project1", "test-db-1", 0, []string{"test-db-1"}, false},
+	DeleteResourceTestCase{"project1", "test-db-2", 2, []string{"test-db-2"}, false},
+	DeleteResourceTestCase{"project1", "protected-db", 0, nil, true},
+	DeleteResourceTestCase{"project1", "does-not-exist", 0, nil, true},
+}
+
+func TestDeleteResource(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	client := NewCloudSQLClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	setupTestInstances()
+	for _, testCase := range deleteResourceTestCases {
+		deletedInstances = nil
+		pendingOperations = map[string]int{"operation-" + testCase.Name: testCase.PendingPolls}
+
+		resource := resources.NewResource(testCase.Name, "us-east1", timeCreated, reaperconfig.ResourceType_CLOUD_SQL_INSTANCE)
+		err := client.DeleteResource(testCase.ProjectID, resource)
+		if testCase.ExpectError && err == nil {
+			t.Errorf("Expected delete of %s to fail", testCase.Name)
+		}
+		if !testCase.ExpectError && err != nil {
+			t.Errorf("Cloud SQL delete resource failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(deletedInstances, testCase.ExpectedDeleted) {
+			t.Errorf("Deleted instances = %v; want %v", deletedInstances, testCase.ExpectedDeleted)
+		}
+		if pendingOperations["operation-"+testCase.Name] > 0 {
+			t.Errorf("Delete of %s returned before the operation was done", testCase.Name)
+		}
+	}
+}
+
+// Mock server's http handler for the Cloud SQL Admin API.
+func testHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoints of the form: /sql/v1beta4/projects/{ProjectID}/instances[/{Name}]
+	// and /sql/v1beta4/projects/{ProjectID}/operations/{Name}
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+	projectID := splitEndpoint[4]
+	collection := splitEndpoint[5]
+
+	if len(splitEndpoint) == 6 {
+		response := struct {
+			Items []Instance `json:"items"`
+		}{testInstances[projectID]}
+		utils.SendResponse(w, response)
+		return
+	}
+
+	name := splitEndpoint[6]
+	var operationName string
+	switch {
+	case collection == "instances" && req.Method == "GET":
+		for _, instance := range testInstances[projectID] {
+			if instance.Name == name {
+				utils.SendResponse(w, instance)
+				return
+			}
+		}
+		http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+		return
+	case collection == "instances" && req.Method == "DELETE":
+		deletedInstances = append(deletedInstances, name)
+		operationName = "operation-" + name
+	case collection == "operations":
+		operationName = name
+		pendingOperations[operationName]--
+	}
+
+	status := "RUNNING"
+	if pendingOperations[operationName] <= 0 {
+		status = "DONE"
+	}
+	utils.SendResponse(w, map[string]string{"name": operationName, "status": status})
+}
+
+func setupTestInstances() {
+	testInstances = map[string][]Instance{
+		"project1": []Instance{
+			Instance{Name: "test-db-1", Region: "us-east1", CreateTime: timeCreatedString},
+			Instance{Name: "test-db-2", Region: "us-central1", CreateTime: timeCreatedString},
+			Instance{Name: "test-db-old", Region: "us-east1", ServerCaCert: &SslCert{timeCreatedString}},
+			Instance{Name: "protected-db", Region: "us-east1", CreateTime: timeCreatedString, Settings: &Settings{true}},
+		},
+		"project2": []Instance{
+			Instance{Name: "other-db", Region: "us-east1", CreateTime: timeCreatedString},
+		},
+	}
+}
@@ -16,6 +16,9 @@ package gce
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
@@ -23,11 +26,19 @@ import (
 	"google.golang.org/api/option"
 
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
 )
 
+// maxResourceNameLength is the maximum length of the name of a Compute Engine resource.
+const maxResourceNameLength = 63
+
+// snapshotTimeout is how long Backup waits for a snapshot of a disk to be taken.
+var snapshotTimeout = 30 * time.Minute
+
 // Client for a Compute Engine Resource.
 type GCEClient struct {
 	Client *compute.Service
+	ctx    context.Context
 }
 
 func NewGCEClient() *GCEClient {
@@ -43,6 +54,7 @@ func (client *GCEClient) Auth(ctx context.Context, opts ...option.ClientOption)
 		return err
 	}
 	client.Client = authedClient
+	client.ctx = ctx
 	return nil
 }
 
@@ -51,19 +63,36 @@ func (client *GCEClient) GetResources(projectID string, config *reaperconfig.Res
 	var instances []*resources.Resource
 	zones := config.GetZones()
 	for _, zone := range zones {
-		zoneInstancesCall := client.Client.Instances.List(projectID, zone)
-		// Info on filtering: https://cloud.google.com/compute/docs/reference/rest/v1/instances/list
-		// zoneInstancesCall.Filter()
-		instancesInZone, err := zoneInstancesCall.Do()
+		instancesInZone, err := client.getInstancesInZone(projectID, zone, config)
 		if err != nil {
 			return nil, err
 		}
-		for _, instance := range instancesInZone.Items {
-			timeCreated, _ := time.Parse(time.RFC3339, instance.CreationTimestamp)
-			parsedResource := resources.NewResource(instance.Name, zone, timeCreated, reaperconfig.ResourceType_GCE_VM)
-			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
-				instances = append(instances, parsedResource)
-			}
+		instances = append(instances, instancesInZone...)
+	}
+	return instances, nil
+}
+
+// getInstancesInZone gets the Compute Engine instances in a single zone that pass the filters
+// defined in the ResourceConfig, tracing the listing as its own span.
+func (client *GCEClient) getInstancesInZone(projectID, zone string, config *reaperconfig.ResourceConfig) (instances []*resources.Resource, err error) {
+	ctx, span := tracing.StartZoneSpan(client.ctx, reaperconfig.ResourceType_GCE_VM, projectID, zone)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	zoneInstancesCall := client.Client.Instances.List(projectID, zone)
+	// Info on filtering: https://cloud.google.com/compute/docs/reference/rest/v1/instances/list
+	// zoneInstancesCall.Filter()
+	instancesInZone, err := zoneInstancesCall.Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range instancesInZone.Items {
+		// An unparsable timestamp leaves the creation time unset, in which case the reaper
+		// uses the time it first saw the instance.
+		timeCreated, _ := time.Parse(time.RFC3339, instance.CreationTimestamp)
+		parsedResource := resources.NewResource(instance.Name, zone, timeCreated, reaperconfig.ResourceType_GCE_VM)
+		parsedResource.Labels = instance.Labels
+		if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+			instances = append(instances, parsedResource)
 		}
 	}
 	return instances, nil
@@ -75,3 +104,80 @@ func (client *GCEClient) DeleteResource(projectID string, resource *resources.Re
 	_, err := deleteInstanceCall.Do()
 	return err
 }
+
+// Quarantine adds the quarantine labels to the given Compute Engine instance and stops it.
+// The instance's disks are kept, so it can be restarted until it is deleted.
+func (client *GCEClient) Quarantine(projectID string, resource *resources.Resource, quarantineLabels map[string]string) error {
+	instance, err := client.Client.Instances.Get(projectID, resource.Zone, resource.Name).Do()
+	if err != nil {
+		return err
+	}
+	labels := make(map[string]string)
+	for key, value := range instance.Labels {
+		labels[key] = value
+	}
+	for key, value := range quarantineLabels {
+		labels[key] = value
+	}
+	setLabelsRequest := &compute.InstancesSetLabelsRequest{Labels: labels, LabelFingerprint: instance.LabelFingerprint}
+	if _, err := client.Client.Instances.SetLabels(projectID, resource.Zone, resource.Name, setLabelsRequest).Do(); err != nil {
+		return err
+	}
+	_, err = client.Client.Instances.Stop(projectID, resource.Zone, resource.Name).Do()
+	return err
+}
+
+// Backup snapshots every disk attached to the given Compute Engine instance, and waits up to
+// snapshotTimeout for each snapshot to be taken. Each snapshot is named after its disk and
+// the current time.
+func (client *GCEClient) Backup(projectID string, resource *resources.Resource, config *reaperconfig.BackupConfig, labels map[string]string) error {
+	instance, err := client.Client.Instances.Get(projectID, resource.Zone, resource.Name).Do()
+	if err != nil {
+		return err
+	}
+	takenAt := time.Now().Unix()
+	for _, disk := range instance.Disks {
+		diskName := disk.Source[strings.LastIndex(disk.Source, "/")+1:]
+		snapshot := &compute.Snapshot{Name: snapshotName(diskName, takenAt), Labels: labels}
+		operation, err := client.Client.Disks.CreateSnapshot(projectID, resource.Zone, diskName, snapshot).Do()
+		if err != nil {
+			return err
+		}
+		if err := client.waitForOperation(projectID, resource.Zone, operation.Name); err != nil {
+			return fmt.Errorf("snapshot of disk %s failed: %s", diskName, err.Error())
+		}
+	}
+	return nil
+}
+
+// waitForOperation polls the given zone operation until it is done or snapshotTimeout has
+// passed. Each poll waits for up to two minutes, as ZoneOperations.Wait returns once the
+// operation is done or that long has passed.
+func (client *GCEClient) waitForOperation(projectID, zone, operationName string) error {
+	deadline := time.Now().Add(snapshotTimeout)
+	for {
+		operation, err := client.Client.ZoneOperations.Wait(projectID, zone, operationName).Do()
+		if err != nil {
+			return err
+		}
+		if operation.Status == "DONE" {
+			if operation.Error != nil && len(operation.Error.Errors) > 0 {
+				return errors.New(operation.Error.Errors[0].Message)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("operation %s did not finish within %s", operationName, snapshotTimeout)
+		}
+	}
+}
+
+// snapshotName returns the name of a snapshot of the given disk taken at the given Unix time,
+// truncating the disk name so that the snapshot name is no longer than a GCE resource name.
+func snapshotName(diskName string, takenAt int64) string {
+	suffix := fmt.Sprintf("-%d", takenAt)
+	if maxDiskNameLength := maxResourceNameLength - len(suffix); len(diskName) > maxDiskNameLength {
+		diskName = strings.TrimRight(diskName[:maxDiskNameLength], "-")
+	}
+	return diskName + suffix
+}
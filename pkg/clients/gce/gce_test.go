@@ -26,6 +26,7 @@ import (
 
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/option"
 )
 
@@ -184,6 +185,176 @@ func TestDeleteResource(t *testing.T) {
 	}
 }
 
+// TestQuarantine tests that quarantining an instance adds the quarantine label to its
+// existing labels and then stops it.
+func TestQuarantine(t *testing.T) {
+	var requests []string
+	var setLabelsRequest compute.InstancesSetLabelsRequest
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		// Endpoints of the form: /{ProjectID}/zones/{ZoneName}/instances/{InstanceName}[/{Action}]
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		if strings.HasSuffix(req.URL.Path, "/setLabels") {
+			json.NewDecoder(req.Body).Decode(&setLabelsRequest)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name": "TestInstance", "labels": map[string]string{"env": "test"}, "labelFingerprint": "fingerprint",
+		})
+	})
+	defer server.Close()
+	testClient := createTestGCEClient(server)
+
+	resource := resources.NewResource("TestInstance", "testZone", timeCreated, reaperconfig.ResourceType_GCE_VM)
+	if err := testClient.Quarantine("testProject", resource, resources.QuarantineLabels("TestUUID", time.Unix(1592400000, 0))); err != nil {
+		t.Fatal(err)
+	}
+	expectedRequests := []string{
+		"GET /testProject/zones/testZone/instances/TestInstance",
+		"POST /testProject/zones/testZone/instances/TestInstance/setLabels",
+		"POST /testProject/zones/testZone/instances/TestInstance/stop",
+	}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("Quarantine sent requests %v; want %v", requests, expectedRequests)
+	}
+	expectedLabels := map[string]string{
+		"env": "test", resources.QuarantineLabel: "1592400000", resources.QuarantinedByLabel: "testuuid",
+	}
+	if !reflect.DeepEqual(setLabelsRequest.Labels, expectedLabels) || setLabelsRequest.LabelFingerprint != "fingerprint" {
+		t.Errorf("Quarantine set labels %v with fingerprint %s; want %v with fingerprint", setLabelsRequest.Labels, setLabelsRequest.LabelFingerprint, expectedLabels)
+	}
+}
+
+// TestBackup tests that backing up an instance snapshots each of its disks with the
+// given labels.
+func TestBackup(t *testing.T) {
+	var snapshots []compute.Snapshot
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		// Endpoints of the form: /{ProjectID}/zones/{ZoneName}/{Collection}/{Name}[/{Action}]
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/instances/TestInstance"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "TestInstance", "disks": []map[string]string{
+				{"source": "https://compute.googleapis.com/compute/v1/projects/testProject/zones/testZone/disks/boot-disk"},
+				{"source": "https://compute.googleapis.com/compute/v1/projects/testProject/zones/testZone/disks/data-disk"},
+			}})
+		case strings.HasSuffix(req.URL.Path, "/createSnapshot"):
+			var snapshot compute.Snapshot
+			json.NewDecoder(req.Body).Decode(&snapshot)
+			snapshots = append(snapshots, snapshot)
+			json.NewEncoder(w).Encode(map[string]string{"name": "operation"})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"name": "operation", "status": "DONE"})
+		}
+	})
+	defer server.Close()
+	testClient := createTestGCEClient(server)
+
+	labels := map[string]string{resources.BackupSourceLabel: "testinstance"}
+	resource := resources.NewResource("TestInstance", "testZone", timeCreated, reaperconfig.ResourceType_GCE_VM)
+	if err := testClient.Backup("testProject", resource, &reaperconfig.BackupConfig{}, labels); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || !strings.HasPrefix(snapshots[0].Name, "boot-disk-") || !strings.HasPrefix(snapshots[1].Name, "data-disk-") {
+		t.Fatalf("Backup took snapshots %v; want one of each disk", snapshots)
+	}
+	for _, snapshot := range snapshots {
+		if !reflect.DeepEqual(snapshot.Labels, labels) {
+			t.Errorf("Snapshot %s labeled %v; want %v", snapshot.Name, snapshot.Labels, labels)
+		}
+	}
+}
+
+// TestBackupWaitsForSnapshot tests that backing up an instance polls each snapshot's
+// operation until it is done, and fails once the snapshot timeout has passed.
+func TestBackupWaitsForSnapshot(t *testing.T) {
+	var waits int
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		// Endpoints of the form: /{ProjectID}/zones/{ZoneName}/{Collection}/{Name}[/{Action}]
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/instances/TestInstance"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "TestInstance", "disks": []map[string]string{
+				{"source": "https://compute.googleapis.com/compute/v1/projects/testProject/zones/testZone/disks/boot-disk"},
+			}})
+		case strings.HasSuffix(req.URL.Path, "/wait"):
+			waits++
+			status := "RUNNING"
+			if waits == 3 {
+				status = "DONE"
+			}
+			json.NewEncoder(w).Encode(map[string]string{"name": "operation", "status": status})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"name": "operation"})
+		}
+	})
+	defer server.Close()
+	testClient := createTestGCEClient(server)
+
+	resource := resources.NewResource("TestInstance", "testZone", timeCreated, reaperconfig.ResourceType_GCE_VM)
+	if err := testClient.Backup("testProject", resource, &reaperconfig.BackupConfig{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if waits != 3 {
+		t.Errorf("Backup waited for the snapshot %d times; want 3", waits)
+	}
+
+	defer func(timeout time.Duration) { snapshotTimeout = timeout }(snapshotTimeout)
+	snapshotTimeout = 0
+	waits = 0
+	if err := testClient.Backup("testProject", resource, &reaperconfig.BackupConfig{}, nil); err == nil {
+		t.Errorf("Backup of a snapshot that never finishes did not fail")
+	}
+}
+
+func TestSnapshotName(t *testing.T) {
+	if name := snapshotName("disk", 1592400000); name != "disk-1592400000" {
+		t.Errorf("Snapshot name = %s; want disk-1592400000", name)
+	}
+	longDiskName := strings.Repeat("a", 52) + "-" + strings.Repeat("b", 10)
+	if name := snapshotName(longDiskName, 1592400000); name != strings.Repeat("a", 52)+"-1592400000" {
+		t.Errorf("Snapshot name of long disk = %s; want it truncated to 63 characters", name)
+	}
+}
+
+// TestSnapshotClient tests listing and deleting snapshots with the snapshot client.
+func TestSnapshotClient(t *testing.T) {
+	var deletedSnapshots []string
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		// Endpoints of the form: /{ProjectID}/global/snapshots[/{SnapshotName}]
+		w.Header().Set("Content-Type", "application/json")
+		if req.Method == "DELETE" {
+			deletedSnapshots = append(deletedSnapshots, strings.Split(req.URL.Path, "/")[4])
+			json.NewEncoder(w).Encode(map[string]string{"name": "operation"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": []map[string]interface{}{
+			{"name": "boot-disk-1592400000", "creationTimestamp": timeCreatedString, "labels": map[string]string{resources.ExpiresLabel: "1592452800"}},
+			{"name": "other-snapshot", "creationTimestamp": timeCreatedString},
+		}})
+	})
+	defer server.Close()
+	testClient := NewGCESnapshotClient()
+	testClient.Auth(testContext, option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL))
+
+	config := &reaperconfig.ResourceConfig{ResourceType: reaperconfig.ResourceType_GCE_SNAPSHOT, NameFilter: "disk"}
+	snapshots, err := testClient.GetResources("testProject", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := resources.NewResource("boot-disk-1592400000", "global", timeCreated, reaperconfig.ResourceType_GCE_SNAPSHOT)
+	expected.Labels = map[string]string{resources.ExpiresLabel: "1592452800"}
+	if !compareResourceLists(snapshots, []*resources.Resource{expected}) {
+		t.Errorf("Snapshot client got %v; want %v", snapshots, expected)
+	}
+
+	if err := testClient.DeleteResource("testProject", expected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deletedSnapshots, []string{"boot-disk-1592400000"}) {
+		t.Errorf("Deleted snapshots %v; want boot-disk-1592400000", deletedSnapshots)
+	}
+}
+
 type GetResourcesResponse struct {
 	Items []Instance
 }
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gce
+
+import (
+	"context"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+// snapshotZone is the zone of Compute Engine snapshots, which are global resources.
+const snapshotZone = "global"
+
+// GCESnapshotClient is a client for Compute Engine disk snapshots, such as the backups
+// taken of instances before they are deleted.
+type GCESnapshotClient struct {
+	Client *compute.Service
+	ctx    context.Context
+}
+
+// NewGCESnapshotClient creates a new Compute Engine snapshot client.
+func NewGCESnapshotClient() *GCESnapshotClient {
+	return &GCESnapshotClient{}
+}
+
+// Auth authenticates the client to access Compute Engine snapshots.
+func (client *GCESnapshotClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	authedClient, err := compute.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.Client = authedClient
+	client.ctx = ctx
+	return nil
+}
+
+// GetResources gets the Compute Engine snapshots that pass the filters defined in the
+// ResourceConfig. Snapshots are global, so the zones in the config are ignored.
+func (client *GCESnapshotClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var snapshots []*resources.Resource
+	err := client.Client.Snapshots.List(projectID).Pages(client.ctx, func(snapshotList *compute.SnapshotList) error {
+		for _, snapshot := range snapshotList.Items {
+			timeCreated, _ := time.Parse(time.RFC3339, snapshot.CreationTimestamp)
+			parsedResource := resources.NewResource(snapshot.Name, snapshotZone, timeCreated, reaperconfig.ResourceType_GCE_SNAPSHOT)
+			parsedResource.Labels = snapshot.Labels
+			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+				snapshots = append(snapshots, parsedResource)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// DeleteResource deletes the specified Compute Engine snapshot.
+func (client *GCESnapshotClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	_, err := client.Client.Snapshots.Delete(projectID, resource.Name).Do()
+	return err
+}
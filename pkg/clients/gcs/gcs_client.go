@@ -16,14 +16,35 @@ package gcs
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
+const (
+	// progressInterval is the number of objects deleted between each progress log
+	// when force deleting a bucket.
+	progressInterval = 1000
+
+	// maxReportedObjects is the maximum number of retained objects named in the
+	// error returned when a bucket cannot be force deleted.
+	maxReportedObjects = 10
+
+	// maxConcurrentDeletes is the maximum number of GCS objects that are deleted in
+	// parallel when deleting a batch of objects.
+	maxConcurrentDeletes = 32
+)
+
 // gcsBaseClient is common between GCS Buckets and GCS Objects.
 type gcsBaseClient struct {
 	client *storage.Client
@@ -44,41 +65,213 @@ func (client *gcsBaseClient) Auth(ctx context.Context, opts ...option.ClientOpti
 // GCSBucketClient is a client for GCS Buckets.
 type GCSBucketClient struct {
 	*gcsBaseClient
+	protection *resources.ProtectionPolicy
 }
 
 // NewGCSBucketClient creates a new GCS Bucket client.
 func NewGCSBucketClient() *GCSBucketClient {
-	return &GCSBucketClient{&gcsBaseClient{}}
+	return &GCSBucketClient{gcsBaseClient: &gcsBaseClient{}}
 }
 
-// GetResources gets the GCS Bucket resources that match the given ResourceConfig.
+// GetResources gets the GCS Bucket resources that match the given ResourceConfig. The
+// location of each bucket is matched against the zones in the config according to its
+// LocationMatch, and buckets are further filtered by storage class and labels.
 func (client *GCSBucketClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
 	var instances []*resources.Resource
 	bucketIterator := client.client.Buckets(client.ctx, projectID)
 	for bucket, done := bucketIterator.Next(); done == nil; bucket, done = bucketIterator.Next() {
-		bucketZone := bucket.Location
-		for _, zone := range config.GetZones() {
-			if strings.Compare(bucketZone, strings.ToUpper(zone)) != 0 {
-				continue
-			}
-			name := bucket.Name
-			timeCreated := bucket.Created
-			parsedResource := resources.NewResource(name, bucketZone, timeCreated, reaperconfig.ResourceType_GCS_BUCKET)
-			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
-				instances = append(instances, parsedResource)
-			}
+		if !matchesAnyLocation(bucket.Location, config.GetZones(), config.GetLocationMatch()) {
+			continue
+		}
+		if !matchesBucketFilters(bucket, config) {
+			continue
+		}
+		parsedResource := resources.NewResource(bucket.Name, bucket.Location, bucket.Created, reaperconfig.ResourceType_GCS_BUCKET)
+		parsedResource.Labels = bucket.Labels
+		parsedResource.ForceDelete = config.GetForceDelete()
+		if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+			instances = append(instances, parsedResource)
 		}
 	}
 	return instances, nil
 }
 
-// DeleteResource deletes the given GCS Bucket.
+// SetProtectionPolicy sets the policy for the objects that force deleting a bucket must not
+// delete.
+func (client *GCSBucketClient) SetProtectionPolicy(policy *resources.ProtectionPolicy) {
+	client.protection = policy
+}
+
+// DeleteResource deletes the given GCS Bucket. If the resource is marked for force
+// deletion, all objects in the bucket, including noncurrent versions, are deleted first.
 func (client *GCSBucketClient) DeleteResource(projectID string, resource *resources.Resource) error {
 	bucketHandle := client.client.Bucket(resource.Name)
+	if resource.ForceDelete {
+		if err := client.deleteAllObjects(bucketHandle, projectID, resource.Name); err != nil {
+			return err
+		}
+	}
 	err := bucketHandle.Delete(client.ctx)
 	return err
 }
 
+// publicMembers are the IAM members that grant public access to a bucket.
+var publicMembers = []string{"allUsers", "allAuthenticatedUsers"}
+
+// Quarantine adds the quarantine labels to the given GCS Bucket and revokes public access
+// to it by removing allUsers and allAuthenticatedUsers from every role in its IAM policy.
+func (client *GCSBucketClient) Quarantine(projectID string, resource *resources.Resource, labels map[string]string) error {
+	bucketHandle := client.client.Bucket(resource.Name)
+	var bucketAttrs storage.BucketAttrsToUpdate
+	for key, value := range labels {
+		bucketAttrs.SetLabel(key, value)
+	}
+	if _, err := bucketHandle.Update(client.ctx, bucketAttrs); err != nil {
+		return err
+	}
+
+	policy, err := bucketHandle.IAM().Policy(client.ctx)
+	if err != nil {
+		return err
+	}
+	revoked := false
+	for _, role := range policy.Roles() {
+		for _, member := range publicMembers {
+			if policy.HasRole(member, role) {
+				policy.Remove(member, role)
+				revoked = true
+			}
+		}
+	}
+	if !revoked {
+		return nil
+	}
+	return bucketHandle.IAM().SetPolicy(client.ctx, policy)
+}
+
+// deleteAllObjects deletes every version of every object in the given bucket. The whole
+// bucket is scanned before anything is deleted, and if any object is protected by the
+// client's protection policy, is under a hold or has not yet met the bucket's retention
+// policy, no object is deleted and the blocking objects are reported in the returned error.
+func (client *GCSBucketClient) deleteAllObjects(bucketHandle *storage.BucketHandle, projectID, bucketName string) error {
+	if err := client.checkObjectsDeletable(bucketHandle, projectID, bucketName); err != nil {
+		return err
+	}
+
+	deleted := 0
+	objectIterator := bucketHandle.Objects(client.ctx, &storage.Query{Versions: true})
+	for {
+		object, err := objectIterator.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// Objects written since the scan are checked again before they are deleted.
+		if _, reason := client.blockingReason(projectID, bucketName, object, time.Now()); len(reason) > 0 {
+			return fmt.Errorf("bucket %s cannot be deleted because object %s#%d cannot be deleted: %s", bucketName, object.Name, object.Generation, reason)
+		}
+		if err := bucketHandle.Object(object.Name).Generation(object.Generation).Delete(client.ctx); err != nil && err != storage.ErrObjectNotExist {
+			return fmt.Errorf("deleting object %s#%d failed: %s", object.Name, object.Generation, err.Error())
+		}
+		deleted++
+		if deleted%progressInterval == 0 {
+			logger.Logf("Force deleting bucket %s: deleted %d objects so far\n", bucketName, deleted)
+		}
+	}
+	return nil
+}
+
+// checkObjectsDeletable scans every version of every object in the given bucket, and
+// returns an error reporting the objects that are protected by the client's protection
+// policy, under a hold or retained, if there are any.
+func (client *GCSBucketClient) checkObjectsDeletable(bucketHandle *storage.BucketHandle, projectID, bucketName string) error {
+	bucketAttrs, err := bucketHandle.Attrs(client.ctx)
+	if err != nil {
+		return err
+	}
+
+	var protectedObjects, retainedObjects []string
+	now := time.Now()
+	objectIterator := bucketHandle.Objects(client.ctx, &storage.Query{Versions: true})
+	for {
+		object, err := objectIterator.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		isProtected, reason := client.blockingReason(projectID, bucketName, object, now)
+		switch {
+		case isProtected:
+			protectedObjects = append(protectedObjects, fmt.Sprintf("%s#%d (%s)", object.Name, object.Generation, reason))
+		case len(reason) > 0:
+			retainedObjects = append(retainedObjects, fmt.Sprintf("%s#%d (%s)", object.Name, object.Generation, reason))
+		}
+	}
+
+	if len(protectedObjects) > 0 {
+		return fmt.Errorf(
+			"bucket %s cannot be deleted because %d objects are protected by policy: %s",
+			bucketName, len(protectedObjects), strings.Join(reportedObjects(protectedObjects), ", "),
+		)
+	}
+	if len(retainedObjects) > 0 {
+		return retainedObjectsError(bucketName, bucketAttrs.RetentionPolicy, retainedObjects)
+	}
+	return nil
+}
+
+// blockingReason returns why the given object in the bucket cannot be deleted, or an empty
+// string if it can be deleted, and whether it is blocked by the client's protection policy
+// rather than by a hold or retention.
+func (client *GCSBucketClient) blockingReason(projectID, bucketName string, object *storage.ObjectAttrs, now time.Time) (bool, string) {
+	objectResource := resources.NewResource(object.Name, bucketName, object.Created, reaperconfig.ResourceType_GCS_OBJECT)
+	objectResource.Labels = object.Metadata
+	if violation := client.protection.Violation(projectID, objectResource); len(violation) > 0 {
+		return true, violation
+	}
+	return false, retentionReason(object, now)
+}
+
+// reportedObjects returns the objects to list in an error, which are at most
+// maxReportedObjects followed by how many more there are.
+func reportedObjects(objects []string) []string {
+	if len(objects) <= maxReportedObjects {
+		return objects
+	}
+	return append(objects[:maxReportedObjects:maxReportedObjects], fmt.Sprintf("and %d more", len(objects)-maxReportedObjects))
+}
+
+// retentionReason returns why the given object cannot be deleted yet, or an empty
+// string if it can be deleted.
+func retentionReason(object *storage.ObjectAttrs, now time.Time) string {
+	switch {
+	case object.EventBasedHold:
+		return "event-based hold"
+	case object.TemporaryHold:
+		return "temporary hold"
+	case object.RetentionExpirationTime.After(now):
+		return fmt.Sprintf("retained until %s", object.RetentionExpirationTime.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// retainedObjectsError returns an error describing the objects that prevented the
+// given bucket from being deleted.
+func retainedObjectsError(bucketName string, policy *storage.RetentionPolicy, retainedObjects []string) error {
+	var policyDescription string
+	if policy != nil {
+		policyDescription = fmt.Sprintf(" (retention period %s, locked: %t)", policy.RetentionPeriod, policy.IsLocked)
+	}
+	return fmt.Errorf(
+		"bucket %s%s cannot be deleted because %d objects are held or retained: %s",
+		bucketName, policyDescription, len(retainedObjects), strings.Join(reportedObjects(retainedObjects), ", "),
+	)
+}
+
 // GCSObjectClient is a client for GCS objects. Note that the Zone
 // for a GCS Object is the GCS Bucket name.
 type GCSObjectClient struct {
@@ -90,28 +283,149 @@ func NewGCSObjectClient() *GCSObjectClient {
 	return &GCSObjectClient{&gcsBaseClient{}}
 }
 
-// GetResources gets the GCS Object resources that match the given ResourceConfig.
+// GetResources gets the GCS Object resources that match the given ResourceConfig. Each zone
+// in the config is either a bucket name, or a bucket name and object prefix separated by a
+// slash, in which case only objects with the prefix are listed. If the config includes
+// noncurrent versions, each noncurrent generation of an object is returned as its own
+// resource named object#generation, so that it is reaped by its own age.
 func (client *GCSObjectClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
 	var instances []*resources.Resource
+	for _, zone := range config.GetZones() {
+		objectsInZone, err := client.getObjectsInZone(projectID, zone, config)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, objectsInZone...)
+	}
+	return instances, nil
+}
 
-	for _, bucket := range config.GetZones() {
-		bucketHandle := client.client.Bucket(bucket)
-		objectIterator := bucketHandle.Objects(client.ctx, nil)
+// getObjectsInZone gets the GCS Objects in a single zone of the ResourceConfig that pass its
+// filters, tracing the listing as its own span. Filters match the object's name, without
+// the generation of noncurrent versions.
+func (client *GCSObjectClient) getObjectsInZone(projectID, zone string, config *reaperconfig.ResourceConfig) (instances []*resources.Resource, err error) {
+	ctx, span := tracing.StartZoneSpan(client.ctx, reaperconfig.ResourceType_GCS_OBJECT, projectID, zone)
+	defer func() { tracing.EndSpan(span, err) }()
 
-		for object, done := objectIterator.Next(); done == nil; object, done = objectIterator.Next() {
-			objectResource := resources.NewResource(object.Name, bucket, object.Created, reaperconfig.ResourceType_GCS_OBJECT)
-			if resources.ShouldAddResourceToWatchlist(objectResource, config.GetNameFilter(), config.GetSkipFilter()) {
-				instances = append(instances, objectResource)
-			}
+	bucket, prefix := splitBucketPrefix(zone)
+	bucketHandle := client.client.Bucket(bucket)
+	query := &storage.Query{Prefix: prefix, Versions: config.GetIncludeNoncurrentVersions()}
+	objectIterator := bucketHandle.Objects(ctx, query)
+
+	for {
+		object, err := objectIterator.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		timeCreated := object.Created
+		if config.GetTtlBasis() == reaperconfig.TTLBasis_LAST_MODIFIED {
+			timeCreated = object.Updated
+		}
+		objectResource := resources.NewResource(object.Name, bucket, timeCreated, reaperconfig.ResourceType_GCS_OBJECT)
+		objectResource.Labels = object.Metadata
+		if !object.Deleted.IsZero() {
+			objectResource.Generation = object.Generation
+		}
+		if resources.ShouldAddResourceToWatchlist(objectResource, config.GetNameFilter(), config.GetSkipFilter()) {
+			instances = append(instances, objectResource)
 		}
 	}
 	return instances, nil
 }
 
-// DeleteResource deletes the given GCS Object.
+// DeleteResource deletes the given GCS Object. If the resource is a noncurrent version of an
+// object, only that generation is deleted.
 func (client *GCSObjectClient) DeleteResource(projectID string, resource *resources.Resource) error {
-	bucketHandle := client.client.Bucket(resource.Zone)
-	objectHandle := bucketHandle.Object(resource.Name)
-	err := objectHandle.Delete(client.ctx)
+	err := client.objectHandle(resource).Delete(client.ctx)
+	return err
+}
+
+// Backup copies the given GCS Object to the archive bucket in the BackupConfig, naming the
+// copy after the object's bucket and name. The labels are set as the copy's custom metadata,
+// along with the original object's metadata.
+func (client *GCSObjectClient) Backup(projectID string, resource *resources.Resource, config *reaperconfig.BackupConfig, labels map[string]string) error {
+	if len(config.GetArchiveBucket()) == 0 {
+		return fmt.Errorf("no archive bucket set for backing up GCS object %s", resource.Name)
+	}
+	metadata := make(map[string]string)
+	for key, value := range resource.Labels {
+		metadata[key] = value
+	}
+	for key, value := range labels {
+		metadata[key] = value
+	}
+	archiveName := fmt.Sprintf("%s/%s", resource.Zone, resource.VersionedName())
+	copier := client.client.Bucket(config.GetArchiveBucket()).Object(archiveName).CopierFrom(client.objectHandle(resource))
+	copier.Metadata = metadata
+	_, err := copier.Run(client.ctx)
 	return err
 }
+
+// objectHandle returns the handle of the given GCS Object. If the resource is a noncurrent
+// version of an object, the handle is for that generation.
+func (client *GCSObjectClient) objectHandle(resource *resources.Resource) *storage.ObjectHandle {
+	bucketHandle := client.client.Bucket(resource.Zone)
+	if resource.Generation != 0 {
+		return bucketHandle.Object(resource.Name).Generation(resource.Generation)
+	}
+	return bucketHandle.Object(resource.Name)
+}
+
+// DeleteResources deletes the given GCS Objects in parallel, with at most
+// maxConcurrentDeletes deletions in flight at once. Progress is logged every
+// progressInterval deleted objects, and the throughput is logged once all
+// deletions have finished.
+func (client *GCSObjectClient) DeleteResources(projectID string, resourcesToDelete []*resources.Resource) []error {
+	errs := make([]error, len(resourcesToDelete))
+	var deleted int64
+	start := time.Now()
+
+	semaphore := make(chan struct{}, maxConcurrentDeletes)
+	var waitGroup sync.WaitGroup
+	for idx, resource := range resourcesToDelete {
+		waitGroup.Add(1)
+		semaphore <- struct{}{}
+		go func(idx int, resource *resources.Resource) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			errs[idx] = client.DeleteResource(projectID, resource)
+			if errs[idx] != nil {
+				return
+			}
+			if numDeleted := atomic.AddInt64(&deleted, 1); numDeleted%progressInterval == 0 {
+				logger.Logf("Deleted %d of %d GCS objects so far\n", numDeleted, len(resourcesToDelete))
+			}
+		}(idx, resource)
+	}
+	waitGroup.Wait()
+
+	elapsed := time.Since(start)
+	logger.Logf(
+		"Deleted %d of %d GCS objects in %s (%.1f objects/s)\n",
+		deleted, len(resourcesToDelete), elapsed.Round(time.Millisecond), objectsPerSecond(deleted, elapsed),
+	)
+	return errs
+}
+
+// objectsPerSecond returns the rate at which the objects were deleted, or 0 if no time
+// elapsed, as can happen on a coarse clock.
+func objectsPerSecond(deleted int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(deleted) / elapsed.Seconds()
+}
+
+// splitBucketPrefix splits a zone of the form bucket/prefix into the bucket name and
+// object prefix. The prefix is empty if the zone is only a bucket name.
+func splitBucketPrefix(zone string) (string, string) {
+	splitZone := strings.SplitN(zone, "/", 2)
+	if len(splitZone) == 1 {
+		return splitZone[0], ""
+	}
+	return splitZone[0], splitZone[1]
+}
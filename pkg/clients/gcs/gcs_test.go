@@ -16,12 +16,16 @@ package gcs
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
@@ -37,6 +41,10 @@ var (
 	deletedResource *utils.TestInstance
 )
 
+func init() {
+	logger.CreateLogger()
+}
+
 func TestAuth(t *testing.T) {
 	bucketClient := NewGCSBucketClient()
 	err := bucketClient.Auth(context.TODO())
@@ -113,3 +121,538 @@ func setupTestData() {
 		},
 	}
 }
+
+// A mock object to represent a version of a GCS object. Only the fields used by
+// the client are included.
+type TestObject struct {
+	Name                    string            `json:"name"`
+	Generation              int64             `json:"generation,string"`
+	EventBasedHold          bool              `json:"eventBasedHold,omitempty"`
+	TemporaryHold           bool              `json:"temporaryHold,omitempty"`
+	RetentionExpirationTime string            `json:"retentionExpirationTime,omitempty"`
+	TimeCreated             string            `json:"timeCreated,omitempty"`
+	Updated                 string            `json:"updated,omitempty"`
+	TimeDeleted             string            `json:"timeDeleted,omitempty"`
+	Metadata                map[string]string `json:"metadata,omitempty"`
+}
+
+var (
+	// Map of bucket -> object versions in bucket.
+	testObjects    map[string][]TestObject
+	deletedObjects []string
+	deletedBuckets []string
+
+	testTimeRFC3339 = "2020-06-17T10:00:00-04:00"
+)
+
+type ForceDeleteBucketTestCase struct {
+	Name            string
+	ForceDelete     bool
+	ExpectedObjects []string
+	ExpectedBuckets []string
+	ExpectError     bool
+}
+
+var forceDeleteBucketTestCases = []ForceDeleteBucketTestCase{
+	ForceDeleteBucketTestCase{"versioned-bucket", true, []string{"object-1#1", "object-1#2", "object-2#1"}, []string{"versioned-bucket"}, false},
+	ForceDeleteBucketTestCase{"versioned-bucket", false, nil, []string{"versioned-bucket"}, false},
+	ForceDeleteBucketTestCase{"held-bucket", true, nil, nil, true},
+	ForceDeleteBucketTestCase{"empty-bucket", true, nil, []string{"empty-bucket"}, false},
+}
+
+func TestForceDeleteBucketResource(t *testing.T) {
+	server := utils.CreateServer(forceDeleteBucketHandler)
+	defer server.Close()
+
+	client := NewGCSBucketClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	for _, testCase := range forceDeleteBucketTestCases {
+		setupTestObjects()
+		deletedObjects, deletedBuckets = nil, nil
+
+		resource := resources.NewResource(testCase.Name, "US", time.Now(), reaperconfig.ResourceType_GCS_BUCKET)
+		resource.ForceDelete = testCase.ForceDelete
+		err := client.DeleteResource("SampleProject1", resource)
+		if testCase.ExpectError && err == nil {
+			t.Errorf("Expected force delete of %s to fail", testCase.Name)
+
+		}
+		if !testCase.ExpectError && err != nil {
+			t.Errorf("GCS force delete failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(deletedObjects, testCase.ExpectedObjects) {
+			t.Errorf("Deleted objects = %v; want %v", deletedObjects, testCase.ExpectedObjects)
+		}
+		if !reflect.DeepEqual(deletedBuckets, testCase.ExpectedBuckets) {
+			t.Errorf("Deleted buckets = %v; want %v", deletedBuckets, testCase.ExpectedBuckets)
+		}
+	}
+}
+
+func TestForceDeleteBucketWithProtectedObjects(t *testing.T) {
+	server := utils.CreateServer(forceDeleteBucketHandler)
+	defer server.Close()
+
+	client := NewGCSBucketClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+	policy, _ := resources.NewProtectionPolicy(nil, map[string]string{"reaper-protect": ""}, []string{"^object-3$"})
+	client.SetProtectionPolicy(policy)
+
+	setupTestObjects()
+	deletedObjects, deletedBuckets = nil, nil
+	resource := resources.NewResource("protected-bucket", "US", time.Now(), reaperconfig.ResourceType_GCS_BUCKET)
+	resource.ForceDelete = true
+	err := client.DeleteResource("SampleProject1", resource)
+	if err == nil || !strings.Contains(err.Error(), "2 objects are protected by policy") {
+		t.Errorf("Force delete of a bucket with protected objects returned %v; want an error naming 2 protected objects", err)
+	}
+	if len(deletedObjects) != 0 {
+		t.Errorf("Deleted objects = %v; want none", deletedObjects)
+	}
+	if len(deletedBuckets) != 0 {
+		t.Errorf("Deleted buckets = %v; want none", deletedBuckets)
+	}
+}
+
+type GetObjectResourcesTestCase struct {
+	Zone                      string
+	IncludeNoncurrentVersions bool
+	TTLBasis                  reaperconfig.TTLBasis
+	Expected                  []*resources.Resource
+}
+
+var (
+	testCreated = "2020-06-17T10:00:00Z"
+	testUpdated = "2020-06-18T10:00:00Z"
+	testDeleted = "2020-06-19T10:00:00Z"
+
+	testCreatedTime, _ = time.Parse(time.RFC3339, testCreated)
+	testUpdatedTime, _ = time.Parse(time.RFC3339, testUpdated)
+)
+
+var getObjectResourcesTestCases = []GetObjectResourcesTestCase{
+	GetObjectResourcesTestCase{"listed-bucket", false, reaperconfig.TTLBasis_CREATION_TIME, []*resources.Resource{
+		resources.NewResource("logs/object-1", "listed-bucket", testCreatedTime, reaperconfig.ResourceType_GCS_OBJECT),
+		resources.NewResource("tmp/object-2", "listed-bucket", testCreatedTime, reaperconfig.ResourceType_GCS_OBJECT),
+	}},
+	GetObjectResourcesTestCase{"listed-bucket/tmp/", false, reaperconfig.TTLBasis_CREATION_TIME, []*resources.Resource{
+		resources.NewResource("tmp/object-2", "listed-bucket", testCreatedTime, reaperconfig.ResourceType_GCS_OBJECT),
+	}},
+	GetObjectResourcesTestCase{"listed-bucket/tmp/", false, reaperconfig.TTLBasis_LAST_MODIFIED, []*resources.Resource{
+		resources.NewResource("tmp/object-2", "listed-bucket", testUpdatedTime, reaperconfig.ResourceType_GCS_OBJECT),
+	}},
+	GetObjectResourcesTestCase{"listed-bucket/tmp/", true, reaperconfig.TTLBasis_CREATION_TIME, []*resources.Resource{
+		&resources.Resource{Name: "tmp/object-2", Zone: "listed-bucket", TimeCreated: testCreatedTime, Type: reaperconfig.ResourceType_GCS_OBJECT, Generation: 1},
+		resources.NewResource("tmp/object-2", "listed-bucket", testCreatedTime, reaperconfig.ResourceType_GCS_OBJECT),
+	}},
+}
+
+func TestGetObjectResources(t *testing.T) {
+	server := utils.CreateServer(getObjectResourcesHandler)
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	for _, testCase := range getObjectResourcesTestCases {
+		config := &reaperconfig.ResourceConfig{
+			ResourceType:              reaperconfig.ResourceType_GCS_OBJECT,
+			NameFilter:                "object",
+			Zones:                     []string{testCase.Zone},
+			IncludeNoncurrentVersions: testCase.IncludeNoncurrentVersions,
+			TtlBasis:                  testCase.TTLBasis,
+		}
+		result, err := client.GetResources("SampleProject1", config)
+		if err != nil {
+			t.Errorf("GCS Object get resources failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(result, testCase.Expected) {
+			t.Errorf("Get resources for %s = %v; want %v", testCase.Zone, result, testCase.Expected)
+		}
+	}
+}
+
+func TestGetObjectResourcesMatchesObjectName(t *testing.T) {
+	server := utils.CreateServer(getObjectResourcesHandler)
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	config := &reaperconfig.ResourceConfig{
+		ResourceType:              reaperconfig.ResourceType_GCS_OBJECT,
+		NameFilter:                "^tmp/object-2$",
+		Zones:                     []string{"listed-bucket"},
+		IncludeNoncurrentVersions: true,
+	}
+	result, err := client.GetResources("SampleProject1", config)
+	if err != nil {
+		t.Errorf("GCS Object get resources failed with the following error: %s", err.Error())
+	}
+	expected := []*resources.Resource{
+		&resources.Resource{Name: "tmp/object-2", Zone: "listed-bucket", TimeCreated: testCreatedTime, Type: reaperconfig.ResourceType_GCS_OBJECT, Generation: 1},
+		resources.NewResource("tmp/object-2", "listed-bucket", testCreatedTime, reaperconfig.ResourceType_GCS_OBJECT),
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Get resources matching %s = %v; want %v", config.NameFilter, result, expected)
+	}
+}
+
+func TestGetObjectResourcesListingError(t *testing.T) {
+	server := utils.CreateServer(getObjectResourcesHandler)
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	config := &reaperconfig.ResourceConfig{
+		ResourceType: reaperconfig.ResourceType_GCS_OBJECT,
+		NameFilter:   "object",
+		Zones:        []string{"listed-bucket", "forbidden-bucket"},
+	}
+	result, err := client.GetResources("SampleProject1", config)
+	if err == nil {
+		t.Errorf("Get resources with an unlistable bucket = %v; want an error", result)
+	}
+}
+
+func TestDeleteNoncurrentObjectResource(t *testing.T) {
+	server := utils.CreateServer(forceDeleteBucketHandler)
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	deletedObjects = nil
+	resource := resources.NewResource("object-1", "versioned-bucket", time.Now(), reaperconfig.ResourceType_GCS_OBJECT)
+	resource.Generation = 1
+	err := client.DeleteResource("SampleProject1", resource)
+	if err != nil {
+		t.Errorf("GCS Object delete failed with the following error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deletedObjects, []string{"object-1#1"}) {
+		t.Errorf("Deleted objects = %v; want [object-1#1]", deletedObjects)
+	}
+}
+
+func TestDeleteObjectResources(t *testing.T) {
+	server := utils.CreateServer(deleteObjectResourcesHandler)
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	var resourcesToDelete []*resources.Resource
+	for i := 0; i < 3*maxConcurrentDeletes; i++ {
+		name := fmt.Sprintf("object-%d", i)
+		if i%10 == 0 {
+			name = fmt.Sprintf("missing-object-%d", i)
+		}
+		resourcesToDelete = append(resourcesToDelete, resources.NewResource(name, "batch-bucket", time.Now(), reaperconfig.ResourceType_GCS_OBJECT))
+	}
+
+	batchDeletedObjects = make(map[string]bool)
+	errs := client.DeleteResources("SampleProject1", resourcesToDelete)
+	for idx, resource := range resourcesToDelete {
+		isMissing := strings.HasPrefix(resource.Name, "missing")
+		if isMissing && errs[idx] == nil {
+			t.Errorf("Expected deleting %s to fail", resource.Name)
+		}
+		if !isMissing && errs[idx] != nil {
+			t.Errorf("Deleting %s failed with the following error: %s", resource.Name, errs[idx].Error())
+		}
+		if batchDeletedObjects[resource.Name] == isMissing {
+			t.Errorf("Object %s deleted = %t; want %t", resource.Name, !isMissing, isMissing)
+		}
+	}
+}
+
+func TestObjectsPerSecond(t *testing.T) {
+	if rate := objectsPerSecond(10, 0); rate != 0 {
+		t.Errorf("Rate of deletions in no time = %v; want 0", rate)
+	}
+	if rate := objectsPerSecond(10, 2*time.Second); rate != 5 {
+		t.Errorf("Rate of 10 deletions in 2s = %v; want 5", rate)
+	}
+}
+
+type MatchesLocationTestCase struct {
+	BucketLocation string
+	Zone           string
+	LocationMatch  reaperconfig.LocationMatch
+	Expected       bool
+}
+
+var matchesLocationTestCases = []MatchesLocationTestCase{
+	MatchesLocationTestCase{"US-EAST1", "us-east1", reaperconfig.LocationMatch_EXACT, true},
+	MatchesLocationTestCase{"US-EAST1", "us-east1-b", reaperconfig.LocationMatch_EXACT, false},
+	MatchesLocationTestCase{"US-EAST1", "us-east1-b", reaperconfig.LocationMatch_REGION, true},
+	MatchesLocationTestCase{"NAM4", "us-east1-b", reaperconfig.LocationMatch_REGION, true},
+	MatchesLocationTestCase{"NAM4", "us-west1-a", reaperconfig.LocationMatch_REGION, false},
+	MatchesLocationTestCase{"US", "us-east1-b", reaperconfig.LocationMatch_REGION, false},
+	MatchesLocationTestCase{"US", "us-east1-b", reaperconfig.LocationMatch_MULTI_REGION, true},
+	MatchesLocationTestCase{"US-WEST1", "us", reaperconfig.LocationMatch_MULTI_REGION, true},
+	MatchesLocationTestCase{"NAM4", "us", reaperconfig.LocationMatch_MULTI_REGION, true},
+	MatchesLocationTestCase{"EUR4", "us", reaperconfig.LocationMatch_MULTI_REGION, false},
+	MatchesLocationTestCase{"EU", "europe-west4-a", reaperconfig.LocationMatch_MULTI_REGION, true},
+	MatchesLocationTestCase{"SOUTHAMERICA-EAST1", "us", reaperconfig.LocationMatch_MULTI_REGION, false},
+	MatchesLocationTestCase{"SOUTHAMERICA-EAST1", "us", reaperconfig.LocationMatch_ANY, true},
+}
+
+func TestMatchesAnyLocation(t *testing.T) {
+	for _, testCase := range matchesLocationTestCases {
+		result := matchesAnyLocation(testCase.BucketLocation, []string{testCase.Zone}, testCase.LocationMatch)
+		if result != testCase.Expected {
+			t.Errorf("Location %s matching zone %s with %s = %t; want %t", testCase.BucketLocation, testCase.Zone, testCase.LocationMatch, result, testCase.Expected)
+		}
+	}
+}
+
+type GetBucketResourcesTestCase struct {
+	StorageClasses []string
+	LabelFilter    map[string]string
+	Expected       []string
+}
+
+var getBucketResourcesTestCases = []GetBucketResourcesTestCase{
+	GetBucketResourcesTestCase{nil, nil, []string{"test-bucket-1", "test-bucket-2", "test-bucket-3"}},
+	GetBucketResourcesTestCase{[]string{"nearline"}, nil, []string{"test-bucket-2"}},
+	GetBucketResourcesTestCase{nil, map[string]string{"env": ""}, []string{"test-bucket-1", "test-bucket-2"}},
+	GetBucketResourcesTestCase{nil, map[string]string{"env": "test"}, []string{"test-bucket-1"}},
+	GetBucketResourcesTestCase{[]string{"STANDARD"}, map[string]string{"env": "prod"}, nil},
+}
+
+func TestGetBucketResources(t *testing.T) {
+	server := utils.CreateServer(getBucketResourcesHandler)
+	defer server.Close()
+
+	client := NewGCSBucketClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	for _, testCase := range getBucketResourcesTestCases {
+		config := &reaperconfig.ResourceConfig{
+			ResourceType:   reaperconfig.ResourceType_GCS_BUCKET,
+			NameFilter:     "test",
+			Zones:          []string{"us-east1-b"},
+			LocationMatch:  reaperconfig.LocationMatch_REGION,
+			StorageClasses: testCase.StorageClasses,
+			LabelFilter:    testCase.LabelFilter,
+		}
+		result, err := client.GetResources("SampleProject1", config)
+		if err != nil {
+			t.Errorf("GCS Bucket get resources failed with the following error: %s", err.Error())
+		}
+		var resultNames []string
+		for _, resource := range result {
+			resultNames = append(resultNames, resource.Name)
+		}
+		if !reflect.DeepEqual(resultNames, testCase.Expected) {
+			t.Errorf("Get bucket resources = %v; want %v", resultNames, testCase.Expected)
+		}
+	}
+}
+
+func TestRetainedObjectsError(t *testing.T) {
+	var retainedObjects []string
+	for i := 0; i < maxReportedObjects+5; i++ {
+		retainedObjects = append(retainedObjects, "object")
+	}
+	err := retainedObjectsError("bucket", nil, retainedObjects)
+	if !strings.HasSuffix(err.Error(), "object, and 5 more") {
+		t.Errorf("Retained objects error not truncated: %s", err.Error())
+	}
+}
+
+var (
+	quarantineLabels   map[string]string
+	quarantineBindings []map[string]interface{}
+)
+
+func TestQuarantineBucketResource(t *testing.T) {
+	server := utils.CreateServer(quarantineBucketHandler)
+	defer server.Close()
+
+	client := NewGCSBucketClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	quarantineLabels, quarantineBindings = nil, nil
+	quarantinedAt := time.Unix(1592400000, 0)
+	resource := resources.NewResource("public-bucket", "US", time.Now(), reaperconfig.ResourceType_GCS_BUCKET)
+	if err := client.Quarantine("testProject", resource, resources.QuarantineLabels("TestUUID", quarantinedAt)); err != nil {
+		t.Fatalf("GCS Quarantine failed with the following error: %s", err.Error())
+	}
+	if quarantineLabels[resources.QuarantineLabel] != "1592400000" || quarantineLabels[resources.QuarantinedByLabel] != "testuuid" {
+		t.Errorf("Bucket labels = %v; want %s and %s labels", quarantineLabels, resources.QuarantineLabel, resources.QuarantinedByLabel)
+	}
+	expectedBindings := []map[string]interface{}{
+		map[string]interface{}{"role": "roles/storage.admin", "members": []interface{}{"user:owner@example.com"}},
+	}
+	if !reflect.DeepEqual(quarantineBindings, expectedBindings) {
+		t.Errorf("Bucket IAM bindings = %v; want %v", quarantineBindings, expectedBindings)
+	}
+}
+
+// Mock server's http handler for quarantining a GCS bucket whose objects are public.
+func quarantineBucketHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoints of the form: /b/{Bucket}[/iam]
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+	switch {
+	case len(splitEndpoint) == 3:
+		var bucket struct{ Labels map[string]string }
+		json.NewDecoder(req.Body).Decode(&bucket)
+		quarantineLabels = bucket.Labels
+		utils.SendResponse(w, map[string]interface{}{"name": splitEndpoint[2], "labels": bucket.Labels})
+	case req.Method == "PUT":
+		var policy struct{ Bindings []map[string]interface{} }
+		json.NewDecoder(req.Body).Decode(&policy)
+		quarantineBindings = policy.Bindings
+		utils.SendResponse(w, policy)
+	default:
+		utils.SendResponse(w, map[string]interface{}{"bindings": []map[string]interface{}{
+			map[string]interface{}{"role": "roles/storage.objectViewer", "members": []string{"allUsers"}},
+			map[string]interface{}{"role": "roles/storage.admin", "members": []string{"user:owner@example.com", "allAuthenticatedUsers"}},
+		}})
+	}
+}
+
+func TestBackupObjectResource(t *testing.T) {
+	var rewritePath, sourceGeneration string
+	var metadata map[string]string
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		// Endpoint of the form: /b/{Bucket}/o/{Object}/rewriteTo/b/{ArchiveBucket}/o/{ArchiveObject}
+		rewritePath = req.URL.EscapedPath()
+		sourceGeneration = req.URL.Query().Get("sourceGeneration")
+		var object struct{ Metadata map[string]string }
+		json.NewDecoder(req.Body).Decode(&object)
+		metadata = object.Metadata
+		utils.SendResponse(w, map[string]interface{}{"done": true, "resource": map[string]string{"name": "copy"}})
+	})
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	resource := resources.NewResource("object-1", "test-bucket", time.Now(), reaperconfig.ResourceType_GCS_OBJECT)
+	resource.Generation = 5
+	resource.Labels = map[string]string{"owner": "test"}
+	labels := map[string]string{resources.BackupSourceLabel: "object-1-5"}
+	config := &reaperconfig.BackupConfig{ArchiveBucket: "archive-bucket"}
+	if err := client.Backup("testProject", resource, config, labels); err != nil {
+		t.Fatalf("GCS object backup failed with the following error: %s", err.Error())
+	}
+	if rewritePath != "/b/test-bucket/o/object-1/rewriteTo/b/archive-bucket/o/test-bucket%2Fobject-1%235" || sourceGeneration != "5" {
+		t.Errorf("Backup copied %s at generation %s; want object-1 at generation 5 copied to the archive bucket", rewritePath, sourceGeneration)
+	}
+	expectedMetadata := map[string]string{"owner": "test", resources.BackupSourceLabel: "object-1-5"}
+	if !reflect.DeepEqual(metadata, expectedMetadata) {
+		t.Errorf("Backup metadata = %v; want %v", metadata, expectedMetadata)
+	}
+
+	if err := client.Backup("testProject", resource, &reaperconfig.BackupConfig{}, labels); err == nil {
+		t.Errorf("GCS object backup without an archive bucket did not fail")
+	}
+}
+
+// Mock server's http handler for force deleting GCS buckets.
+func forceDeleteBucketHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoints of the form: /b/{Bucket}[/o[/{Object}]]
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+	bucketName := splitEndpoint[2]
+
+	switch {
+	case len(splitEndpoint) == 3 && req.Method == "DELETE":
+		deletedBuckets = append(deletedBuckets, bucketName)
+		w.WriteHeader(http.StatusNoContent)
+	case len(splitEndpoint) == 3:
+		bucket := map[string]interface{}{"name": bucketName}
+		if bucketName == "held-bucket" {
+			bucket["retentionPolicy"] = map[string]string{"retentionPeriod": "3600", "effectiveTime": testTimeRFC3339}
+		}
+		utils.SendResponse(w, bucket)
+	case len(splitEndpoint) == 4:
+		utils.SendResponse(w, map[string][]TestObject{"items": testObjects[bucketName]})
+	default:
+		deletedObjects = append(deletedObjects, splitEndpoint[4]+"#"+req.URL.Query().Get("generation"))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Mock server's http handler for listing GCS objects, which honours the prefix and
+// versions query parameters and refuses to list forbidden-bucket.
+func getObjectResourcesHandler(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, "/b/forbidden-bucket/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	objects := []TestObject{
+		TestObject{Name: "logs/object-1", Generation: 1, TimeCreated: testCreated, Updated: testUpdated},
+		TestObject{Name: "tmp/object-2", Generation: 1, TimeCreated: testCreated, Updated: testUpdated, TimeDeleted: testDeleted},
+		TestObject{Name: "tmp/object-2", Generation: 2, TimeCreated: testCreated, Updated: testUpdated},
+	}
+	query := req.URL.Query()
+	var listedObjects []TestObject
+	for _, object := range objects {
+		if !strings.HasPrefix(object.Name, query.Get("prefix")) {
+			continue
+		}
+		if object.TimeDeleted != "" && query.Get("versions") != "true" {
+			continue
+		}
+		listedObjects = append(listedObjects, object)
+	}
+	utils.SendResponse(w, map[string][]TestObject{"items": listedObjects})
+}
+
+// Mock server's http handler for listing GCS buckets.
+func getBucketResourcesHandler(w http.ResponseWriter, req *http.Request) {
+	buckets := []map[string]interface{}{
+		map[string]interface{}{"name": "test-bucket-1", "location": "US-EAST1", "storageClass": "STANDARD", "labels": map[string]string{"env": "test"}},
+		map[string]interface{}{"name": "test-bucket-2", "location": "NAM4", "storageClass": "NEARLINE", "labels": map[string]string{"env": "prod"}},
+		map[string]interface{}{"name": "test-bucket-3", "location": "US-EAST1", "storageClass": "STANDARD"},
+		map[string]interface{}{"name": "test-bucket-4", "location": "US-WEST1", "storageClass": "STANDARD"},
+	}
+	utils.SendResponse(w, map[string]interface{}{"items": buckets})
+}
+
+var (
+	batchDeletedObjects map[string]bool
+	batchDeleteMux      sync.Mutex
+)
+
+// Mock server's http handler for deleting batches of GCS objects, which fails for objects
+// whose name starts with missing.
+func deleteObjectResourcesHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoint of the form: /b/{Bucket}/o/{Object}
+	objectName := strings.Split(req.URL.Path, "/")[4]
+	if strings.HasPrefix(objectName, "missing") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	batchDeleteMux.Lock()
+	batchDeletedObjects[objectName] = true
+	batchDeleteMux.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setupTestObjects() {
+	retainedUntil := time.Now().Add(time.Hour).Format(time.RFC3339)
+	testObjects = map[string][]TestObject{
+		"versioned-bucket": []TestObject{
+			TestObject{Name: "object-1", Generation: 1},
+			TestObject{Name: "object-1", Generation: 2},
+			TestObject{Name: "object-2", Generation: 1},
+		},
+		"held-bucket": []TestObject{
+			TestObject{Name: "object-1", Generation: 1, EventBasedHold: true},
+			TestObject{Name: "object-2", Generation: 1, TemporaryHold: true},
+			TestObject{Name: "object-3", Generation: 1},
+			TestObject{Name: "object-4", Generation: 1, RetentionExpirationTime: retainedUntil},
+		},
+		"protected-bucket": []TestObject{
+			TestObject{Name: "object-1", Generation: 1, Metadata: map[string]string{"reaper-protect": "true"}},
+			TestObject{Name: "object-2", Generation: 1},
+			TestObject{Name: "object-3", Generation: 1},
+		},
+	}
+}
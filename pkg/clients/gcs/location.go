@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// zonePattern matches a GCP zone, such as US-EAST1-B, capturing its region.
+var zonePattern = regexp.MustCompile(`^([A-Z]+-[A-Z]+[0-9]+)-[A-Z]$`)
+
+// dualRegions maps each predefined GCS dual-region to the regions it spans.
+var dualRegions = map[string][]string{
+	"ASIA1": []string{"ASIA-NORTHEAST1", "ASIA-NORTHEAST2"},
+	"EUR4":  []string{"EUROPE-NORTH1", "EUROPE-WEST4"},
+	"NAM4":  []string{"US-CENTRAL1", "US-EAST1"},
+}
+
+// multiRegionPrefixes maps the prefix of a region to the GCS multi-region that
+// contains it.
+var multiRegionPrefixes = map[string]string{
+	"ASIA-":   "ASIA",
+	"EUROPE-": "EU",
+	"US-":     "US",
+}
+
+// matchesAnyLocation returns whether the location of the bucket matches any of
+// the zones according to the given LocationMatch.
+func matchesAnyLocation(bucketLocation string, zones []string, locationMatch reaperconfig.LocationMatch) bool {
+	if locationMatch == reaperconfig.LocationMatch_ANY {
+		return true
+	}
+	for _, zone := range zones {
+		if matchesLocation(strings.ToUpper(bucketLocation), strings.ToUpper(zone), locationMatch) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesLocation returns whether a bucket location matches a zone. Both are
+// expected to be upper case.
+func matchesLocation(bucketLocation, zone string, locationMatch reaperconfig.LocationMatch) bool {
+	if bucketLocation == zone {
+		return true
+	}
+	switch locationMatch {
+	case reaperconfig.LocationMatch_REGION:
+		region := regionOf(zone)
+		if bucketLocation == region {
+			return true
+		}
+		for _, dualRegion := range dualRegions[bucketLocation] {
+			if dualRegion == region {
+				return true
+			}
+		}
+	case reaperconfig.LocationMatch_MULTI_REGION:
+		multiRegion := multiRegionOf(zone)
+		return len(multiRegion) > 0 && multiRegion == multiRegionOf(bucketLocation)
+	}
+	return false
+}
+
+// regionOf returns the region of a zone, or the location itself if it is not a zone.
+func regionOf(location string) string {
+	if match := zonePattern.FindStringSubmatch(location); match != nil {
+		return match[1]
+	}
+	return location
+}
+
+// multiRegionOf returns the multi-region that contains a location, or an empty
+// string if the location is not in a known multi-region.
+func multiRegionOf(location string) string {
+	for _, multiRegion := range multiRegionPrefixes {
+		if location == multiRegion {
+			return multiRegion
+		}
+	}
+	if regions, isDualRegion := dualRegions[location]; isDualRegion {
+		location = regions[0]
+	}
+	for prefix, multiRegion := range multiRegionPrefixes {
+		if strings.HasPrefix(location, prefix) {
+			return multiRegion
+		}
+	}
+	return ""
+}
+
+// matchesBucketFilters returns whether the bucket has one of the storage classes and
+// all of the labels in the config. An empty label value in the config matches any
+// value of that label.
+func matchesBucketFilters(bucket *storage.BucketAttrs, config *reaperconfig.ResourceConfig) bool {
+	if storageClasses := config.GetStorageClasses(); len(storageClasses) > 0 {
+		matchesStorageClass := false
+		for _, storageClass := range storageClasses {
+			if strings.EqualFold(storageClass, bucket.StorageClass) {
+				matchesStorageClass = true
+				break
+			}
+		}
+		if !matchesStorageClass {
+			return false
+		}
+	}
+	for key, value := range config.GetLabelFilter() {
+		bucketValue, hasLabel := bucket.Labels[key]
+		if !hasLabel || (len(value) > 0 && value != bucketValue) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	container "google.golang.org/api/container/v1"
+	"google.golang.org/api/option"
+)
+
+// operationPollInterval is how long to wait between checks on the status of a
+// long-running cluster operation.
+var operationPollInterval = 10 * time.Second
+
+// GKEClient is a client for GKE clusters. Note that the Zone for a GKE cluster
+// is its location, which can be either a zone or a region.
+type GKEClient struct {
+	Client *container.Service
+	ctx    context.Context
+}
+
+// NewGKEClient creates a new GKE client.
+func NewGKEClient() *GKEClient {
+	return &GKEClient{}
+}
+
+// Auth authenticates the client to access GKE resources. See
+// https://pkg.go.dev/google.golang.org/api/option?tab=doc for more
+// information about passing options.
+func (client *GKEClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	authedClient, err := container.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.Client = authedClient
+	client.ctx = ctx
+	return nil
+}
+
+// GetResources gets the GKE clusters that pass the filters defined in the ResourceConfig.
+func (client *GKEClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var clusters []*resources.Resource
+	for _, location := range config.GetZones() {
+		clustersInLocation, err := client.getClustersInLocation(projectID, location, config)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, clustersInLocation...)
+	}
+	return clusters, nil
+}
+
+// getClustersInLocation gets the GKE clusters in a single location that pass the filters
+// defined in the ResourceConfig, tracing the listing as its own span.
+func (client *GKEClient) getClustersInLocation(projectID, location string, config *reaperconfig.ResourceConfig) (clusters []*resources.Resource, err error) {
+	ctx, span := tracing.StartZoneSpan(client.ctx, reaperconfig.ResourceType_GKE_CLUSTER, projectID, location)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	listClustersCall := client.Client.Projects.Locations.Clusters.List(locationPath(projectID, location))
+	clustersInLocation, err := listClustersCall.Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	for _, cluster := range clustersInLocation.Clusters {
+		// An unparsable timestamp leaves the creation time unset, in which case the reaper
+		// uses the time it first saw the cluster.
+		timeCreated, _ := time.Parse(time.RFC3339, cluster.CreateTime)
+		parsedResource := resources.NewResource(cluster.Name, cluster.Location, timeCreated, reaperconfig.ResourceType_GKE_CLUSTER)
+		parsedResource.Labels = cluster.ResourceLabels
+		if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+			clusters = append(clusters, parsedResource)
+		}
+	}
+	return clusters, nil
+}
+
+// DeleteResource deletes the given GKE cluster, and waits for the delete operation
+// to complete.
+func (client *GKEClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	clusterPath := fmt.Sprintf("%s/clusters/%s", locationPath(projectID, resource.Zone), resource.Name)
+	deleteClusterCall := client.Client.Projects.Locations.Clusters.Delete(clusterPath)
+	operation, err := deleteClusterCall.Context(client.ctx).Do()
+	if err != nil {
+		return err
+	}
+	return client.waitForOperation(projectID, resource.Zone, operation)
+}
+
+// waitForOperation polls the given operation until it is done, and returns an error if
+// the operation failed.
+func (client *GKEClient) waitForOperation(projectID, location string, operation *container.Operation) error {
+	operationPath := fmt.Sprintf("%s/operations/%s", locationPath(projectID, location), operation.Name)
+	for operation.Status != "DONE" {
+		select {
+		case <-client.ctx.Done():
+			return client.ctx.Err()
+		case <-time.After(operationPollInterval):
+		}
+
+		var err error
+		operation, err = client.Client.Projects.Locations.Operations.Get(operationPath).Context(client.ctx).Do()
+		if err != nil {
+			return err
+		}
+	}
+	if len(operation.StatusMessage) > 0 {
+		return fmt.Errorf("operation %s failed: %s", operation.Name, operation.StatusMessage)
+	}
+	return nil
+}
+
+// locationPath returns the resource path of a location in a project.
+func locationPath(projectID, location string) string {
+	return fmt.Sprintf("projects/%s/locations/%s", projectID, location)
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// A mock object to represent a GKE cluster. Only the fields used by
+// the client are included.
+type Cluster struct {
+	Name       string `json:"name"`
+	Location   string `json:"location"`
+	CreateTime string `json:"createTime"`
+}
+
+// A mock object to represent a GKE long-running operation.
+type Operation struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	StatusMessage string `json:"statusMessage,omitempty"`
+}
+
+var (
+	timeCreatedString = "2019-10-12T07:20:50.52Z"
+	timeCreated, _    = time.Parse(time.RFC3339, timeCreatedString)
+
+	testContext = context.Background()
+
+	// Map of project -> Locations in project -> Clusters in location.
+	testClusters map[string]map[string][]Cluster
+
+	// Map of operation name -> number of polls before the operation is done.
+	pendingOperations map[string]int
+	failedOperation   string
+	deletedClusters   []string
+)
+
+func init() {
+	operationPollInterval = time.Millisecond
+}
+
+func TestAuth(t *testing.T) {
+	client := NewGKEClient()
+	if err := client.Auth(testContext); err != nil {
+		t.Errorf("GKE Auth failed with following error: %s", err.Error())
+	}
+}
+
+type GetResourcesTestCase struct {
+	ProjectID  string
+	NameFilter string
+	SkipFilter string
+	Locations  []string
+	Expected   []*resources.Resource
+}
+
+var getResourcesTestCases = []GetResourcesTestCase{
+	GetResourcesTestCase{"project1", "test", "", []string{"us-east1-b"}, []*resources.Resource{
+		resources.NewResource("test-cluster-1", "us-east1-b", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+		resources.NewResource("test-cluster-2", "us-east1-b", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+	}},
+	GetResourcesTestCase{"project1", "test", "2", []string{"us-east1-b", "us-central1"}, []*resources.Resource{
+		resources.NewResource("test-cluster-1", "us-east1-b", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+		resources.NewResource("test-regional", "us-central1", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+	}},
+	GetResourcesTestCase{"project1", "other", "", []string{"us-east1-b", "us-central1"}, []*resources.Resource{
+		resources.NewResource("other-cluster", "us-central1", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+	}},
+	GetResourcesTestCase{"project2", "test", "", []string{"us-east1-b"}, nil},
+}
+
+func TestGetResources(t *testing.T) {
+	server := utils.CreateServer(getResourcesHandler)
+	defer server.Close()
+
+	client := NewGKEClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	setupTestClusters()
+	for _, testCase := range getResourcesTestCases {
+		config := &reaperconfig.ResourceConfig{
+			Zones:      testCase.Locations,
+			NameFilter: testCase.NameFilter,
+			SkipFilter: testCase.SkipFilter,
+		}
+		result, err := client.GetResources(testCase.ProjectID, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(result, testCase.Expected) {
+			t.Errorf("Resources not same as expected for name filter %s in %v", testCase.NameFilter, testCase.Locations)
+		}
+	}
+}
+
+type DeleteResourceTestCase struct {
+	ProjectID       string
+	Resource        *resources.Resource
+	PendingPolls    int
+	OperationFails  bool
+	ExpectedDeleted []string
+	ExpectError     bool
+}
+
+var deleteResourceTestCases = []DeleteResourceTestCase{
+	DeleteResourceTestCase{
+		"project1", resources.NewResource("test-cluster-1", "us-east1-b", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+		0, false, []string{"projects/project1/locations/us-east1-b/clusters/test-cluster-1"}, false,
+	},
+	DeleteResourceTestCase{
+		"project1", resources.NewResource("test-regional", "us-central1", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+		3, false, []string{"projects/project1/locations/us-central1/clusters/test-regional"}, false,
+	},
+	DeleteResourceTestCase{
+		"project1", resources.NewResource("test-cluster-2", "us-east1-b", timeCreated, reaperconfig.ResourceType_GKE_CLUSTER),
+		1, true, []string{"projects/project1/locations/us-east1-b/clusters/test-cluster-2"}, true,
+	},
+}
+
+func TestDeleteResource(t *testing.T) {
+	server := utils.CreateServer(deleteResourceHandler)
+	defer server.Close()
+
+	client := NewGKEClient()
+	client.Auth(testContext, utils.GetTestOptions(server)...)
+
+	for _, testCase := range deleteResourceTestCases {
+		deletedClusters = nil
+		pendingOperations = map[string]int{"operation-" + testCase.Resource.Name: testCase.PendingPolls}
+		failedOperation = ""
+		if testCase.OperationFails {
+			failedOperation = "operation-" + testCase.Resource.Name
+		}
+
+		err := client.DeleteResource(testCase.ProjectID, testCase.Resource)
+		if testCase.ExpectError && err == nil {
+			t.Errorf("Expected delete of %s to fail", testCase.Resource.Name)
+		}
+		if !testCase.ExpectError && err != nil {
+			t.Errorf("GKE delete resource failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(deletedClusters, testCase.ExpectedDeleted) {
+			t.Errorf("Deleted clusters = %v; want %v", deletedClusters, testCase.ExpectedDeleted)
+		}
+		if pendingOperations["operation-"+testCase.Resource.Name] > 0 {
+			t.Errorf("Delete of %s returned before the operation was done", testCase.Resource.Name)
+		}
+	}
+}
+
+// Mock server's http handler for GetResources test.
+func getResourcesHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoint of the form: /v1/projects/{ProjectID}/locations/{Location}/clusters
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+	projectID := splitEndpoint[3]
+	location := splitEndpoint[5]
+
+	response := struct {
+		Clusters []Cluster `json:"clusters"`
+	}{testClusters[projectID][location]}
+	utils.SendResponse(w, response)
+}
+
+// Mock server's http handler for DeleteResource test. Delete calls return a running
+// operation, and the operation is done after it has been polled enough times.
+func deleteResourceHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoints of the form: /v1/projects/{ProjectID}/locations/{Location}/clusters/{Name}
+	// and /v1/projects/{ProjectID}/locations/{Location}/operations/{Name}
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+	name := splitEndpoint[7]
+
+	var operationName string
+	switch splitEndpoint[6] {
+	case "clusters":
+		deletedClusters = append(deletedClusters, strings.TrimPrefix(req.URL.Path, "/v1/"))
+		operationName = "operation-" + name
+	case "operations":
+		operationName = name
+		pendingOperations[operationName]--
+	}
+
+	operation := Operation{Name: operationName, Status: "RUNNING"}
+	if pendingOperations[operationName] <= 0 {
+		operation.Status = "DONE"
+		if operationName == failedOperation {
+			operation.StatusMessage = "cluster deletion failed"
+		}
+	}
+	utils.SendResponse(w, operation)
+}
+
+func setupTestClusters() {
+	testClusters = map[string]map[string][]Cluster{
+		"project1": {
+			"us-east1-b": []Cluster{
+				Cluster{"test-cluster-1", "us-east1-b", timeCreatedString},
+				Cluster{"test-cluster-2", "us-east1-b", timeCreatedString},
+			},
+			"us-central1": []Cluster{
+				Cluster{"test-regional", "us-central1", timeCreatedString},
+				Cluster{"other-cluster", "us-central1", timeCreatedString},
+			},
+		},
+		"project2": {
+			"us-east1-b": []Cluster{
+				Cluster{"other-cluster", "us-east1-b", timeCreatedString},
+			},
+		},
+	}
+}
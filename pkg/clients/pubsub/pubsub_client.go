@@ -0,0 +1,168 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/option"
+	pubsubv1 "google.golang.org/api/pubsub/v1"
+)
+
+const (
+	// CreationTimeLabel is the label holding the creation time of a topic or
+	// subscription in Unix seconds. Pub/Sub does not record when a topic or
+	// subscription was created, so tests that want their resources reaped by
+	// age should set this label.
+	CreationTimeLabel = "creation-time"
+
+	// Zone is the zone given to all Pub/Sub resources, since topics and
+	// subscriptions are global.
+	Zone = "global"
+
+	// DeletedTopic is the topic of a subscription whose topic has been deleted.
+	DeletedTopic = "_deleted-topic_"
+)
+
+// pubsubBaseClient is common between Pub/Sub topics and subscriptions.
+type pubsubBaseClient struct {
+	Client *pubsubv1.Service
+	ctx    context.Context
+}
+
+// Auth authenticates the client for both Pub/Sub topics and subscriptions.
+func (client *pubsubBaseClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	authedClient, err := pubsubv1.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.Client = authedClient
+	client.ctx = ctx
+	return nil
+}
+
+// PubSubTopicClient is a client for Pub/Sub topics. The zones in the ResourceConfig
+// are ignored, since topics are global.
+type PubSubTopicClient struct {
+	*pubsubBaseClient
+}
+
+// NewPubSubTopicClient creates a new Pub/Sub topic client.
+func NewPubSubTopicClient() *PubSubTopicClient {
+	return &PubSubTopicClient{&pubsubBaseClient{}}
+}
+
+// GetResources gets the Pub/Sub topics that match the given ResourceConfig. The creation
+// time of a topic is read from its CreationTimeLabel, and is left unset if the label
+// is missing.
+func (client *PubSubTopicClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var topics []*resources.Resource
+	listTopicsCall := client.Client.Projects.Topics.List(projectPath(projectID))
+	err := listTopicsCall.Pages(client.ctx, func(page *pubsubv1.ListTopicsResponse) error {
+		for _, topic := range page.Topics {
+			name := shortName(topic.Name)
+			parsedResource := resources.NewResource(name, Zone, labeledCreationTime(topic.Labels), reaperconfig.ResourceType_PUBSUB_TOPIC)
+			parsedResource.Labels = topic.Labels
+			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+				topics = append(topics, parsedResource)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+// DeleteResource deletes the given Pub/Sub topic.
+func (client *PubSubTopicClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	topicPath := fmt.Sprintf("%s/topics/%s", projectPath(projectID), resource.Name)
+	_, err := client.Client.Projects.Topics.Delete(topicPath).Context(client.ctx).Do()
+	return err
+}
+
+// PubSubSubscriptionClient is a client for Pub/Sub subscriptions. The zones in the
+// ResourceConfig are ignored, since subscriptions are global.
+type PubSubSubscriptionClient struct {
+	*pubsubBaseClient
+}
+
+// NewPubSubSubscriptionClient creates a new Pub/Sub subscription client.
+func NewPubSubSubscriptionClient() *PubSubSubscriptionClient {
+	return &PubSubSubscriptionClient{&pubsubBaseClient{}}
+}
+
+// GetResources gets the Pub/Sub subscriptions that match the given ResourceConfig. The
+// creation time of a subscription is read from its CreationTimeLabel, and is left unset if
+// the label is missing. If the config deletes detached subscriptions, subscriptions whose
+// topic has been deleted are given a creation time of the Unix epoch, so that they are
+// deleted on the next sweep regardless of their TTL.
+func (client *PubSubSubscriptionClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var subscriptions []*resources.Resource
+	listSubscriptionsCall := client.Client.Projects.Subscriptions.List(projectPath(projectID))
+	err := listSubscriptionsCall.Pages(client.ctx, func(page *pubsubv1.ListSubscriptionsResponse) error {
+		for _, subscription := range page.Subscriptions {
+			name := shortName(subscription.Name)
+			timeCreated := labeledCreationTime(subscription.Labels)
+			if config.GetDeleteDetachedSubscriptions() && subscription.Topic == DeletedTopic {
+				timeCreated = time.Unix(0, 0)
+			}
+			parsedResource := resources.NewResource(name, Zone, timeCreated, reaperconfig.ResourceType_PUBSUB_SUBSCRIPTION)
+			parsedResource.Labels = subscription.Labels
+			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+				subscriptions = append(subscriptions, parsedResource)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// DeleteResource deletes the given Pub/Sub subscription.
+func (client *PubSubSubscriptionClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	subscriptionPath := fmt.Sprintf("%s/subscriptions/%s", projectPath(projectID), resource.Name)
+	_, err := client.Client.Projects.Subscriptions.Delete(subscriptionPath).Context(client.ctx).Do()
+	return err
+}
+
+// labeledCreationTime returns the creation time stored in the CreationTimeLabel, or the
+// zero time if the label is missing or malformed.
+func labeledCreationTime(labels map[string]string) time.Time {
+	creationTime, err := strconv.ParseInt(labels[CreationTimeLabel], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(creationTime, 0)
+}
+
+// projectPath returns the resource path of a project.
+func projectPath(projectID string) string {
+	return fmt.Sprintf("projects/%s", projectID)
+}
+
+// shortName returns the last segment of a topic or subscription's full resource path.
+func shortName(fullName string) string {
+	return fullName[strings.LastIndex(fullName, "/")+1:]
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// A mock object to represent both Pub/Sub topics and subscriptions. Topic
+// is only set for subscriptions.
+type PubSubResource struct {
+	Name   string            `json:"name"`
+	Topic  string            `json:"topic,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+var (
+	testContext = context.Background()
+
+	timeCreated      = time.Unix(1592402400, 0)
+	timeCreatedLabel = map[string]string{CreationTimeLabel: "1592402400"}
+
+	// Map of project -> collection (topics or subscriptions) -> resources.
+	testResources  map[string]map[string][]PubSubResource
+	deletedPaths   []string
+	topicType      = reaperconfig.ResourceType_PUBSUB_TOPIC
+	subscriberType = reaperconfig.ResourceType_PUBSUB_SUBSCRIPTION
+)
+
+func TestAuth(t *testing.T) {
+	topicClient := NewPubSubTopicClient()
+	if err := topicClient.Auth(testContext); err != nil {
+		t.Errorf("Pub/Sub topic Auth failed with following error: %s", err.Error())
+	}
+	subscriptionClient := NewPubSubSubscriptionClient()
+	if err := subscriptionClient.Auth(testContext); err != nil {
+		t.Errorf("Pub/Sub subscription Auth failed with following error: %s", err.Error())
+	}
+}
+
+type GetResourcesTestCase struct {
+	ProjectID      string
+	Config         *reaperconfig.ResourceConfig
+	ExpectedTopics []*resources.Resource
+	ExpectedSubs   []*resources.Resource
+}
+
+var getResourcesTestCases = []GetResourcesTestCase{
+	GetResourcesTestCase{
+		"project1",
+		&reaperconfig.ResourceConfig{NameFilter: "test"},
+		[]*resources.Resource{
+			labeledResource("test-topic-1", topicType),
+			resources.NewResource("test-topic-unlabeled", Zone, time.Time{}, topicType),
+		},
+		[]*resources.Resource{
+			labeledResource("test-sub-1", subscriberType),
+			resources.NewResource("test-sub-detached", Zone, time.Time{}, subscriberType),
+		},
+	},
+	GetResourcesTestCase{
+		"project1",
+		&reaperconfig.ResourceConfig{NameFilter: "test", SkipFilter: "unlabeled", DeleteDetachedSubscriptions: true},
+		[]*resources.Resource{
+			labeledResource("test-topic-1", topicType),
+		},
+		[]*resources.Resource{
+			labeledResource("test-sub-1", subscriberType),
+			resources.NewResource("test-sub-detached", Zone, time.Unix(0, 0), subscriberType),
+		},
+	},
+	GetResourcesTestCase{
+		"project2",
+		&reaperconfig.ResourceConfig{NameFilter: "test"},
+		nil,
+		nil,
+	},
+}
+
+// labeledResource returns a resource with the creation time label.
+func labeledResource(name string, resourceType reaperconfig.ResourceType) *resources.Resource {
+	resource := resources.NewResource(name, Zone, timeCreated, resourceType)
+	resource.Labels = timeCreatedLabel
+	return resource
+}
+
+func TestGetResources(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	topicClient := NewPubSubTopicClient()
+	topicClient.Auth(testContext, utils.GetTestOptions(server)...)
+	subscriptionClient := NewPubSubSubscriptionClient()
+	subscriptionClient.Auth(testContext, utils.GetTestOptions(server)...)
+
+	setupTestResources()
+	for _, testCase := range getResourcesTestCases {
+		topics, err := topicClient.GetResources(testCase.ProjectID, testCase.Config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(topics, testCase.ExpectedTopics) {
+			t.Errorf("Topics not same as expected for config %v", testCase.Config)
+		}
+		subscriptions, err := subscriptionClient.GetResources(testCase.ProjectID, testCase.Config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(subscriptions, testCase.ExpectedSubs) {
+			t.Errorf("Subscriptions not same as expected for config %v", testCase.Config)
+		}
+	}
+}
+
+func TestDeleteResource(t *testing.T) {
+	server := utils.CreateServer(testHandler)
+	defer server.Close()
+
+	topicClient := NewPubSubTopicClient()
+	topicClient.Auth(testContext, utils.GetTestOptions(server)...)
+	subscriptionClient := NewPubSubSubscriptionClient()
+	subscriptionClient.Auth(testContext, utils.GetTestOptions(server)...)
+
+	deletedPaths = nil
+	if err := topicClient.DeleteResource("project1", resources.NewResource("test-topic-1", Zone, timeCreated, topicType)); err != nil {
+		t.Errorf("Pub/Sub topic delete failed with the following error: %s", err.Error())
+	}
+	if err := subscriptionClient.DeleteResource("project1", resources.NewResource("test-sub-1", Zone, timeCreated, subscriberType)); err != nil {
+		t.Errorf("Pub/Sub subscription delete failed with the following error: %s", err.Error())
+	}
+
+	expected := []string{"projects/project1/topics/test-topic-1", "projects/project1/subscriptions/test-sub-1"}
+	if !reflect.DeepEqual(deletedPaths, expected) {
+		t.Errorf("Deleted = %v; want %v", deletedPaths, expected)
+	}
+}
+
+// Mock server's http handler for the Pub/Sub API.
+func testHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoints of the form: /v1/projects/{ProjectID}/{topics|subscriptions}[/{Name}]
+	splitEndpoint := strings.Split(req.URL.Path, "/")
+	projectID := splitEndpoint[3]
+	collection := splitEndpoint[4]
+
+	if req.Method == "DELETE" {
+		deletedPaths = append(deletedPaths, strings.TrimPrefix(req.URL.Path, "/v1/"))
+		w.Write([]byte(`{}`))
+		return
+	}
+
+	var fullResources []PubSubResource
+	for _, resource := range testResources[projectID][collection] {
+		resource.Name = strings.Join([]string{"projects", projectID, collection, resource.Name}, "/")
+		fullResources = append(fullResources, resource)
+	}
+	utils.SendResponse(w, map[string][]PubSubResource{collection: fullResources})
+}
+
+func setupTestResources() {
+	testResources = map[string]map[string][]PubSubResource{
+		"project1": {
+			"topics": []PubSubResource{
+				PubSubResource{Name: "test-topic-1", Labels: timeCreatedLabel},
+				PubSubResource{Name: "test-topic-unlabeled"},
+				PubSubResource{Name: "other-topic", Labels: timeCreatedLabel},
+			},
+			"subscriptions": []PubSubResource{
+				PubSubResource{Name: "test-sub-1", Topic: "projects/project1/topics/test-topic-1", Labels: timeCreatedLabel},
+				PubSubResource{Name: "test-sub-detached", Topic: DeletedTopic},
+				PubSubResource{Name: "other-sub", Topic: DeletedTopic},
+			},
+		},
+		"project2": {
+			"topics": []PubSubResource{
+				PubSubResource{Name: "other-topic"},
+			},
+		},
+	}
+}
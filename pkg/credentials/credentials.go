@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+const (
+	// cloudPlatformScope is the OAuth scope requested for impersonated credentials.
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	// tokenLifetime is how long each impersonated access token is valid for.
+	tokenLifetime = "3600s"
+)
+
+// ErrInvalidCredentialsFile is returned for a credentials file that is not inside the
+// server's credentials directory, or when the server has no credentials directory.
+var ErrInvalidCredentialsFile = errors.New("invalid credentials file")
+
+// credentialsDir is the directory that the credentials files of reapers are resolved
+// against. Reapers cannot use credentials files if it is empty.
+var credentialsDir string
+
+// SetCredentialsDir sets the directory that the credentials files of reapers are
+// resolved against.
+func SetCredentialsDir(dir string) {
+	credentialsDir = dir
+}
+
+// ClientOptions returns the client options for a reaper with the given Credentials.
+// The default options are always included, and the options for the credentials are
+// added after them so that they take precedence. Nil or empty credentials return the
+// default options unchanged.
+func ClientOptions(ctx context.Context, credentials *reaperconfig.Credentials, defaultOptions ...option.ClientOption) ([]option.ClientOption, error) {
+	clientOptions := append([]option.ClientOption{}, defaultOptions...)
+	if credentialsFile := credentials.GetCredentialsFile(); len(credentialsFile) > 0 {
+		path, err := ResolveCredentialsFile(credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions = append(clientOptions, option.WithCredentialsFile(path))
+	}
+
+	serviceAccount := credentials.GetImpersonateServiceAccount()
+	if len(serviceAccount) == 0 {
+		return clientOptions, nil
+	}
+	iamService, err := iamcredentials.NewService(ctx, clientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("creating IAM credentials client to impersonate %s failed: %v", serviceAccount, err)
+	}
+	tokenSource := &impersonatedTokenSource{
+		service:        iamService,
+		ctx:            ctx,
+		serviceAccount: serviceAccount,
+	}
+	// Credentials take precedence over every other way of authenticating, including a
+	// credentials file in the default options.
+	impersonatedCredentials := &google.Credentials{TokenSource: oauth2.ReuseTokenSource(nil, tokenSource)}
+	return append(clientOptions, option.WithCredentials(impersonatedCredentials)), nil
+}
+
+// ResolveCredentialsFile returns the path of the named credentials file in the server's
+// credentials directory. Absolute paths and paths containing "..", which could name files
+// outside the directory, are rejected.
+func ResolveCredentialsFile(name string) (string, error) {
+	if len(credentialsDir) == 0 {
+		return "", fmt.Errorf("%w %s: the server has no credentials directory", ErrInvalidCredentialsFile, name)
+	}
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("%w %s: the path must be relative to the credentials directory", ErrInvalidCredentialsFile, name)
+	}
+	for _, element := range strings.Split(filepath.ToSlash(name), "/") {
+		if element == ".." {
+			return "", fmt.Errorf("%w %s: the path must not contain ..", ErrInvalidCredentialsFile, name)
+		}
+	}
+	return filepath.Join(credentialsDir, name), nil
+}
+
+// impersonatedTokenSource is an oauth2.TokenSource that generates access tokens for a
+// service account through the IAM Credentials API.
+type impersonatedTokenSource struct {
+	service        *iamcredentials.Service
+	ctx            context.Context
+	serviceAccount string
+}
+
+// Token generates a new access token for the service account.
+func (tokenSource *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	name := fmt.Sprintf("projects/-/serviceAccounts/%s", tokenSource.serviceAccount)
+	request := &iamcredentials.GenerateAccessTokenRequest{
+		Scope:    []string{cloudPlatformScope},
+		Lifetime: tokenLifetime,
+	}
+	response, err := tokenSource.service.Projects.ServiceAccounts.GenerateAccessToken(name, request).Context(tokenSource.ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("impersonating %s failed: %v", tokenSource.serviceAccount, err)
+	}
+	expiry, err := time.Parse(time.RFC3339, response.ExpireTime)
+	if err != nil {
+		return nil, fmt.Errorf("parsing expiry of token for %s failed: %v", tokenSource.serviceAccount, err)
+	}
+	return &oauth2.Token{AccessToken: response.AccessToken, TokenType: "Bearer", Expiry: expiry}, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+)
+
+var testExpireTime = "2020-06-17T11:00:00Z"
+
+type ClientOptionsTestCase struct {
+	Credentials     *reaperconfig.Credentials
+	ExpectedOptions int
+}
+
+var clientOptionsTestCases = []ClientOptionsTestCase{
+	ClientOptionsTestCase{nil, 2},
+	ClientOptionsTestCase{&reaperconfig.Credentials{}, 2},
+	ClientOptionsTestCase{&reaperconfig.Credentials{CredentialsFile: "key.json"}, 3},
+	ClientOptionsTestCase{&reaperconfig.Credentials{ImpersonateServiceAccount: "reaper@project.iam.gserviceaccount.com"}, 3},
+}
+
+func TestClientOptions(t *testing.T) {
+	server := utils.CreateServer(generateAccessTokenHandler)
+	defer server.Close()
+	SetCredentialsDir("/etc/reaper/credentials")
+	defer SetCredentialsDir("")
+
+	for _, testCase := range clientOptionsTestCases {
+		result, err := ClientOptions(context.TODO(), testCase.Credentials, utils.GetTestOptions(server)...)
+		if err != nil {
+			t.Errorf("Getting client options failed with the following error: %s", err.Error())
+		}
+		if len(result) != testCase.ExpectedOptions {
+			t.Errorf("Got %d client options for %v; want %d", len(result), testCase.Credentials, testCase.ExpectedOptions)
+		}
+	}
+}
+
+type ResolveCredentialsFileTestCase struct {
+	CredentialsDir string
+	Name           string
+	Expected       string
+	ExpectError    bool
+}
+
+var resolveCredentialsFileTestCases = []ResolveCredentialsFileTestCase{
+	ResolveCredentialsFileTestCase{"/etc/reaper/credentials", "key.json", "/etc/reaper/credentials/key.json", false},
+	ResolveCredentialsFileTestCase{"/etc/reaper/credentials", "team/key.json", "/etc/reaper/credentials/team/key.json", false},
+	ResolveCredentialsFileTestCase{"/etc/reaper/credentials", "/etc/reaper/credentials/key.json", "", true},
+	ResolveCredentialsFileTestCase{"/etc/reaper/credentials", "../server-key.json", "", true},
+	ResolveCredentialsFileTestCase{"/etc/reaper/credentials", "team/../../server-key.json", "", true},
+	ResolveCredentialsFileTestCase{"", "key.json", "", true},
+}
+
+func TestResolveCredentialsFile(t *testing.T) {
+	defer SetCredentialsDir("")
+	for _, testCase := range resolveCredentialsFileTestCases {
+		SetCredentialsDir(testCase.CredentialsDir)
+		result, err := ResolveCredentialsFile(testCase.Name)
+		if testCase.ExpectError {
+			if !errors.Is(err, ErrInvalidCredentialsFile) {
+				t.Errorf("Resolving %s in %q = %s, %v; want ErrInvalidCredentialsFile", testCase.Name, testCase.CredentialsDir, result, err)
+			}
+			continue
+		}
+		if err != nil || result != testCase.Expected {
+			t.Errorf("Resolving %s in %q = %s, %v; want %s", testCase.Name, testCase.CredentialsDir, result, err, testCase.Expected)
+		}
+	}
+}
+
+func TestClientOptionsRejectsCredentialsFileOutsideDir(t *testing.T) {
+	SetCredentialsDir("/etc/reaper/credentials")
+	defer SetCredentialsDir("")
+
+	credentials := &reaperconfig.Credentials{CredentialsFile: "/etc/server/key.json"}
+	if _, err := ClientOptions(context.TODO(), credentials); !errors.Is(err, ErrInvalidCredentialsFile) {
+		t.Errorf("Getting client options for %v returned %v; want ErrInvalidCredentialsFile", credentials, err)
+	}
+}
+
+func TestImpersonatedToken(t *testing.T) {
+	server := utils.CreateServer(generateAccessTokenHandler)
+	defer server.Close()
+
+	iamService, _ := iamcredentials.NewService(context.TODO(), utils.GetTestOptions(server)...)
+	tokenSource := &impersonatedTokenSource{
+		service:        iamService,
+		ctx:            context.TODO(),
+		serviceAccount: "reaper@project.iam.gserviceaccount.com",
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		t.Fatalf("Impersonation failed with the following error: %s", err.Error())
+	}
+	expectedExpiry, _ := time.Parse(time.RFC3339, testExpireTime)
+	if token.AccessToken != "reaper@project.iam.gserviceaccount.com-token" || !token.Expiry.Equal(expectedExpiry) {
+		t.Errorf("Impersonated token = %s expiring %v; want reaper@project.iam.gserviceaccount.com-token expiring %v", token.AccessToken, token.Expiry, expectedExpiry)
+	}
+}
+
+// Mock server's http handler for generating access tokens, which returns a token named
+// after the impersonated service account.
+func generateAccessTokenHandler(w http.ResponseWriter, req *http.Request) {
+	// Endpoint of the form: /v1/projects/-/serviceAccounts/{ServiceAccount}:generateAccessToken
+	serviceAccount := strings.TrimSuffix(strings.Split(req.URL.Path, "/")[5], ":generateAccessToken")
+	utils.SendResponse(w, map[string]string{"accessToken": serviceAccount + "-token", "expireTime": testExpireTime})
+}
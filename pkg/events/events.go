@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// A Sink receives the events of reapers, so that downstream consumers can follow what
+// the reapers do. Publish returns once the events have been published.
+type Sink interface {
+	Publish(ctx context.Context, events ...*reaperconfig.ReaperEvent) error
+}
+
+// Publish publishes the events to the sink, and logs the events that could not be
+// published. Nothing is published to a nil sink.
+func Publish(ctx context.Context, sink Sink, events ...*reaperconfig.ReaperEvent) {
+	if sink == nil || len(events) == 0 {
+		return
+	}
+	if err := sink.Publish(ctx, events...); err != nil {
+		logger.Error(fmt.Errorf("Publishing %d reaper events failed with the following error: %s", len(events), err.Error()))
+	}
+}
+
+// NewResourceEvent creates an event of the given type about a resource in the given project.
+func NewResourceEvent(eventType reaperconfig.EventType, reaperUUID, projectID string, resource *resources.Resource, eventTime time.Time) *reaperconfig.ReaperEvent {
+	return &reaperconfig.ReaperEvent{
+		Type:       eventType,
+		ReaperUuid: reaperUUID,
+		Time:       timestampProto(eventTime),
+		Resource: &reaperconfig.EventResource{
+			Name:        resource.Name,
+			Zone:        resource.Zone,
+			ProjectId:   projectID,
+			Type:        resource.Type,
+			TimeCreated: timestampProto(resource.TimeCreated),
+			Labels:      resource.Labels,
+		},
+	}
+}
+
+// NewScheduledEvent creates a SCHEDULED_FOR_DELETION event about a resource in the given
+// project that will be deleted at the given time.
+func NewScheduledEvent(reaperUUID, projectID string, resource *resources.Resource, deletionTime, eventTime time.Time) *reaperconfig.ReaperEvent {
+	event := NewResourceEvent(reaperconfig.EventType_SCHEDULED_FOR_DELETION, reaperUUID, projectID, resource, eventTime)
+	event.DeletionTime = timestampProto(deletionTime)
+	return event
+}
+
+// NewFailedEvent creates a DELETION_FAILED event about a resource in the given project that
+// could not be deleted because of the error.
+func NewFailedEvent(reaperUUID, projectID string, resource *resources.Resource, err error, eventTime time.Time) *reaperconfig.ReaperEvent {
+	event := NewResourceEvent(reaperconfig.EventType_DELETION_FAILED, reaperUUID, projectID, resource, eventTime)
+	event.Error = err.Error()
+	return event
+}
+
+// NewConfigEvent creates a CONFIG_CHANGED event for a reaper with the given new config. The
+// config is nil if the reaper was deleted. The event carries a redacted copy of the config,
+// as returned by redactConfig.
+func NewConfigEvent(reaperUUID string, config *reaperconfig.ReaperConfig, eventTime time.Time) *reaperconfig.ReaperEvent {
+	return &reaperconfig.ReaperEvent{
+		Type:       reaperconfig.EventType_CONFIG_CHANGED,
+		ReaperUuid: reaperUUID,
+		Time:       timestampProto(eventTime),
+		Config:     redactConfig(config),
+	}
+}
+
+// redactConfig returns a copy of the config without its credentials or the URLs of its
+// webhooks, which may carry secrets, so that the config can be shared with event consumers.
+func redactConfig(config *reaperconfig.ReaperConfig) *reaperconfig.ReaperConfig {
+	if config == nil {
+		return nil
+	}
+	redacted := proto.Clone(config).(*reaperconfig.ReaperConfig)
+	redacted.Credentials = nil
+	if redacted.Notifications != nil {
+		redacted.Notifications.Webhooks = nil
+	}
+	return redacted
+}
+
+// NewPausedEvent creates a REAPER_PAUSED event for a reaper that was paused for the reason
+// in err.
+func NewPausedEvent(reaperUUID string, err error, eventTime time.Time) *reaperconfig.ReaperEvent {
+	return &reaperconfig.ReaperEvent{
+		Type:       reaperconfig.EventType_REAPER_PAUSED,
+		ReaperUuid: reaperUUID,
+		Time:       timestampProto(eventTime),
+		Error:      err.Error(),
+	}
+}
+
+// timestampProto converts a time into a Timestamp proto. A zero time is an unset Timestamp.
+func timestampProto(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	timestampProto, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil
+	}
+	return timestampProto
+}
+
+// MemorySink is a Sink that keeps the events published to it in memory, such as for tests.
+type MemorySink struct {
+	events []*reaperconfig.ReaperEvent
+	mux    sync.Mutex
+}
+
+// NewMemorySink creates an empty MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Publish adds the events to the sink.
+func (sink *MemorySink) Publish(ctx context.Context, events ...*reaperconfig.ReaperEvent) error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+	sink.events = append(sink.events, events...)
+	return nil
+}
+
+// Events returns the events published to the sink so far, in the order they were published.
+func (sink *MemorySink) Events() []*reaperconfig.ReaperEvent {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+	return append([]*reaperconfig.ReaperEvent{}, sink.events...)
+}
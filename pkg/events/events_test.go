@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+var (
+	testContext    = context.Background()
+	currentTime, _ = time.Parse("2006-01-02 15:04:05 -0700", "2020-06-17 10:00:00 -0400")
+	createdTime    = currentTime.Add(-time.Hour)
+	deletionTime   = currentTime.Add(time.Hour)
+)
+
+func createTestResource() *resources.Resource {
+	resource := resources.NewResource("TestResource", "testZone", createdTime, reaperconfig.ResourceType_GCE_VM)
+	resource.Labels = map[string]string{"owner": "test"}
+	return resource
+}
+
+func TestNewScheduledEvent(t *testing.T) {
+	event := NewScheduledEvent("TestUUID", "testProject", createTestResource(), deletionTime, currentTime)
+
+	eventTime, _ := ptypes.Timestamp(event.GetTime())
+	scheduledTime, _ := ptypes.Timestamp(event.GetDeletionTime())
+	timeCreated, _ := ptypes.Timestamp(event.GetResource().GetTimeCreated())
+	if event.GetType() != reaperconfig.EventType_SCHEDULED_FOR_DELETION || event.GetReaperUuid() != "TestUUID" {
+		t.Errorf("Event is a %s event of reaper %s; want a SCHEDULED_FOR_DELETION event of TestUUID", event.GetType(), event.GetReaperUuid())
+	}
+	if !eventTime.Equal(currentTime) || !scheduledTime.Equal(deletionTime) || !timeCreated.Equal(createdTime) {
+		t.Errorf("Event times = %v, %v and %v; want %v, %v and %v", eventTime, scheduledTime, timeCreated, currentTime, deletionTime, createdTime)
+	}
+	eventResource := event.GetResource()
+	if eventResource.GetName() != "TestResource" || eventResource.GetProjectId() != "testProject" ||
+		eventResource.GetType() != reaperconfig.ResourceType_GCE_VM || eventResource.GetLabels()["owner"] != "test" {
+		t.Errorf("Event resource = %v; want TestResource in testProject", eventResource)
+	}
+}
+
+func TestNewResourceEventUnknownCreationTime(t *testing.T) {
+	resource := resources.NewResource("TestResource", "testZone", time.Time{}, reaperconfig.ResourceType_PUBSUB_TOPIC)
+	event := NewResourceEvent(reaperconfig.EventType_RESOURCE_DISCOVERED, "TestUUID", "testProject", resource, currentTime)
+	if event.GetResource().GetTimeCreated() != nil {
+		t.Errorf("Unknown creation time = %v; want unset", event.GetResource().GetTimeCreated())
+	}
+}
+
+func TestNewConfigEventRedactsSecrets(t *testing.T) {
+	config := &reaperconfig.ReaperConfig{
+		Uuid:      "TestUUID",
+		ProjectId: "testProject",
+		Schedule:  "@every 1h",
+		Resources: []*reaperconfig.ResourceConfig{
+			&reaperconfig.ResourceConfig{ResourceType: reaperconfig.ResourceType_GCE_VM, NameFilter: "test"},
+		},
+		Credentials: &reaperconfig.Credentials{
+			ImpersonateServiceAccount: "reaper@testProject.iam.gserviceaccount.com",
+			CredentialsFile:           "key.json",
+		},
+		Notifications: &reaperconfig.NotificationConfig{
+			Webhooks: []*reaperconfig.Webhook{
+				&reaperconfig.Webhook{Url: "https://hooks.slack.com/services/T000/B000/secret", Format: reaperconfig.WebhookFormat_SLACK},
+			},
+			WarningLeadTime: "24h",
+		},
+	}
+	event := NewConfigEvent("TestUUID", config, currentTime)
+
+	if text := proto.MarshalTextString(event); strings.Contains(text, "secret") || strings.Contains(text, "key.json") || strings.Contains(text, "iam.gserviceaccount.com") {
+		t.Errorf("Config event %s contains the reaper's credentials or webhook URLs", text)
+	}
+	if eventConfig := event.GetConfig(); eventConfig.GetUuid() != "TestUUID" || eventConfig.GetSchedule() != "@every 1h" ||
+		eventConfig.GetProjectId() != "testProject" || len(eventConfig.GetResources()) != 1 {
+		t.Errorf("Config event config = %v; want the UUID, schedule, project and resources of %v", eventConfig, config)
+	}
+	if config.GetCredentials() == nil || len(config.GetNotifications().GetWebhooks()) != 1 {
+		t.Errorf("Creating a config event changed the config to %v", config)
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	sink := NewMemorySink()
+	failedEvent := NewFailedEvent("TestUUID", "testProject", createTestResource(), errors.New("permission denied"), currentTime)
+	configEvent := NewConfigEvent("TestUUID", nil, currentTime)
+
+	Publish(testContext, sink, failedEvent)
+	Publish(testContext, sink, configEvent)
+	Publish(testContext, nil, configEvent)
+	if events := sink.Events(); !reflect.DeepEqual(events, []*reaperconfig.ReaperEvent{failedEvent, configEvent}) {
+		t.Errorf("Memory sink got events %v; want %v", events, []*reaperconfig.ReaperEvent{failedEvent, configEvent})
+	}
+	if failedEvent.GetError() != "permission denied" {
+		t.Errorf("Failed event error = %s; want permission denied", failedEvent.GetError())
+	}
+	pausedEvent := NewPausedEvent("TestUUID", errors.New("over the limit"), currentTime)
+	if pausedEvent.GetType() != reaperconfig.EventType_REAPER_PAUSED || pausedEvent.GetError() != "over the limit" {
+		t.Errorf("Paused event = %v; want a REAPER_PAUSED event with error over the limit", pausedEvent)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/option"
+	pubsubv1 "google.golang.org/api/pubsub/v1"
+)
+
+const (
+	// EventTypeAttribute is the Pub/Sub message attribute holding the type of the event,
+	// so that subscriptions can filter events by type.
+	EventTypeAttribute = "event_type"
+
+	// ReaperUUIDAttribute is the Pub/Sub message attribute holding the UUID of the reaper
+	// that the event is about.
+	ReaperUUIDAttribute = "reaper_uuid"
+
+	// maxMessagesPerPublish is the maximum number of messages in a single Pub/Sub publish
+	// request.
+	maxMessagesPerPublish = 1000
+)
+
+// PubSubSink is a Sink that publishes events to a Pub/Sub topic. Each message holds one
+// ReaperEvent encoded in the protobuf binary format.
+type PubSubSink struct {
+	service *pubsubv1.Service
+	topic   string
+}
+
+// NewPubSubSink creates a sink that publishes to the given topic, of the form
+// projects/{project}/topics/{topic}. To publish to the Pub/Sub emulator, pass the
+// emulator's address with option.WithEndpoint.
+func NewPubSubSink(ctx context.Context, topic string, opts ...option.ClientOption) (*PubSubSink, error) {
+	service, err := pubsubv1.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &PubSubSink{service: service, topic: topic}, nil
+}
+
+// Publish publishes the events to the sink's topic, in batches of at most
+// maxMessagesPerPublish messages.
+func (sink *PubSubSink) Publish(ctx context.Context, events ...*reaperconfig.ReaperEvent) error {
+	for start := 0; start < len(events); start += maxMessagesPerPublish {
+		end := start + maxMessagesPerPublish
+		if end > len(events) {
+			end = len(events)
+		}
+		var messages []*pubsubv1.PubsubMessage
+		for _, event := range events[start:end] {
+			data, err := proto.Marshal(event)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, &pubsubv1.PubsubMessage{
+				Data: base64.StdEncoding.EncodeToString(data),
+				Attributes: map[string]string{
+					EventTypeAttribute:  event.GetType().String(),
+					ReaperUUIDAttribute: event.GetReaperUuid(),
+				},
+			})
+		}
+		publishCall := sink.service.Projects.Topics.Publish(sink.topic, &pubsubv1.PublishRequest{Messages: messages})
+		if _, err := publishCall.Context(ctx).Do(); err != nil {
+			return fmt.Errorf("publishing %d events to %s failed: %v", len(messages), sink.topic, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	pubsubv1 "google.golang.org/api/pubsub/v1"
+)
+
+func TestPubSubSink(t *testing.T) {
+	var publishPaths []string
+	var messages []*pubsubv1.PubsubMessage
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		// Endpoint of the form: /v1/projects/{Project}/topics/{Topic}:publish
+		publishPaths = append(publishPaths, req.URL.Path)
+		var publishRequest pubsubv1.PublishRequest
+		json.NewDecoder(req.Body).Decode(&publishRequest)
+		messages = append(messages, publishRequest.Messages...)
+		utils.SendResponse(w, map[string][]string{"messageIds": []string{"1"}})
+	})
+	defer server.Close()
+
+	sink, err := NewPubSubSink(testContext, "projects/testProject/topics/reaper-events", utils.GetTestOptions(server)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*reaperconfig.ReaperEvent
+	for i := 0; i < maxMessagesPerPublish+1; i++ {
+		events = append(events, NewConfigEvent(fmt.Sprintf("reaper-%d", i), nil, currentTime))
+	}
+	events = append(events, NewScheduledEvent("TestUUID", "testProject", createTestResource(), deletionTime, currentTime))
+	if err := sink.Publish(testContext, events...); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(publishPaths) != 2 || publishPaths[0] != "/v1/projects/testProject/topics/reaper-events:publish" {
+		t.Errorf("Sink sent publish requests %v; want 2 to the topic", publishPaths)
+	}
+	if len(messages) != len(events) {
+		t.Fatalf("Sink published %d messages; want %d", len(messages), len(events))
+	}
+	lastMessage := messages[len(messages)-1]
+	data, _ := base64.StdEncoding.DecodeString(lastMessage.Data)
+	var published reaperconfig.ReaperEvent
+	if err := proto.Unmarshal(data, &published); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&published, events[len(events)-1]) {
+		t.Errorf("Published event %v; want %v", &published, events[len(events)-1])
+	}
+	if lastMessage.Attributes[EventTypeAttribute] != "SCHEDULED_FOR_DELETION" || lastMessage.Attributes[ReaperUUIDAttribute] != "TestUUID" {
+		t.Errorf("Message attributes = %v; want the event type and reaper UUID", lastMessage.Attributes)
+	}
+}
@@ -16,97 +16,483 @@ package logger
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"cloud.google.com/go/logging"
 )
 
-// Logger handles writing local logs to a file and cloud logs to Stackdriver.
+// Level is the severity of a log entry. Entries below the logger's level are dropped.
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "DEBUG",
+	InfoLevel:  "INFO",
+	WarnLevel:  "WARN",
+	ErrorLevel: "ERROR",
+}
+
+// String returns the name of the level, such as INFO.
+func (level Level) String() string {
+	if name, isLevel := levelNames[level]; isLevel {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(level))
+}
+
+// ParseLevel returns the level with the given name, which is case insensitive.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", name)
+}
+
+// severity returns the Cloud Logging severity of the level.
+func (level Level) severity() logging.Severity {
+	switch level {
+	case DebugLevel:
+		return logging.Debug
+	case WarnLevel:
+		return logging.Warning
+	case ErrorLevel:
+		return logging.Error
+	default:
+		return logging.Info
+	}
+}
+
+// Format is the format of the local log file.
+type Format int
+
+const (
+	// TextFormat writes each entry as a timestamped line of text, followed by its fields
+	// as key=value pairs.
+	TextFormat Format = iota
+	// JSONFormat writes each entry as a JSON object on its own line.
+	JSONFormat
+)
+
+// ParseFormat returns the format with the given name, either text or json.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return TextFormat, fmt.Errorf("unknown log format %q", name)
+}
+
+// Keys of the fields that are common to many log entries.
+const (
+	ReaperKey       = "reaper_uuid"
+	ProjectKey      = "project_id"
+	ResourceTypeKey = "resource_type"
+	ZoneKey         = "zone"
+	ResourceKey     = "resource"
+	ErrorKey        = "error"
+)
+
+// Field is a key-value pair attached to a log entry. Fields are written after the message
+// in text logs, as properties in JSON logs, and as labels and payload properties in Cloud
+// Logging.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field with the given key and value.
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// Reaper returns a field for the UUID of a reaper.
+func Reaper(uuid string) Field {
+	return Field{ReaperKey, uuid}
+}
+
+// Project returns a field for a GCP project ID.
+func Project(projectID string) Field {
+	return Field{ProjectKey, projectID}
+}
+
+// ResourceType returns a field for a resource type.
+func ResourceType(resourceType fmt.Stringer) Field {
+	return Field{ResourceTypeKey, resourceType.String()}
+}
+
+// Zone returns a field for the zone of a resource.
+func Zone(zone string) Field {
+	return Field{ZoneKey, zone}
+}
+
+// Resource returns a field for the name of a resource.
+func Resource(name string) Field {
+	return Field{ResourceKey, name}
+}
+
+// Err returns a field for an error.
+func Err(err error) Field {
+	return Field{ErrorKey, err}
+}
+
+// stringValue returns the field's value as a string.
+func (field Field) stringValue() string {
+	switch value := field.Value.(type) {
+	case string:
+		return value
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// jsonValue returns the field's value in a form that can be marshalled to JSON.
+func (field Field) jsonValue() interface{} {
+	switch value := field.Value.(type) {
+	case error, fmt.Stringer:
+		return field.stringValue()
+	default:
+		if _, err := json.Marshal(value); err != nil {
+			return field.stringValue()
+		}
+		return value
+	}
+}
+
+// Interface is implemented by the loggers that the package's logging functions write to.
+// Write writes an entry with the given level, fields and message, which has no trailing
+// newline, and Close flushes and closes the logger.
+type Interface interface {
+	Write(level Level, fields []Field, message string)
+	Close() error
+}
+
+// Discard is a logger that drops every entry, for programs that use the reaper as a library
+// and do not want its logs.
+var Discard Interface = discard{}
+
+type discard struct{}
+
+func (discard) Write(Level, []Field, string) {}
+
+func (discard) Close() error { return nil }
+
+var (
+	current    Interface = NewWriterLogger(os.Stderr)
+	currentMux sync.RWMutex
+)
+
+// SetLogger sets the logger that the package's logging functions write to. Until it is set,
+// entries are written to stderr.
+func SetLogger(newLogger Interface) {
+	currentMux.Lock()
+	defer currentMux.Unlock()
+	current = newLogger
+}
+
+// getLogger returns the logger that the package's logging functions write to.
+func getLogger() Interface {
+	currentMux.RLock()
+	defer currentMux.RUnlock()
+	return current
+}
+
+// Options configures where a Logger writes its local logs.
+type Options struct {
+	// Path is the file that logs are written to. No file is written if it is empty.
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated. The file is not rotated
+	// by size if it is 0.
+	MaxSize int64
+	// MaxAge is how long logs are written to the same file before it is rotated. The file
+	// is not rotated by age if it is 0.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files that are kept. All of them are kept if it
+	// is 0.
+	MaxBackups int
+	// Stdout is set to also write logs to stdout, such as for container deployments.
+	Stdout bool
+	// Level is the lowest level of the entries that are logged.
+	Level Level
+	// Format is the format of the local logs.
+	Format Format
+}
+
+// Logger handles writing local logs to a file or stream and cloud logs to Stackdriver.
 type Logger struct {
-	*log.Logger
-	*CloudLogger
-	mux *sync.Mutex
+	local   *log.Logger
+	cloud   *CloudLogger
+	closers []io.Closer
+	mux     *sync.Mutex
+	level   Level
+	format  Format
+}
+
+// New creates a logger that writes its local logs as described by the options.
+func New(options Options) (*Logger, error) {
+	var writers []io.Writer
+	var closers []io.Closer
+	if len(options.Path) > 0 {
+		logFile, err := newRotatingFile(options.Path, options.MaxSize, options.MaxAge, options.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, logFile)
+		closers = append(closers, logFile)
+	}
+	if options.Stdout {
+		writers = append(writers, os.Stdout)
+	}
+	newLogger := NewWriterLogger(io.MultiWriter(writers...))
+	newLogger.closers = closers
+	newLogger.SetLevel(options.Level)
+	newLogger.SetFormat(options.Format)
+	return newLogger, nil
 }
 
-var logger *Logger
+// NewWriterLogger creates a logger that writes its local logs to the writer, in TextFormat
+// at InfoLevel until changed.
+func NewWriterLogger(writer io.Writer) *Logger {
+	return &Logger{
+		local:  log.New(writer, "", log.Ldate|log.Ltime),
+		mux:    &sync.Mutex{},
+		level:  InfoLevel,
+		format: TextFormat,
+	}
+}
 
 // CreateLogger initializes the logger for the server. The logs will be written to a local
-// file called logs.txt.
+// file called logs.txt, in TextFormat at InfoLevel until changed.
 func CreateLogger() error {
-	logFile, err := os.OpenFile("logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	fileLogger, err := New(Options{Path: "logs.txt", Level: InfoLevel, Format: TextFormat})
 	if err != nil {
 		return err
 	}
-	fileLogger := log.New(logFile, "", log.Ldate|log.Ltime)
-	logger = &Logger{
-		Logger:      fileLogger,
-		CloudLogger: nil,
-		mux:         &sync.Mutex{},
-	}
+	SetLogger(fileLogger)
 	return nil
 }
 
-// Log outputs to the necessary logs. Arguments are handled in the manner of fmt.Println.
+// SetLevel sets the lowest level of the entries that are logged.
+func (l *Logger) SetLevel(level Level) {
+	l.mux.Lock()
+	l.level = level
+	l.mux.Unlock()
+}
+
+// SetFormat sets the format of the local logs.
+func (l *Logger) SetFormat(format Format) {
+	l.mux.Lock()
+	l.format = format
+	if format == JSONFormat {
+		l.local.SetFlags(0)
+	} else {
+		l.local.SetFlags(log.Ldate | log.Ltime)
+	}
+	l.mux.Unlock()
+}
+
+// SetLevel sets the lowest level of the entries that are logged, if the current logger is
+// a Logger.
+func SetLevel(level Level) {
+	if l, isLogger := getLogger().(*Logger); isLogger {
+		l.SetLevel(level)
+	}
+}
+
+// SetFormat sets the format of the local logs, if the current logger is a Logger.
+func SetFormat(format Format) {
+	if l, isLogger := getLogger().(*Logger); isLogger {
+		l.SetFormat(format)
+	}
+}
+
+// Log outputs to the necessary logs at InfoLevel. Arguments are handled in the manner of
+// fmt.Println.
 func Log(v ...interface{}) {
-	logger.mux.Lock()
-	logger.log(v...)
-	logger.mux.Unlock()
+	write(InfoLevel, nil, fmt.Sprintln(v...))
 }
 
-// Logf takes a format string and message and writes it to the necessary logs. Arguments are
-// handled in the manner of fmt.Printf.
+// Logf takes a format string and message and writes it to the necessary logs at InfoLevel.
+// Arguments are handled in the manner of fmt.Printf.
 func Logf(format string, v ...interface{}) {
-	logger.mux.Lock()
-	logger.logf(format, v...)
-	logger.mux.Unlock()
+	write(InfoLevel, nil, fmt.Sprintf(format, v...))
 }
 
-// Error outputs an error to the necessary logs.
+// Error outputs an error to the necessary logs at ErrorLevel.
 func Error(v ...interface{}) {
-	logger.mux.Lock()
-	logger.error(v...)
-	logger.mux.Unlock()
+	write(ErrorLevel, nil, fmt.Sprintln(v...))
+}
+
+// Debugf logs a message at DebugLevel. Arguments are handled in the manner of fmt.Printf.
+func Debugf(format string, v ...interface{}) {
+	write(DebugLevel, nil, fmt.Sprintf(format, v...))
+}
+
+// Warnf logs a message at WarnLevel. Arguments are handled in the manner of fmt.Printf.
+func Warnf(format string, v ...interface{}) {
+	write(WarnLevel, nil, fmt.Sprintf(format, v...))
+}
+
+// write writes an entry to the current logger, without the message's trailing newline.
+func write(level Level, fields []Field, message string) {
+	getLogger().Write(level, fields, strings.TrimSuffix(message, "\n"))
+}
+
+// Entry is a log entry with fields, which is written by calling one of its leveled methods.
+type Entry struct {
+	fields []Field
+}
+
+// With returns an entry with the given fields.
+func With(fields ...Field) *Entry {
+	return &Entry{fields: fields}
 }
 
-// Close closes the logger.
+// With returns a copy of the entry with the given fields added.
+func (entry *Entry) With(fields ...Field) *Entry {
+	return &Entry{fields: append(append([]Field(nil), entry.fields...), fields...)}
+}
+
+// Debugf logs the entry at DebugLevel. Arguments are handled in the manner of fmt.Printf.
+func (entry *Entry) Debugf(format string, v ...interface{}) {
+	write(DebugLevel, entry.fields, fmt.Sprintf(format, v...))
+}
+
+// Infof logs the entry at InfoLevel. Arguments are handled in the manner of fmt.Printf.
+func (entry *Entry) Infof(format string, v ...interface{}) {
+	write(InfoLevel, entry.fields, fmt.Sprintf(format, v...))
+}
+
+// Warnf logs the entry at WarnLevel. Arguments are handled in the manner of fmt.Printf.
+func (entry *Entry) Warnf(format string, v ...interface{}) {
+	write(WarnLevel, entry.fields, fmt.Sprintf(format, v...))
+}
+
+// Errorf logs the entry at ErrorLevel. Arguments are handled in the manner of fmt.Printf.
+func (entry *Entry) Errorf(format string, v ...interface{}) {
+	write(ErrorLevel, entry.fields, fmt.Sprintf(format, v...))
+}
+
+// Error logs an error at ErrorLevel, with the error's message as the entry's message.
+func (entry *Entry) Error(err error) {
+	write(ErrorLevel, entry.fields, err.Error())
+}
+
+// Close flushes and closes the current logger.
 func Close() {
-	if logger.CloudLogger != nil {
-		logger.CloudLogger.closeLogger()
-	}
+	getLogger().Close()
 }
 
-// AddCloudLogger adds stackdriver logging to the logger in the given project and log name.
+// AddCloudLogger adds stackdriver logging to the current logger in the given project and
+// log name. The current logger must be a Logger.
 func AddCloudLogger(ctx context.Context, projectID, loggerName string) error {
+	l, isLogger := getLogger().(*Logger)
+	if !isLogger {
+		return fmt.Errorf("the current logger does not support cloud logging")
+	}
 	cloudLogger, err := createCloudLogger(ctx, projectID, loggerName)
 	if err != nil {
 		return err
 	}
-	logger.CloudLogger = cloudLogger
+	l.mux.Lock()
+	l.cloud = cloudLogger
+	l.mux.Unlock()
 	return nil
 }
 
-func (l *Logger) log(v ...interface{}) {
-	l.Logger.Println(v...)
-	if l.CloudLogger != nil {
-		l.CloudLogger.log(v...)
+// Write writes an entry with the given level, fields and message to the necessary logs,
+// unless the level is below the logger's level.
+func (l *Logger) Write(level Level, fields []Field, message string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if level < l.level {
+		return
 	}
+	if l.format == JSONFormat {
+		l.local.Println(jsonLine(time.Now(), level, fields, message))
+	} else {
+		l.local.Println(textLine(level, fields, message))
+	}
+	if l.cloud != nil {
+		l.cloud.log(level, fields, message)
+	}
+}
+
+// Close flushes the logger's cloud logs and closes its log file.
+func (l *Logger) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	var closeErr error
+	if l.cloud != nil {
+		closeErr = l.cloud.closeLogger()
+	}
+	for _, closer := range l.closers {
+		if err := closer.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// textLine formats an entry as a line of text with its fields as key=value pairs. Values
+// that contain spaces or quotes are quoted.
+func textLine(level Level, fields []Field, message string) string {
+	var line strings.Builder
+	line.WriteString(level.String())
+	line.WriteString(" ")
+	line.WriteString(message)
+	for _, field := range fields {
+		value := field.stringValue()
+		if len(value) == 0 || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&line, " %s=%s", field.Key, value)
+	}
+	return line.String()
 }
 
-func (l *Logger) logf(format string, v ...interface{}) {
-	l.Logger.Printf(format, v...)
-	if l.CloudLogger != nil {
-		l.CloudLogger.logf(format, v...)
+// jsonLine formats an entry as a JSON object with its time, severity, message and fields.
+func jsonLine(timestamp time.Time, level Level, fields []Field, message string) string {
+	line, err := json.Marshal(payload(fields, map[string]interface{}{
+		"time":     timestamp.Format(time.RFC3339Nano),
+		"severity": level.String(),
+		"message":  message,
+	}))
+	if err != nil {
+		return textLine(level, fields, message)
 	}
+	return string(line)
 }
 
-func (l *Logger) error(v ...interface{}) {
-	l.Logger.Println(v...)
-	if l.CloudLogger != nil {
-		l.CloudLogger.error(v...)
+// payload adds the fields to the given entry properties, without overwriting any of them.
+func payload(fields []Field, properties map[string]interface{}) map[string]interface{} {
+	for _, field := range fields {
+		if _, isSet := properties[field.Key]; !isSet {
+			properties[field.Key] = field.jsonValue()
+		}
 	}
+	return properties
 }
 
 // CloudLogger handles writing logs to stackdriver.
@@ -126,27 +512,27 @@ func createCloudLogger(ctx context.Context, projectID, loggerName string) (*Clou
 	}, nil
 }
 
-func (l *CloudLogger) log(v ...interface{}) {
-	l.Logger.Log(
-		logging.Entry{Payload: fmt.Sprintln(v...)},
-	)
+func (l *CloudLogger) log(level Level, fields []Field, message string) {
+	l.Logger.Log(cloudEntry(level, fields, message))
 }
 
-func (l *CloudLogger) logf(format string, v ...interface{}) {
-	l.Logger.Log(
-		logging.Entry{Payload: fmt.Sprintf(format, v...)},
-	)
-}
-
-func (l *CloudLogger) error(v ...interface{}) {
-	l.Logger.Log(
-		logging.Entry{
-			Payload:  fmt.Sprintln(v...),
-			Severity: logging.Error,
-		},
-	)
+// cloudEntry returns the Cloud Logging entry for a log entry. The message and fields make
+// up a structured payload, and the fields are also added as labels so that entries can be
+// filtered by them.
+func cloudEntry(level Level, fields []Field, message string) logging.Entry {
+	entry := logging.Entry{
+		Payload:  payload(fields, map[string]interface{}{"message": message}),
+		Severity: level.severity(),
+	}
+	if len(fields) > 0 {
+		entry.Labels = make(map[string]string, len(fields))
+		for _, field := range fields {
+			entry.Labels[field.Key] = field.stringValue()
+		}
+	}
+	return entry
 }
 
-func (l *CloudLogger) closeLogger() {
-	l.Client.Close()
+func (l *CloudLogger) closeLogger() error {
+	return l.Client.Close()
 }
@@ -0,0 +1,247 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+type TextLineTestCase struct {
+	Level    Level
+	Fields   []Field
+	Message  string
+	Expected string
+}
+
+var textLineTestCases = []TextLineTestCase{
+	TextLineTestCase{InfoLevel, nil, "Reaper started", "INFO Reaper started"},
+	TextLineTestCase{
+		ErrorLevel,
+		[]Field{Reaper("UUID"), ResourceType(stringer("GCE_VM")), Zone("us-east1-b"), Err(fmt.Errorf("not found"))},
+		"Delete failed",
+		`ERROR Delete failed reaper_uuid=UUID resource_type=GCE_VM zone=us-east1-b error="not found"`,
+	},
+	TextLineTestCase{DebugLevel, []Field{F("count", 3), Resource("")}, "Watching", `DEBUG Watching count=3 resource=""`},
+}
+
+func TestTextLine(t *testing.T) {
+	for _, testCase := range textLineTestCases {
+		if line := textLine(testCase.Level, testCase.Fields, testCase.Message); line != testCase.Expected {
+			t.Errorf("textLine() = %s; want %s", line, testCase.Expected)
+		}
+	}
+}
+
+func TestJSONLine(t *testing.T) {
+	timestamp := time.Date(2020, 6, 17, 10, 0, 0, 0, time.UTC)
+	line := jsonLine(timestamp, WarnLevel, []Field{Project("sampleProject"), F("deleted", 2), F("message", "ignored")}, "Sweep done")
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+		t.Fatalf("jsonLine() = %s is not JSON: %v", line, err)
+	}
+	expected := map[string]interface{}{
+		"time":       "2020-06-17T10:00:00Z",
+		"severity":   "WARN",
+		"message":    "Sweep done",
+		"project_id": "sampleProject",
+		"deleted":    float64(2),
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("jsonLine() = %v; want %v", parsed, expected)
+	}
+}
+
+func TestCloudEntry(t *testing.T) {
+	entry := cloudEntry(ErrorLevel, []Field{Reaper("UUID"), Err(fmt.Errorf("quota exceeded"))}, "Delete failed")
+	if entry.Severity != logging.Error {
+		t.Errorf("Entry severity = %v; want %v", entry.Severity, logging.Error)
+	}
+	expectedPayload := map[string]interface{}{"message": "Delete failed", ReaperKey: "UUID", ErrorKey: "quota exceeded"}
+	if !reflect.DeepEqual(entry.Payload, expectedPayload) {
+		t.Errorf("Entry payload = %v; want %v", entry.Payload, expectedPayload)
+	}
+	expectedLabels := map[string]string{ReaperKey: "UUID", ErrorKey: "quota exceeded"}
+	if !reflect.DeepEqual(entry.Labels, expectedLabels) {
+		t.Errorf("Entry labels = %v; want %v", entry.Labels, expectedLabels)
+	}
+
+	if entry := cloudEntry(InfoLevel, nil, "Started"); entry.Labels != nil || entry.Severity != logging.Info {
+		t.Errorf("Entry without fields = %v; want no labels and info severity", entry)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "INFO", "Warn", "error"} {
+		level, err := ParseLevel(name)
+		if err != nil || !strings.EqualFold(level.String(), name) {
+			t.Errorf("ParseLevel(%s) = %v, %v", name, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("ParseLevel(verbose) did not fail")
+	}
+}
+
+func TestLevelsAndFormats(t *testing.T) {
+	var output bytes.Buffer
+	SetLogger(NewWriterLogger(&output))
+	defer SetLogger(NewWriterLogger(os.Stderr))
+
+	SetLevel(WarnLevel)
+	Debugf("hidden")
+	Logf("hidden\n")
+	With(Reaper("UUID")).Warnf("shown %d", 1)
+	if lines := strings.Split(strings.TrimSpace(output.String()), "\n"); len(lines) != 1 || !strings.HasSuffix(lines[0], "WARN shown 1 reaper_uuid=UUID") {
+		t.Errorf("Logged %q at warn level; want only the warning", output.String())
+	}
+
+	output.Reset()
+	SetLevel(DebugLevel)
+	SetFormat(JSONFormat)
+	Debugf("debug entry\n")
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &parsed); err != nil {
+		t.Fatalf("JSON format logged %q: %v", output.String(), err)
+	}
+	if parsed["message"] != "debug entry" || parsed["severity"] != "DEBUG" {
+		t.Errorf("JSON format logged %v", parsed)
+	}
+}
+
+func TestDefaultLogger(t *testing.T) {
+	Log("logged to stderr before a logger is set")
+	With(Reaper("UUID")).Errorf("logged to stderr before a logger is set")
+
+	SetLogger(Discard)
+	defer SetLogger(NewWriterLogger(os.Stderr))
+	Log("discarded")
+	Close()
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs.txt")
+
+	logFile, err := newRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	currentTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	logFile.now = func() time.Time {
+		currentTime = currentTime.Add(time.Second)
+		return currentTime
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := logFile.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := logFile.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Kept backups %v; want 2", backups)
+	}
+	expectedContents := map[string]string{backups[0]: "second\n", backups[1]: "third\n", path: "fourth\n"}
+	for file, expected := range expectedContents {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != expected {
+			t.Errorf("%s contains %q; want %q", file, contents, expected)
+		}
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs.txt")
+
+	logFile, err := newRotatingFile(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	currentTime := logFile.openedAt
+	logFile.now = func() time.Time { return currentTime }
+
+	logFile.Write([]byte("first\n"))
+	currentTime = currentTime.Add(30 * time.Minute)
+	logFile.Write([]byte("second\n"))
+	if backups, _ := logFile.backups(); len(backups) != 0 {
+		t.Errorf("Rotated %v before the maximum age", backups)
+	}
+	currentTime = currentTime.Add(30 * time.Minute)
+	logFile.Write([]byte("third\n"))
+	if backups, _ := logFile.backups(); len(backups) != 1 {
+		t.Errorf("Kept backups %v after the maximum age; want 1", backups)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs.txt")
+
+	fileLogger, err := New(Options{Path: path, Level: WarnLevel, Format: TextFormat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileLogger.Write(InfoLevel, nil, "hidden")
+	fileLogger.Write(ErrorLevel, []Field{Project("project")}, "shown")
+	if err := fileLogger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(contents)), "\n"); len(lines) != 1 || !strings.HasSuffix(lines[0], "ERROR shown project_id=project") {
+		t.Errorf("Logged %q to the file; want only the error", contents)
+	}
+}
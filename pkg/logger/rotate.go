@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the timestamp appended to the names of rotated files.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// rotatingFile is a log file that is renamed with a timestamp and replaced by a new file
+// once it grows past a maximum size or has been written to for longer than a maximum age.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mux      sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// newRotatingFile opens the log file at the path, appending to it if it already exists.
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	logFile := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := logFile.open(); err != nil {
+		return nil, err
+	}
+	return logFile, nil
+}
+
+// open opens the log file for appending.
+func (logFile *rotatingFile) open() error {
+	file, err := os.OpenFile(logFile.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	logFile.file = file
+	logFile.size = info.Size()
+	logFile.openedAt = logFile.now()
+	return nil
+}
+
+// Write writes to the log file, rotating it first if the write would take it past its
+// maximum size or it has reached its maximum age.
+func (logFile *rotatingFile) Write(p []byte) (int, error) {
+	logFile.mux.Lock()
+	defer logFile.mux.Unlock()
+	if logFile.file == nil {
+		return 0, os.ErrClosed
+	}
+	if logFile.shouldRotate(int64(len(p))) {
+		if err := logFile.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := logFile.file.Write(p)
+	logFile.size += int64(n)
+	return n, err
+}
+
+// shouldRotate returns whether the log file should be rotated before writing the given
+// number of bytes. A file that is empty is never rotated.
+func (logFile *rotatingFile) shouldRotate(writeSize int64) bool {
+	if logFile.size == 0 {
+		return false
+	}
+	if logFile.maxSize > 0 && logFile.size+writeSize > logFile.maxSize {
+		return true
+	}
+	return logFile.maxAge > 0 && logFile.now().Sub(logFile.openedAt) >= logFile.maxAge
+}
+
+// rotate renames the log file with the current time, opens a new log file and removes the
+// oldest rotated files beyond the maximum number of backups.
+func (logFile *rotatingFile) rotate() error {
+	if err := logFile.file.Close(); err != nil {
+		return err
+	}
+	logFile.file = nil
+	backupPath := fmt.Sprintf("%s.%s", logFile.path, logFile.now().UTC().Format(backupTimeFormat))
+	if err := os.Rename(logFile.path, backupPath); err != nil {
+		return err
+	}
+	if err := logFile.open(); err != nil {
+		return err
+	}
+	return logFile.removeOldBackups()
+}
+
+// backups returns the paths of the rotated log files, from oldest to newest.
+func (logFile *rotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(logFile.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, match := range matches {
+		timestamp := strings.TrimPrefix(match, logFile.path+".")
+		if _, err := time.Parse(backupTimeFormat, timestamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// removeOldBackups removes the oldest rotated log files beyond the maximum number of backups.
+func (logFile *rotatingFile) removeOldBackups() error {
+	if logFile.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := logFile.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > logFile.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (logFile *rotatingFile) Close() error {
+	logFile.mux.Lock()
+	defer logFile.mux.Unlock()
+	if logFile.file == nil {
+		return nil
+	}
+	err := logFile.file.Close()
+	logFile.file = nil
+	return err
+}
@@ -16,43 +16,248 @@ package manager
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/audit"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/auth"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"go.opencensus.io/plugin/ocgrpc"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
+// ReaperManagerService is the name of the reaper manager's gRPC service, which the health
+// service reports as serving only while the reaper manager is running.
+const ReaperManagerService = "reaperconfig.ReaperManager"
+
+// managerShutdownTimeout is how long ShutdownManager waits for the reaper manager's sweeps
+// to stop.
+var managerShutdownTimeout = time.Minute
+
 // reaperManagerServer is the gRPC server for interacting with the reaper
 // manager.
 type reaperManagerServer struct {
 	Manager       *ReaperManager
 	clientOptions []option.ClientOption
+	firstSeen     *resources.FirstSeenTracker
+	protection    *resources.ProtectionPolicy
+	eventSink     events.Sink
+	auditLog      *audit.Log
+	roles         *auth.RolePolicy
+	health        *health.Server
+}
+
+// ServerOptions configures the reapers started by the server, and the services it serves
+// alongside the reaper manager.
+type ServerOptions struct {
+	// FirstSeen records when the reapers first saw resources without a creation time.
+	FirstSeen *resources.FirstSeenTracker
+	// Protection is the policy for resources that no reaper may delete.
+	Protection *resources.ProtectionPolicy
+	// EventSink receives the reapers' events. No events are published if it is nil.
+	EventSink events.Sink
+	// AuditLog records the reapers' attempts to delete resources. Nothing is audited if
+	// it is nil.
+	AuditLog *audit.Log
+	// Reflection is set to serve the gRPC server reflection service, so that tools such
+	// as grpcurl can discover the server's services.
+	Reflection bool
+	// TLS is the TLS config the server is served with. The server is served without TLS
+	// if it is nil.
+	TLS *tls.Config
+	// Auth authenticates and authorizes the requests to the server. Requests are not
+	// authenticated if it is nil.
+	Auth *auth.Interceptor
+	// Roles scopes the reapers that each authenticated principal may manage to the projects
+	// that it has roles in. Every request is allowed if it is nil.
+	Roles *auth.RolePolicy
+	// ForceStop is closed to stop the server straight away while it is shutting down,
+	// cancelling the requests in progress instead of waiting for them and for the reaper
+	// manager's sweeps. The server always shuts down gracefully if it is nil.
+	ForceStop <-chan struct{}
 }
 
-// StartServer starts the gRPC server listing on the given address and port.
-func StartServer(port string, clientOptions ...option.ClientOption) {
+// StartServer starts the gRPC server listing on the given address and port, along with the
+// standard gRPC health service. The health of the empty service name reports whether the
+// server is up, and the health of ReaperManagerService reports whether the reaper manager
+// is running. Once the context is cancelled, the server stops accepting requests, waits for
+// the requests in progress to finish and shuts down the reaper manager, whose sweeps stop
+// at their next safe point. Closing the options' ForceStop cuts this wait short. An error
+// is returned if the server could not listen or failed while serving.
+func StartServer(ctx context.Context, port string, serverOptions ServerOptions, clientOptions ...option.ClientOption) error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
-		logger.Error(err)
-		os.Exit(1)
+		return err
 	}
 
 	logger.Logf("------------------ Starting gRPC Server on :%s ------------------\n", port)
 	defer logger.Log("------------------ Shutting down gRPC Server ------------------")
 
-	server := grpc.NewServer()
-	reaperconfig.RegisterReaperManagerServer(server, &reaperManagerServer{})
-	server.Serve(lis)
+	grpcOptions := []grpc.ServerOption{grpc.StatsHandler(&ocgrpc.ServerHandler{})}
+	if serverOptions.TLS != nil {
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(serverOptions.TLS)))
+	} else {
+		logger.Warnf("Serving gRPC without TLS, so requests and their credentials are not encrypted")
+	}
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(ReaperManagerService, healthpb.HealthCheckResponse_NOT_SERVING)
+	managerServer := &reaperManagerServer{
+		clientOptions: clientOptions,
+		firstSeen:     serverOptions.FirstSeen,
+		protection:    serverOptions.Protection,
+		eventSink:     serverOptions.EventSink,
+		auditLog:      serverOptions.AuditLog,
+		roles:         serverOptions.Roles,
+		health:        healthServer,
+	}
+	if serverOptions.Auth != nil {
+		serverOptions.Auth.SetDenialHandler(managerServer.recordInterceptorDenial)
+		grpcOptions = append(grpcOptions, serverOptions.Auth.Unary(), serverOptions.Auth.Stream())
+	}
+	server := grpc.NewServer(grpcOptions...)
+	reaperconfig.RegisterReaperManagerServer(server, managerServer)
+	healthpb.RegisterHealthServer(server, healthServer)
+	if serverOptions.Reflection {
+		reflection.Register(server)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(lis)
+	}()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Log("Draining gRPC server")
+	healthServer.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		managerServer.stopManager()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-serverOptions.ForceStop:
+		logger.Log("Forcing gRPC server to stop")
+		server.Stop()
+	}
+	return nil
+}
+
+// stopManager shuts down the reaper manager if it is running, and waits for its sweeps to
+// stop.
+func (s *reaperManagerServer) stopManager() {
+	if s.Manager == nil {
+		return
+	}
+	s.Manager.Shutdown()
+	s.Manager.Wait()
+	s.Manager = nil
+}
+
+// setManagerHealth sets the health of ReaperManagerService, if the server has a health
+// service.
+func (s *reaperManagerServer) setManagerHealth(status healthpb.HealthCheckResponse_ServingStatus) {
+	if s.health != nil {
+		s.health.SetServingStatus(ReaperManagerService, status)
+	}
+}
+
+// authorize checks that the principal of the request has the role in the project, for a
+// call to the method on the reaper with the given UUID. Denied requests are logged and
+// recorded in the audit log.
+func (s *reaperManagerServer) authorize(ctx context.Context, method string, role auth.Role, reaperUUID, projectID string) error {
+	if s.roles == nil {
+		return nil
+	}
+	principal, isAuthenticated := auth.PrincipalFromContext(ctx)
+	if isAuthenticated && s.roles.Allows(principal, role, projectID) {
+		return nil
+	}
+
+	code, reason := codes.PermissionDenied, fmt.Sprintf("%s requires the %s role in project %s", method, role, projectID)
+	if !isAuthenticated {
+		code, reason = codes.Unauthenticated, fmt.Sprintf("%s requires an authenticated principal", method)
+	} else if projectID == auth.AllProjects {
+		reason = fmt.Sprintf("%s requires the %s role in all projects", method, role)
+	}
+	logger.With(
+		logger.F("method", method), logger.F("principal", principal), logger.F("project", projectID),
+	).Warnf("Denied %s from calling %s: %s", principal, method, reason)
+	s.recordDenial(principal, method, reaperUUID, projectID, errors.New(reason))
+	return status.Error(code, reason)
+}
+
+// recordInterceptorDenial records a request denied by the server's auth interceptor in the
+// audit log. The interceptor runs before the request is decoded, so the record has no reaper
+// or project.
+func (s *reaperManagerServer) recordInterceptorDenial(principal, fullMethod string, err error) {
+	s.recordDenial(principal, fullMethod[strings.LastIndex(fullMethod, "/")+1:], "", "", err)
+}
+
+// recordDenial records a denied request in the audit log, if the server has one.
+func (s *reaperManagerServer) recordDenial(principal, method, reaperUUID, projectID string, err error) {
+	if s.auditLog == nil {
+		return
+	}
+	record := audit.NewDenialRecord(principal, method, reaperUUID, projectID, err, time.Now())
+	if err := s.auditLog.Record(record); err != nil {
+		logger.Error(fmt.Errorf("Recording denial of %s in the audit log failed: %v", method, err))
+	}
+}
+
+// canView returns whether the principal of the request may view the reapers and audit records
+// of the project.
+func (s *reaperManagerServer) canView(ctx context.Context, projectID string) bool {
+	if s.roles == nil {
+		return true
+	}
+	principal, isAuthenticated := auth.PrincipalFromContext(ctx)
+	return isAuthenticated && s.roles.Allows(principal, auth.Viewer, projectID)
+}
+
+// authorizeConfig checks that the principal of the request may call the method with the reaper
+// config. The principal must be an operator in each of the projects that the config names. A config
+// that finds its projects through a parent or project filter, or that sets the reaper's credentials,
+// can reach projects that it does not name, so it requires the operator role in all projects.
+func (s *reaperManagerServer) authorizeConfig(ctx context.Context, method string, config *reaperconfig.ReaperConfig) error {
+	projectIDs := append([]string{config.GetProjectId()}, config.GetProjectIds()...)
+	for _, projectID := range projectIDs {
+		if err := s.authorize(ctx, method, auth.Operator, config.GetUuid(), projectID); err != nil {
+			return err
+		}
+	}
+	if len(config.GetParent()) > 0 || len(config.GetProjectFilter()) > 0 || config.GetCredentials() != nil {
+		return s.authorize(ctx, method, auth.Operator, config.GetUuid(), auth.AllProjects)
+	}
+	return nil
 }
 
 // AddReaper adds a new reaper to the manager with the given config, and returns the UUID if the
-// add was successful.
+// add was successful. The principal must be authorized for the config, as checked by authorizeConfig.
 func (s *reaperManagerServer) AddReaper(ctx context.Context, config *reaperconfig.ReaperConfig) (*reaperconfig.Reaper, error) {
+	if err := s.authorizeConfig(ctx, "AddReaper", config); err != nil {
+		return nil, err
+	}
 	if s.Manager == nil {
 		return nil, fmt.Errorf("Reaper manager not started")
 	}
@@ -61,40 +266,62 @@ func (s *reaperManagerServer) AddReaper(ctx context.Context, config *reaperconfi
 		err := fmt.Errorf("Reaper with UUID %s already exists", watchedReaper.UUID)
 		return nil, err
 	}
-	s.Manager.AddReaperFromConfig(config)
+	s.Manager.AddReaperFromConfig(ctx, config)
 	return &reaperconfig.Reaper{Uuid: config.GetUuid()}, nil
 }
 
 // UpdateReaper updates the reaper with the UUID given in the config with the data in the config, and returns
-// the UUID if the update was successful.
+// the UUID if the update was successful. The principal must be authorized for both the new config and
+// the reaper's current config, as checked by authorizeConfig.
 func (s *reaperManagerServer) UpdateReaper(ctx context.Context, config *reaperconfig.ReaperConfig) (*reaperconfig.Reaper, error) {
+	if err := s.authorizeConfig(ctx, "UpdateReaper", config); err != nil {
+		return nil, err
+	}
 	if s.Manager == nil {
 		return nil, fmt.Errorf("Reaper manager not started")
 	}
 
-	if watchedReaper := s.Manager.GetReaper(config.GetUuid()); watchedReaper == nil {
-		err := fmt.Errorf("Reaper with UUID %s does not exist", watchedReaper.UUID)
+	watchedReaper := s.Manager.GetReaper(config.GetUuid())
+	if watchedReaper == nil {
+		err := fmt.Errorf("Reaper with UUID %s does not exist", config.GetUuid())
+		return nil, err
+	}
+	if currentConfig := watchedReaper.Config(); currentConfig != nil {
+		if err := s.authorizeConfig(ctx, "UpdateReaper", currentConfig); err != nil {
+			return nil, err
+		}
+	} else if err := s.authorize(ctx, "UpdateReaper", auth.Operator, watchedReaper.UUID, watchedReaper.ProjectID); err != nil {
 		return nil, err
 	}
-	s.Manager.UpdateReaper(config)
+	s.Manager.UpdateReaper(ctx, config)
 	return &reaperconfig.Reaper{Uuid: config.GetUuid()}, nil
 }
 
 // DeleteReaper deletes the reaper with the given UUID, and returns the UUID if the delete was successful.
+// The principal must be authorized for the reaper's current config, as checked by authorizeConfig.
 func (s *reaperManagerServer) DeleteReaper(ctx context.Context, reaperToDelete *reaperconfig.Reaper) (*reaperconfig.Reaper, error) {
 	if s.Manager == nil {
 		return nil, fmt.Errorf("Reaper manager not started")
 	}
 
-	if watchedReaper := s.Manager.GetReaper(reaperToDelete.GetUuid()); watchedReaper == nil {
+	watchedReaper := s.Manager.GetReaper(reaperToDelete.GetUuid())
+	if watchedReaper == nil {
 		err := fmt.Errorf("Reaper with UUID %s does not exist", reaperToDelete.GetUuid())
 		return nil, err
 	}
+	if currentConfig := watchedReaper.Config(); currentConfig != nil {
+		if err := s.authorizeConfig(ctx, "DeleteReaper", currentConfig); err != nil {
+			return nil, err
+		}
+	} else if err := s.authorize(ctx, "DeleteReaper", auth.Operator, watchedReaper.UUID, watchedReaper.ProjectID); err != nil {
+		return nil, err
+	}
 	s.Manager.DeleteReaper(reaperToDelete.GetUuid())
 	return &reaperconfig.Reaper{Uuid: reaperToDelete.GetUuid()}, nil
 }
 
-// ListRunningReapers returns a list of UUIDs of all the running reapers.
+// ListRunningReapers returns a list of UUIDs of the running reapers in the projects that the principal
+// is a viewer in.
 func (s *reaperManagerServer) ListRunningReapers(ctx context.Context, req *empty.Empty) (*reaperconfig.ReaperCluster, error) {
 	if s.Manager == nil {
 		return nil, fmt.Errorf("Reaper manager not started")
@@ -102,6 +329,9 @@ func (s *reaperManagerServer) ListRunningReapers(ctx context.Context, req *empty
 
 	reaperCluster := &reaperconfig.ReaperCluster{}
 	for _, watchedReaper := range s.Manager.Reapers {
+		if !s.canView(ctx, watchedReaper.ProjectID) {
+			continue
+		}
 		reaper := &reaperconfig.Reaper{Uuid: watchedReaper.UUID}
 		reaperCluster.Reapers = append(reaperCluster.Reapers, reaper)
 	}
@@ -109,22 +339,67 @@ func (s *reaperManagerServer) ListRunningReapers(ctx context.Context, req *empty
 }
 
 // StartManager begins the reaper manager process. This must be called before any reaper operations
-// are invokved.
+// are invokved. The principal must be an admin in all projects.
 func (s *reaperManagerServer) StartManager(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	if err := s.authorize(ctx, "StartManager", auth.Admin, "", auth.AllProjects); err != nil {
+		return new(empty.Empty), err
+	}
 	if s.Manager != nil {
 		return new(empty.Empty), fmt.Errorf("reaper manager already running")
 	}
 	s.Manager = NewReaperManager(context.Background(), s.clientOptions...)
+	if s.firstSeen != nil {
+		s.Manager.SetFirstSeenTracker(s.firstSeen)
+	}
+	s.Manager.SetProtectionPolicy(s.protection)
+	s.Manager.SetEventSink(s.eventSink)
+	s.Manager.SetAuditLog(s.auditLog)
 	go s.Manager.MonitorReapers()
+	s.setManagerHealth(healthpb.HealthCheckResponse_SERVING)
 	return new(empty.Empty), nil
 }
 
-// ShutdownManager ends the reaper manager process. This deletes all currently running reapers.
+// ShutdownManager ends the reaper manager process. This deletes all currently running reapers, and
+// waits up to managerShutdownTimeout for their sweeps to stop. The principal must be an admin in all
+// projects.
 func (s *reaperManagerServer) ShutdownManager(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	if err := s.authorize(ctx, "ShutdownManager", auth.Admin, "", auth.AllProjects); err != nil {
+		return new(empty.Empty), err
+	}
 	if s.Manager == nil {
 		return new(empty.Empty), fmt.Errorf("reaper manager already shutdown")
 	}
-	s.Manager.Shutdown()
+	s.setManagerHealth(healthpb.HealthCheckResponse_NOT_SERVING)
+	manager := s.Manager
+	manager.Shutdown()
 	s.Manager = nil
+	if !manager.WaitTimeout(managerShutdownTimeout) {
+		return new(empty.Empty), status.Errorf(codes.DeadlineExceeded, "reaper manager was shut down, but its sweeps did not stop within %s", managerShutdownTimeout)
+	}
 	return new(empty.Empty), nil
 }
+
+// QueryAuditLog returns the records in the server's audit log that match the query, from the
+// projects that the principal is a viewer in. A query for a single project requires the principal
+// to be a viewer in it. The audit log can be queried whether or not the reaper manager is running.
+func (s *reaperManagerServer) QueryAuditLog(ctx context.Context, query *reaperconfig.AuditLogQuery) (*reaperconfig.AuditLog, error) {
+	if len(query.GetProjectId()) > 0 {
+		if err := s.authorize(ctx, "QueryAuditLog", auth.Viewer, query.GetReaperUuid(), query.GetProjectId()); err != nil {
+			return nil, err
+		}
+	}
+	if s.auditLog == nil {
+		return nil, fmt.Errorf("Audit log not configured")
+	}
+	records, err := s.auditLog.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	auditLog := &reaperconfig.AuditLog{}
+	for _, record := range records {
+		if s.canView(ctx, record.GetResource().GetProjectId()) {
+			auditLog.Records = append(auditLog.Records, record)
+		}
+	}
+	return auditLog, nil
+}
@@ -16,17 +16,30 @@ package manager
 
 import (
 	"context"
+	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/audit"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/auth"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -138,3 +151,423 @@ func TestShutdownManager(t *testing.T) {
 		t.Fatalf("Failed to shutdown manager: %v", err)
 	}
 }
+
+func TestShutdownManagerTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { managerShutdownTimeout = timeout }(managerShutdownTimeout)
+	managerShutdownTimeout = 10 * time.Millisecond
+
+	// The manager is never monitoring reapers, so it never finishes shutting down.
+	server := &reaperManagerServer{Manager: NewReaperManager(testContext)}
+	if _, err := server.ShutdownManager(testContext, new(empty.Empty)); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Shutting down a manager that does not stop returned error %v; want DeadlineExceeded", err)
+	}
+	if server.Manager != nil {
+		t.Errorf("Manager still set after it was shut down")
+	}
+}
+
+func TestQueryAuditLog(t *testing.T) {
+	conn, err := grpc.DialContext(testContext, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+	client := reaperconfig.NewReaperManagerClient(conn)
+
+	if _, err := client.QueryAuditLog(testContext, &reaperconfig.AuditLogQuery{}); err == nil {
+		t.Errorf("Querying without an audit log did not fail")
+	}
+
+	auditLog, _ := audit.NewLog("")
+	server := &reaperManagerServer{auditLog: auditLog}
+	for _, name := range []string{"TestResource", "OtherResource"} {
+		resource := resources.NewResource(name, "testZone", time.Now(), reaperconfig.ResourceType_GCE_VM)
+		watchedResource := resources.NewWatchedResource(resource, "@every 1h")
+		auditLog.Record(audit.NewRecord("TestReaper", "project", watchedResource, reaperconfig.AuditOutcome_DELETED, nil, time.Now()))
+	}
+	result, err := server.QueryAuditLog(testContext, &reaperconfig.AuditLogQuery{ResourceFilter: "^Test"})
+	if err != nil {
+		t.Fatalf("Query audit log failed: %v", err)
+	}
+	if len(result.GetRecords()) != 1 || result.GetRecords()[0].GetResource().GetName() != "TestResource" {
+		t.Errorf("Query audit log returned %v; want the record of TestResource", result.GetRecords())
+	}
+}
+
+// freePort returns a port that is free to listen on.
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestStartServerHealthAndShutdown(t *testing.T) {
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(testContext)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- StartServer(ctx, port, ServerOptions{Reflection: true})
+	}()
+
+	conn, err := grpc.DialContext(testContext, "localhost:"+port, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Failed to dial server: %v", err)
+	}
+	defer conn.Close()
+	healthClient := healthpb.NewHealthClient(conn)
+	checkHealth := func(service string, expected healthpb.HealthCheckResponse_ServingStatus) {
+		resp, err := healthClient.Check(testContext, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Health check of %q failed: %v", service, err)
+		}
+		if resp.GetStatus() != expected {
+			t.Errorf("Health of %q = %s; want %s", service, resp.GetStatus(), expected)
+		}
+	}
+	checkHealth("", healthpb.HealthCheckResponse_SERVING)
+	checkHealth(ReaperManagerService, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	client := reaperconfig.NewReaperManagerClient(conn)
+	if _, err := client.StartManager(testContext, new(empty.Empty)); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	checkHealth(ReaperManagerService, healthpb.HealthCheckResponse_SERVING)
+	if _, err := client.ShutdownManager(testContext, new(empty.Empty)); err != nil {
+		t.Fatalf("Failed to shutdown manager: %v", err)
+	}
+	checkHealth(ReaperManagerService, healthpb.HealthCheckResponse_NOT_SERVING)
+	client.StartManager(testContext, new(empty.Empty))
+
+	cancel()
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			t.Errorf("Server stopped with error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Server did not stop after its context was cancelled")
+	}
+}
+
+func TestStartServerForceStop(t *testing.T) {
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(testContext)
+	forceStop := make(chan struct{})
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- StartServer(ctx, port, ServerOptions{ForceStop: forceStop})
+	}()
+
+	conn, err := grpc.DialContext(testContext, "localhost:"+port, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Failed to dial server: %v", err)
+	}
+	defer conn.Close()
+	// The open health watch keeps the server from stopping gracefully.
+	watch, err := healthpb.NewHealthClient(conn).Watch(testContext, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Failed to watch health: %v", err)
+	}
+	watch.Recv()
+
+	cancel()
+	select {
+	case <-serverErr:
+		t.Fatalf("Server stopped gracefully with a request in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(forceStop)
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			t.Errorf("Server stopped with error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Server did not stop after it was forced to")
+	}
+}
+
+func TestStartServerListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	if err := StartServer(testContext, port, ServerOptions{}); err == nil {
+		t.Errorf("Starting server on a port in use did not fail")
+	}
+}
+
+func TestStartServerWithTLSAndAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certificates, err := utils.CreateTestCertificates(dir, "client@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTLS, err := auth.ServerTLSConfig(certificates.ServerCert, certificates.ServerKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := auth.NewStaticTokenAuthenticator(map[string]string{"alice-token": "alice", "bob-token": "bob"})
+	policy := &auth.MethodPolicy{Methods: map[string][]string{"StartManager": []string{"alice"}, auth.AnyPrincipal: []string{auth.AnyPrincipal}}}
+
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(testContext)
+	defer cancel()
+	auditLog, _ := audit.NewLog("")
+	go StartServer(ctx, port, ServerOptions{TLS: serverTLS, Auth: auth.NewInterceptor(authenticator, policy), AuditLog: auditLog})
+
+	clientTLS, err := auth.ClientTLSConfig(certificates.CA, "", "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func(token string) *grpc.ClientConn {
+		dialOptions := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)), grpc.WithBlock()}
+		if len(token) > 0 {
+			tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token, TokenType: "Bearer"})
+			dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(oauth.TokenSource{TokenSource: tokenSource}))
+		}
+		conn, err := grpc.DialContext(testContext, "localhost:"+port, dialOptions...)
+		if err != nil {
+			t.Fatalf("Failed to dial server: %v", err)
+		}
+		return conn
+	}
+
+	anonymousConn := dial("")
+	defer anonymousConn.Close()
+	if _, err := healthpb.NewHealthClient(anonymousConn).Check(testContext, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Unauthenticated health check failed: %v", err)
+	}
+	_, err = reaperconfig.NewReaperManagerClient(anonymousConn).StartManager(testContext, new(empty.Empty))
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Unauthenticated StartManager returned %v; want Unauthenticated", err)
+	}
+
+	bobConn := dial("bob-token")
+	defer bobConn.Close()
+	_, err = reaperconfig.NewReaperManagerClient(bobConn).StartManager(testContext, new(empty.Empty))
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StartManager by bob returned %v; want PermissionDenied", err)
+	}
+
+	aliceConn := dial("alice-token")
+	defer aliceConn.Close()
+	aliceClient := reaperconfig.NewReaperManagerClient(aliceConn)
+	if _, err := aliceClient.StartManager(testContext, new(empty.Empty)); err != nil {
+		t.Errorf("StartManager by alice failed: %v", err)
+	}
+	if _, err := reaperconfig.NewReaperManagerClient(bobConn).ListRunningReapers(testContext, new(empty.Empty)); err != nil {
+		t.Errorf("ListRunningReapers by bob failed: %v", err)
+	}
+	aliceClient.ShutdownManager(testContext, new(empty.Empty))
+
+	records, err := auditLog.Query(&reaperconfig.AuditLogQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var denials []string
+	for _, record := range records {
+		if record.GetOutcome() == reaperconfig.AuditOutcome_DENIED {
+			denials = append(denials, record.GetPrincipal()+" "+record.GetMethod())
+		}
+	}
+	if expected := []string{" StartManager", "bob StartManager"}; !reflect.DeepEqual(denials, expected) {
+		t.Errorf("Audit log recorded denials %v; want %v", denials, expected)
+	}
+}
+
+type RoleBasedAccessTestCase struct {
+	Principal    string
+	Call         func(context.Context, *reaperManagerServer) error
+	ExpectedCode codes.Code
+}
+
+func TestRoleBasedAccess(t *testing.T) {
+	auditLog, _ := audit.NewLog("")
+	server := &reaperManagerServer{
+		auditLog: auditLog,
+		roles: &auth.RolePolicy{Bindings: []auth.RoleBinding{
+			{Principal: "alice@example.com", Role: auth.Operator, Projects: []string{"team-a"}},
+			{Principal: "bob@example.com", Role: auth.Viewer, Projects: []string{"team-a", "team-b"}},
+			{Principal: "admin@example.com", Role: auth.Admin, Projects: []string{auth.AllProjects}},
+		}},
+	}
+	server.Manager = NewReaperManager(testContext)
+	for _, config := range []*reaperconfig.ReaperConfig{
+		reaper.NewReaperConfig(nil, "@every 1h", "team-a", "ReaperA"),
+		reaper.NewReaperConfig(nil, "@every 1h", "team-b", "ReaperB"),
+	} {
+		watchedReaper := reaper.NewReaper()
+		if err := watchedReaper.UpdateReaperConfig(config); err != nil {
+			t.Fatal(err)
+		}
+		server.Manager.Reapers = append(server.Manager.Reapers, watchedReaper)
+	}
+	go server.Manager.MonitorReapers()
+	defer server.Manager.Shutdown()
+	principalContext := func(principal string) context.Context {
+		if len(principal) == 0 {
+			return testContext
+		}
+		return auth.WithPrincipal(testContext, principal)
+	}
+
+	expectedReapers := map[string][]string{
+		"alice@example.com": []string{"ReaperA"},
+		"bob@example.com":   []string{"ReaperA", "ReaperB"},
+		"admin@example.com": []string{"ReaperA", "ReaperB"},
+		"carol@example.com": nil,
+	}
+	for principal, expected := range expectedReapers {
+		reaperCluster, err := server.ListRunningReapers(principalContext(principal), new(empty.Empty))
+		if err != nil {
+			t.Fatalf("List running reapers failed: %v", err)
+		}
+		var uuids []string
+		for _, listedReaper := range reaperCluster.GetReapers() {
+			uuids = append(uuids, listedReaper.GetUuid())
+		}
+		if strings.Join(uuids, ",") != strings.Join(expected, ",") {
+			t.Errorf("List running reapers for %s returned %v; want %v", principal, uuids, expected)
+		}
+	}
+
+	addReaper := func(projectID, uuid string) func(context.Context, *reaperManagerServer) error {
+		return func(ctx context.Context, s *reaperManagerServer) error {
+			_, err := s.AddReaper(ctx, reaper.NewReaperConfig(nil, "@every 1h", projectID, uuid))
+			return err
+		}
+	}
+	updateReaper := func(projectID, uuid string) func(context.Context, *reaperManagerServer) error {
+		return func(ctx context.Context, s *reaperManagerServer) error {
+			_, err := s.UpdateReaper(ctx, reaper.NewReaperConfig(nil, "@every 2h", projectID, uuid))
+			return err
+		}
+	}
+	// withConfig calls the method with a config for ReaperA in team-a that is changed by setConfig.
+	withConfig := func(method func(*reaperManagerServer, context.Context, *reaperconfig.ReaperConfig) (*reaperconfig.Reaper, error), setConfig func(*reaperconfig.ReaperConfig)) func(context.Context, *reaperManagerServer) error {
+		return func(ctx context.Context, s *reaperManagerServer) error {
+			config := reaper.NewReaperConfig(nil, "@every 2h", "team-a", "ReaperA")
+			setConfig(config)
+			_, err := method(s, ctx, config)
+			return err
+		}
+	}
+	widenings := []func(*reaperconfig.ReaperConfig){
+		func(config *reaperconfig.ReaperConfig) { config.ProjectIds = []string{"team-a", "team-b"} },
+		func(config *reaperconfig.ReaperConfig) { config.Parent = "folders/123" },
+		func(config *reaperconfig.ReaperConfig) { config.ProjectFilter = "^team-" },
+		func(config *reaperconfig.ReaperConfig) {
+			config.Credentials = &reaperconfig.Credentials{ImpersonateServiceAccount: "reaper@team-b.iam.gserviceaccount.com"}
+		},
+	}
+	var widenedConfigCases []RoleBasedAccessTestCase
+	for _, widening := range widenings {
+		widenedConfigCases = append(widenedConfigCases,
+			RoleBasedAccessTestCase{"alice@example.com", withConfig((*reaperManagerServer).AddReaper, widening), codes.PermissionDenied},
+			RoleBasedAccessTestCase{"alice@example.com", withConfig((*reaperManagerServer).UpdateReaper, widening), codes.PermissionDenied},
+		)
+	}
+
+	testCases := append(widenedConfigCases, []RoleBasedAccessTestCase{
+		{"", addReaper("team-a", "ReaperC"), codes.Unauthenticated},
+		{"alice@example.com", addReaper("team-b", "ReaperC"), codes.PermissionDenied},
+		{"bob@example.com", addReaper("team-a", "ReaperC"), codes.PermissionDenied},
+		{"alice@example.com", updateReaper("team-a", "ReaperB"), codes.PermissionDenied},
+		{"alice@example.com", func(ctx context.Context, s *reaperManagerServer) error {
+			_, err := s.DeleteReaper(ctx, &reaperconfig.Reaper{Uuid: "ReaperB"})
+			return err
+		}, codes.PermissionDenied},
+		{"alice@example.com", func(ctx context.Context, s *reaperManagerServer) error {
+			_, err := s.ShutdownManager(ctx, new(empty.Empty))
+			return err
+		}, codes.PermissionDenied},
+		{"alice@example.com", func(ctx context.Context, s *reaperManagerServer) error {
+			_, err := s.QueryAuditLog(ctx, &reaperconfig.AuditLogQuery{ProjectId: "team-b"})
+			return err
+		}, codes.PermissionDenied},
+		{"alice@example.com", updateReaper("team-a", "ReaperA"), codes.OK},
+		{"alice@example.com", addReaper("team-a", "ReaperC"), codes.OK},
+	}...)
+	for i, testCase := range testCases {
+		err := testCase.Call(principalContext(testCase.Principal), server)
+		if code := status.Code(err); code != testCase.ExpectedCode {
+			t.Errorf("Call %d by %q returned %v; want code %v", i, testCase.Principal, err, testCase.ExpectedCode)
+		}
+	}
+
+	result, err := server.QueryAuditLog(principalContext("admin@example.com"), &reaperconfig.AuditLogQuery{})
+	if err != nil {
+		t.Fatalf("Query audit log failed: %v", err)
+	}
+	if len(result.GetRecords()) != 15 {
+		t.Fatalf("Audit log has %d records; want 15 denials", len(result.GetRecords()))
+	}
+	for _, record := range result.GetRecords() {
+		if record.GetOutcome() != reaperconfig.AuditOutcome_DENIED {
+			t.Errorf("Audit record %v has outcome %v; want DENIED", record, record.GetOutcome())
+		}
+	}
+	if record := result.GetRecords()[11]; record.GetPrincipal() != "alice@example.com" || record.GetMethod() != "UpdateReaper" ||
+		record.GetReaperUuid() != "ReaperB" || record.GetResource().GetProjectId() != "team-b" {
+		t.Errorf("Audit record of denied update is %v; want alice@example.com denied UpdateReaper of ReaperB in team-b", record)
+	}
+
+	result, err = server.QueryAuditLog(principalContext("alice@example.com"), &reaperconfig.AuditLogQuery{})
+	if err != nil {
+		t.Fatalf("Query audit log failed: %v", err)
+	}
+	for _, record := range result.GetRecords() {
+		if record.GetResource().GetProjectId() != "team-a" {
+			t.Errorf("Audit log query by alice@example.com returned record %v from outside team-a", record)
+		}
+	}
+	if len(result.GetRecords()) != 2 {
+		t.Errorf("Audit log query by alice@example.com returned %d records; want 2", len(result.GetRecords()))
+	}
+}
+
+func TestDeleteReaperAuthorizesConfig(t *testing.T) {
+	auditLog, _ := audit.NewLog("")
+	server := &reaperManagerServer{
+		auditLog: auditLog,
+		roles: &auth.RolePolicy{Bindings: []auth.RoleBinding{
+			{Principal: "alice@example.com", Role: auth.Operator, Projects: []string{"team-a"}},
+		}},
+	}
+	server.Manager = NewReaperManager(testContext)
+	widenedConfig := reaper.NewReaperConfig(nil, "@every 1h", "team-a", "ReaperW")
+	widenedConfig.ProjectIds = []string{"team-a", "team-b"}
+	for _, config := range []*reaperconfig.ReaperConfig{
+		reaper.NewReaperConfig(nil, "@every 1h", "team-a", "ReaperA"),
+		widenedConfig,
+	} {
+		watchedReaper := reaper.NewReaper()
+		if err := watchedReaper.UpdateReaperConfig(config); err != nil {
+			t.Fatal(err)
+		}
+		server.Manager.Reapers = append(server.Manager.Reapers, watchedReaper)
+	}
+	go server.Manager.MonitorReapers()
+	defer server.Manager.Shutdown()
+
+	ctx := auth.WithPrincipal(testContext, "alice@example.com")
+	if _, err := server.DeleteReaper(ctx, &reaperconfig.Reaper{Uuid: "ReaperW"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Deleting a reaper that also watches team-b returned %v; want code %v", err, codes.PermissionDenied)
+	}
+	if server.Manager.GetReaper("ReaperW") == nil {
+		t.Errorf("Reaper ReaperW was deleted by a principal that is not an operator in team-b")
+	}
+	if _, err := server.DeleteReaper(ctx, &reaperconfig.Reaper{Uuid: "ReaperA"}); err != nil {
+		t.Errorf("Deleting a reaper in team-a failed: %v", err)
+	}
+}
@@ -20,9 +20,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/audit"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/metrics"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"go.opencensus.io/trace"
 	"google.golang.org/api/option"
 )
 
@@ -31,22 +36,39 @@ type ReaperManager struct {
 	Reapers []*reaper.Reaper
 
 	ctx           context.Context
+	cancel        context.CancelFunc
 	clientOptions []option.ClientOption
+	firstSeen     *resources.FirstSeenTracker
+	protection    *resources.ProtectionPolicy
+	eventSink     events.Sink
+	auditLog      *audit.Log
 	newReaper     chan *reaper.Reaper
 	deleteReaper  chan string
-	updateReaper  chan *reaperconfig.ReaperConfig
+	updateReaper  chan reaperUpdate
 	quit          chan bool
+	done          chan struct{}
 }
 
-// NewReaperManager creates a new reaper manager.
+// reaperUpdate is a request to update a reaper from a config, along with the span of the
+// request.
+type reaperUpdate struct {
+	config *reaperconfig.ReaperConfig
+	span   trace.SpanContext
+}
+
+// NewReaperManager creates a new reaper manager. The manager's reapers stop their sweeps at
+// the next safe point once the context is cancelled or the manager is shut down.
 func NewReaperManager(ctx context.Context, clientOptions ...option.ClientOption) *ReaperManager {
+	ctx, cancel := context.WithCancel(ctx)
 	return &ReaperManager{
 		ctx:           ctx,
+		cancel:        cancel,
 		clientOptions: clientOptions,
 		newReaper:     make(chan *reaper.Reaper, 3),
 		deleteReaper:  make(chan string, 3),
-		updateReaper:  make(chan *reaperconfig.ReaperConfig, 3),
+		updateReaper:  make(chan reaperUpdate, 3),
 		quit:          make(chan bool, 1),
+		done:          make(chan struct{}),
 	}
 }
 
@@ -56,12 +78,16 @@ func NewReaperManager(ctx context.Context, clientOptions ...option.ClientOption)
 // should be stopped. Note that MonitorReapers should be called in a separate
 // goroutine.
 func (manager *ReaperManager) MonitorReapers() {
+	defer close(manager.done)
 	logger.Log("Starting Reaper Manager")
 	for {
 		select {
 		case <-manager.quit:
 			logger.Log("Quitting reaper manager")
 			return
+		case <-manager.ctx.Done():
+			logger.Log("Quitting reaper manager")
+			return
 		default:
 			manager.sweepReapers()
 		}
@@ -75,23 +101,39 @@ func (manager *ReaperManager) MonitorReapers() {
 func (manager *ReaperManager) sweepReapers() {
 	select {
 	case newReaper := <-manager.newReaper:
+		if manager.firstSeen != nil {
+			newReaper.SetFirstSeenTracker(manager.firstSeen)
+		}
+		newReaper.SetProtectionPolicy(manager.protection)
+		newReaper.SetEventSink(manager.eventSink)
+		newReaper.SetAuditLog(manager.auditLog)
 		manager.Reapers = append(manager.Reapers, newReaper)
+		metrics.SetReaperCount(len(manager.Reapers))
+		manager.publishConfigChange(newReaper.UUID, newReaper.Config())
 		logger.Logf("Added new reaper with UUID: %s", newReaper.UUID)
 	case reaperUUID := <-manager.deleteReaper:
 		deleteSuccess := manager.handleDeleteReaper(reaperUUID)
 		if deleteSuccess {
+			metrics.SetReaperCount(len(manager.Reapers))
+			metrics.ForgetReaper(reaperUUID)
+			manager.publishConfigChange(reaperUUID, nil)
 			logger.Logf("Reaper with UUID %s successfully deleted", reaperUUID)
 		} else {
 			logger.Logf("Reaper with UUID %s does not exist", reaperUUID)
 		}
-	case newReaperConfig := <-manager.updateReaper:
-		err := manager.handleUpdateReaper(newReaperConfig)
+	case update := <-manager.updateReaper:
+		err := manager.handleUpdateReaper(update)
 		if err != nil {
 			logger.Error(err)
+		} else {
+			manager.publishConfigChange(update.config.GetUuid(), update.config)
 		}
-		logger.Logf("Reaper with UUID %s successfully updated", newReaperConfig.Uuid)
+		logger.Logf("Reaper with UUID %s successfully updated", update.config.Uuid)
 	default:
 		for _, reaper := range manager.Reapers {
+			if manager.ctx.Err() != nil {
+				return
+			}
 			reaper.RunOnSchedule(manager.ctx, manager.clientOptions...)
 		}
 	}
@@ -102,14 +144,16 @@ func (manager *ReaperManager) AddReaper(newReaper *reaper.Reaper) {
 	manager.newReaper <- newReaper
 }
 
-// AddReaperFromConfig adds a reaper to the manager from a ReaperConfig.
-func (manager *ReaperManager) AddReaperFromConfig(newReaperConfig *reaperconfig.ReaperConfig) {
+// AddReaperFromConfig adds a reaper to the manager from a ReaperConfig. The reaper's runs are
+// linked to the span in the context, such as the span of the gRPC request that added it.
+func (manager *ReaperManager) AddReaperFromConfig(ctx context.Context, newReaperConfig *reaperconfig.ReaperConfig) {
 	newReaper := reaper.NewReaper()
 	err := newReaper.UpdateReaperConfig(newReaperConfig)
 	if err != nil {
 		logger.Error(fmt.Errorf("error adding reaper: %v\n", err))
 		return
 	}
+	newReaper.SetConfigSpan(trace.FromContext(ctx).SpanContext())
 	manager.newReaper <- newReaper
 }
 
@@ -118,16 +162,64 @@ func (manager *ReaperManager) DeleteReaper(uuid string) {
 	manager.deleteReaper <- uuid
 }
 
-// UpdateReaper sends a signal to update a reaper with UUID given in the config.
-func (manager *ReaperManager) UpdateReaper(config *reaperconfig.ReaperConfig) {
-	manager.updateReaper <- config
+// UpdateReaper sends a signal to update a reaper with UUID given in the config. The reaper's
+// later runs are linked to the span in the context.
+func (manager *ReaperManager) UpdateReaper(ctx context.Context, config *reaperconfig.ReaperConfig) {
+	manager.updateReaper <- reaperUpdate{config, trace.FromContext(ctx).SpanContext()}
+}
+
+// SetFirstSeenTracker sets the tracker shared by all the manager's reapers for recording
+// when resources without a creation time were first seen.
+func (manager *ReaperManager) SetFirstSeenTracker(tracker *resources.FirstSeenTracker) {
+	manager.firstSeen = tracker
+}
+
+// SetProtectionPolicy sets the policy for resources that none of the manager's reapers
+// may delete, whatever their configs.
+func (manager *ReaperManager) SetProtectionPolicy(policy *resources.ProtectionPolicy) {
+	manager.protection = policy
+}
+
+// SetEventSink sets the sink that the manager and all its reapers publish their events to.
+func (manager *ReaperManager) SetEventSink(sink events.Sink) {
+	manager.eventSink = sink
+}
+
+// SetAuditLog sets the audit log that all the manager's reapers record their attempts to
+// delete resources in.
+func (manager *ReaperManager) SetAuditLog(auditLog *audit.Log) {
+	manager.auditLog = auditLog
 }
 
-// Shutdown ends the reaper manager process.
+// publishConfigChange publishes a CONFIG_CHANGED event for the reaper with the given UUID.
+// The config is nil if the reaper was deleted.
+func (manager *ReaperManager) publishConfigChange(reaperUUID string, config *reaperconfig.ReaperConfig) {
+	events.Publish(manager.ctx, manager.eventSink, events.NewConfigEvent(reaperUUID, config, time.Now()))
+}
+
+// Shutdown ends the reaper manager process. A sweep that is running stops at its next safe
+// point, and Wait can be used to wait for it.
 func (manager *ReaperManager) Shutdown() {
+	manager.cancel()
 	manager.quit <- true
 }
 
+// Wait blocks until MonitorReapers has returned after the manager was shut down.
+func (manager *ReaperManager) Wait() {
+	<-manager.done
+}
+
+// WaitTimeout blocks until MonitorReapers has returned after the manager was shut down, or
+// until the timeout has passed, and returns whether MonitorReapers returned.
+func (manager *ReaperManager) WaitTimeout(timeout time.Duration) bool {
+	select {
+	case <-manager.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 // handleDeleteReaper deletes the reaper with the given UUID, and returns whether the delete
 // was successful. Note that false is returned if no reaper exists with the given UUID.
 func (manager *ReaperManager) handleDeleteReaper(uuid string) bool {
@@ -141,16 +233,17 @@ func (manager *ReaperManager) handleDeleteReaper(uuid string) bool {
 	return false
 }
 
-// handleUpdateReaper updates the reaper with the given UUID from the config, and returns
+// handleUpdateReaper updates the reaper with the UUID given in the update's config, and returns
 // whether the update was successful.
-func (manager *ReaperManager) handleUpdateReaper(config *reaperconfig.ReaperConfig) error {
+func (manager *ReaperManager) handleUpdateReaper(update reaperUpdate) error {
 	for _, watchedReaper := range manager.Reapers {
-		if strings.Compare(watchedReaper.UUID, config.GetUuid()) == 0 {
-			err := watchedReaper.UpdateReaperConfig(config)
+		if strings.Compare(watchedReaper.UUID, update.config.GetUuid()) == 0 {
+			watchedReaper.SetConfigSpan(update.span)
+			err := watchedReaper.UpdateReaperConfig(update.config)
 			return err
 		}
 	}
-	return fmt.Errorf("Reaper with UUID %s does not exist", config.GetUuid())
+	return fmt.Errorf("Reaper with UUID %s does not exist", update.config.GetUuid())
 }
 
 // ListReapers returns a list of reapers being managed by the ReaperManager.
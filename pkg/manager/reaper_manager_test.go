@@ -21,7 +21,10 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
@@ -86,6 +89,40 @@ func TestMonitorReapers(t *testing.T) {
 	}
 }
 
+func TestConfigChangeEvents(t *testing.T) {
+	sink := events.NewMemorySink()
+	testManager := NewReaperManager(context.Background())
+	testManager.SetEventSink(sink)
+
+	config := reaper.NewReaperConfig(nil, "* * * * *", "testProject", "UUID_1")
+	updatedConfig := reaper.NewReaperConfig(nil, "@every 1h", "testProject", "UUID_1")
+	testManager.AddReaperFromConfig(testContext, config)
+	testManager.sweepReapers()
+	testManager.UpdateReaper(testContext, updatedConfig)
+	testManager.sweepReapers()
+	testManager.UpdateReaper(testContext, reaper.NewReaperConfig(nil, "* * * * *", "testProject", "UUID_2"))
+	testManager.sweepReapers()
+	testManager.DeleteReaper("UUID_1")
+	testManager.sweepReapers()
+
+	expectedConfigs := []*reaperconfig.ReaperConfig{config, updatedConfig, nil}
+	configEvents := sink.Events()
+	if len(configEvents) != len(expectedConfigs) {
+		t.Fatalf("Manager published %d events; want %d", len(configEvents), len(expectedConfigs))
+	}
+	for idx, event := range configEvents {
+		if event.GetType() != reaperconfig.EventType_CONFIG_CHANGED || event.GetReaperUuid() != "UUID_1" {
+			t.Errorf("Event %d is a %s event of reaper %s; want a CONFIG_CHANGED event of UUID_1", idx, event.GetType(), event.GetReaperUuid())
+		}
+		if !proto.Equal(event.GetConfig(), expectedConfigs[idx]) {
+			t.Errorf("Event %d has config %v; want %v", idx, event.GetConfig(), expectedConfigs[idx])
+		}
+	}
+	if testManager.GetReaper("UUID_1") != nil {
+		t.Errorf("Reaper UUID_1 not deleted")
+	}
+}
+
 type HandleDeleteTestCase struct {
 	UUID            string
 	ExpectedReapers []*reaper.Reaper
@@ -195,3 +232,23 @@ func getTestClientOptions(server *httptest.Server) []option.ClientOption {
 		option.WithEndpoint(server.URL),
 	}
 }
+
+func TestShutdownWaitsForMonitor(t *testing.T) {
+	testManager := NewReaperManager(context.Background())
+	go testManager.MonitorReapers()
+	testManager.Shutdown()
+
+	waited := make(chan struct{})
+	go func() {
+		testManager.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Waiting for the manager did not return after it was shut down")
+	}
+	if testManager.ctx.Err() == nil {
+		t.Errorf("Shutting down the manager did not cancel its context")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "reaper"
+
+// Names of the API calls made through resource clients.
+const (
+	AuthCall            = "auth"
+	GetResourcesCall    = "get_resources"
+	DeleteResourceCall  = "delete_resource"
+	DeleteResourcesCall = "delete_resources"
+	QuarantineCall      = "quarantine"
+	BackupCall          = "backup"
+)
+
+var (
+	resourcesWatched = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "resources_watched",
+			Help:      "Number of resources in the reaper's watchlist.",
+		},
+		[]string{"reaper", "resource_type"},
+	)
+	oldestResourceAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "oldest_watched_resource_age_seconds",
+			Help:      "Age of the oldest resource in the reaper's watchlist.",
+		},
+		[]string{"reaper", "resource_type"},
+	)
+	resourcesDeleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "resources_deleted_total",
+			Help:      "Number of resources deleted by the reaper.",
+		},
+		[]string{"reaper", "resource_type"},
+	)
+	resourcesFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "resources_failed_total",
+			Help:      "Number of resources the reaper failed to delete.",
+		},
+		[]string{"reaper", "resource_type"},
+	)
+	sweepDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sweep_duration_seconds",
+			Help:      "Duration of the reaper's sweeps through its watchlist.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		},
+		[]string{"reaper"},
+	)
+	apiCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "api_call_duration_seconds",
+			Help:      "Latency of the API calls made by resource clients.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"resource_type", "call"},
+	)
+	apiCallErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_call_errors_total",
+			Help:      "Number of API calls made by resource clients that failed.",
+		},
+		[]string{"resource_type", "call"},
+	)
+	reapers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "reapers",
+			Help:      "Number of reapers run by the manager.",
+		},
+	)
+	lastSweeps = &sweepCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "seconds_since_last_successful_sweep"),
+			"Time since the reaper last finished a sweep without pausing or failing to delete a resource.",
+			[]string{"reaper"}, nil,
+		),
+		lastSuccess: make(map[string]time.Time),
+	}
+
+	registry = newRegistry()
+)
+
+// newRegistry returns a registry with all of the reaper's metrics, along with the
+// standard Go runtime and process metrics.
+func newRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		resourcesWatched,
+		oldestResourceAge,
+		resourcesDeleted,
+		resourcesFailed,
+		sweepDuration,
+		apiCallDuration,
+		apiCallErrors,
+		reapers,
+		lastSweeps,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Handler returns an HTTP handler that serves the metrics in the Prometheus
+// exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ListenAndServe serves the metrics at /metrics on the given port.
+func ListenAndServe(port string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(":"+port, mux)
+}
+
+// WatchedResources describes the resources of one type in a reaper's watchlist.
+type WatchedResources struct {
+	Count         int
+	OldestCreated time.Time
+}
+
+// SetWatchlist records the resources in a reaper's watchlist by resource type, as of
+// the given time. Resource types missing from the map are no longer reported.
+func SetWatchlist(reaperUUID string, watchlist map[reaperconfig.ResourceType]WatchedResources, now time.Time) {
+	for value, name := range reaperconfig.ResourceType_name {
+		resourceType := reaperconfig.ResourceType(value)
+		watched, isWatched := watchlist[resourceType]
+		if !isWatched {
+			resourcesWatched.DeleteLabelValues(reaperUUID, name)
+			oldestResourceAge.DeleteLabelValues(reaperUUID, name)
+			continue
+		}
+		resourcesWatched.WithLabelValues(reaperUUID, name).Set(float64(watched.Count))
+		if watched.OldestCreated.IsZero() {
+			oldestResourceAge.DeleteLabelValues(reaperUUID, name)
+			continue
+		}
+		oldestResourceAge.WithLabelValues(reaperUUID, name).Set(now.Sub(watched.OldestCreated).Seconds())
+	}
+}
+
+// RecordDeleted records that a reaper deleted a resource of the given type.
+func RecordDeleted(reaperUUID string, resourceType reaperconfig.ResourceType) {
+	resourcesDeleted.WithLabelValues(reaperUUID, resourceType.String()).Inc()
+}
+
+// RecordFailed records that a reaper failed to delete a resource of the given type.
+func RecordFailed(reaperUUID string, resourceType reaperconfig.ResourceType) {
+	resourcesFailed.WithLabelValues(reaperUUID, resourceType.String()).Inc()
+}
+
+// RecordSweep records how long a reaper's sweep took, and that it has just finished if
+// it was successful.
+func RecordSweep(reaperUUID string, duration time.Duration, successful bool) {
+	sweepDuration.WithLabelValues(reaperUUID).Observe(duration.Seconds())
+	if successful {
+		lastSweeps.record(reaperUUID, time.Now())
+	}
+}
+
+// ObserveAPICall records the latency of an API call made by a resource client that
+// started at the given time, and whether it failed.
+func ObserveAPICall(resourceType reaperconfig.ResourceType, call string, start time.Time, err error) {
+	apiCallDuration.WithLabelValues(resourceType.String(), call).Observe(time.Since(start).Seconds())
+	if err != nil {
+		apiCallErrors.WithLabelValues(resourceType.String(), call).Inc()
+	}
+}
+
+// SetReaperCount records the number of reapers run by the manager.
+func SetReaperCount(count int) {
+	reapers.Set(float64(count))
+}
+
+// ForgetReaper stops reporting the metrics of a reaper that has been deleted.
+func ForgetReaper(reaperUUID string) {
+	for _, name := range reaperconfig.ResourceType_name {
+		resourcesWatched.DeleteLabelValues(reaperUUID, name)
+		oldestResourceAge.DeleteLabelValues(reaperUUID, name)
+		resourcesDeleted.DeleteLabelValues(reaperUUID, name)
+		resourcesFailed.DeleteLabelValues(reaperUUID, name)
+	}
+	sweepDuration.DeleteLabelValues(reaperUUID)
+	lastSweeps.forget(reaperUUID)
+}
+
+// sweepCollector reports the time since each reaper's last successful sweep, computed
+// when the metrics are collected.
+type sweepCollector struct {
+	desc        *prometheus.Desc
+	mu          sync.Mutex
+	lastSuccess map[string]time.Time
+}
+
+func (collector *sweepCollector) record(reaperUUID string, finishedAt time.Time) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.lastSuccess[reaperUUID] = finishedAt
+}
+
+func (collector *sweepCollector) forget(reaperUUID string) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	delete(collector.lastSuccess, reaperUUID)
+}
+
+// Describe implements prometheus.Collector.
+func (collector *sweepCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- collector.desc
+}
+
+// Collect implements prometheus.Collector.
+func (collector *sweepCollector) Collect(metrics chan<- prometheus.Metric) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for reaperUUID, finishedAt := range collector.lastSuccess {
+		metrics <- prometheus.MustNewConstMetric(
+			collector.desc, prometheus.GaugeValue, time.Since(finishedAt).Seconds(), reaperUUID,
+		)
+	}
+}
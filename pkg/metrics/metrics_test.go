@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSetWatchlist(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	SetWatchlist("watchlist-reaper", map[reaperconfig.ResourceType]WatchedResources{
+		reaperconfig.ResourceType_GCE_VM:     WatchedResources{3, now.Add(-time.Hour)},
+		reaperconfig.ResourceType_GCS_BUCKET: WatchedResources{1, now.Add(-time.Minute)},
+	}, now)
+
+	if count := testutil.ToFloat64(resourcesWatched.WithLabelValues("watchlist-reaper", "GCE_VM")); count != 3 {
+		t.Errorf("Watched GCE_VM resources = %v, want 3", count)
+	}
+	if age := testutil.ToFloat64(oldestResourceAge.WithLabelValues("watchlist-reaper", "GCE_VM")); age != 3600 {
+		t.Errorf("Oldest GCE_VM age = %v, want 3600", age)
+	}
+
+	SetWatchlist("watchlist-reaper", map[reaperconfig.ResourceType]WatchedResources{
+		reaperconfig.ResourceType_GCE_VM: WatchedResources{2, time.Time{}},
+	}, now)
+	if series := testutil.CollectAndCount(resourcesWatched); series != 1 {
+		t.Errorf("Watched resources has %d series, want 1", series)
+	}
+	if series := testutil.CollectAndCount(oldestResourceAge); series != 0 {
+		t.Errorf("Oldest resource age has %d series, want 0", series)
+	}
+	ForgetReaper("watchlist-reaper")
+}
+
+func TestRecordSweep(t *testing.T) {
+	RecordDeleted("sweep-reaper", reaperconfig.ResourceType_GCE_VM)
+	RecordDeleted("sweep-reaper", reaperconfig.ResourceType_GCE_VM)
+	RecordFailed("sweep-reaper", reaperconfig.ResourceType_GCS_OBJECT)
+	RecordSweep("sweep-reaper", 2*time.Second, false)
+
+	if deleted := testutil.ToFloat64(resourcesDeleted.WithLabelValues("sweep-reaper", "GCE_VM")); deleted != 2 {
+		t.Errorf("Deleted GCE_VM resources = %v, want 2", deleted)
+	}
+	if failed := testutil.ToFloat64(resourcesFailed.WithLabelValues("sweep-reaper", "GCS_OBJECT")); failed != 1 {
+		t.Errorf("Failed GCS_OBJECT resources = %v, want 1", failed)
+	}
+	if series := testutil.CollectAndCount(lastSweeps); series != 0 {
+		t.Errorf("Unsuccessful sweep recorded as successful")
+	}
+
+	RecordSweep("sweep-reaper", time.Second, true)
+	if series := testutil.CollectAndCount(lastSweeps); series != 1 {
+		t.Errorf("Successful sweep not recorded")
+	}
+
+	ForgetReaper("sweep-reaper")
+	if series := testutil.CollectAndCount(resourcesDeleted); series != 0 {
+		t.Errorf("Deleted resources has %d series after forgetting the reaper, want 0", series)
+	}
+	if series := testutil.CollectAndCount(lastSweeps); series != 0 {
+		t.Errorf("Last successful sweep still reported after forgetting the reaper")
+	}
+}
+
+func TestObserveAPICall(t *testing.T) {
+	ObserveAPICall(reaperconfig.ResourceType_PUBSUB_TOPIC, GetResourcesCall, time.Now(), nil)
+	ObserveAPICall(reaperconfig.ResourceType_PUBSUB_TOPIC, GetResourcesCall, time.Now(), fmt.Errorf("quota exceeded"))
+
+	if errors := testutil.ToFloat64(apiCallErrors.WithLabelValues("PUBSUB_TOPIC", GetResourcesCall)); errors != 1 {
+		t.Errorf("API call errors = %v, want 1", errors)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	SetReaperCount(2)
+	RecordDeleted("handler-reaper", reaperconfig.ResourceType_GCE_SNAPSHOT)
+	defer ForgetReaper("handler-reaper")
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	response, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLines := []string{
+		"reaper_reapers 2",
+		`reaper_resources_deleted_total{reaper="handler-reaper",resource_type="GCE_SNAPSHOT"} 1`,
+		"go_goroutines",
+	}
+	for _, expectedLine := range expectedLines {
+		if !strings.Contains(string(body), expectedLine) {
+			t.Errorf("Metrics missing %q", expectedLine)
+		}
+	}
+}
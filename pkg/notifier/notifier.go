@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// Events that notifications are sent for.
+const (
+	// DeletionWarning is sent before resources are deleted.
+	DeletionWarning = "deletion_warning"
+
+	// SweepSummary is sent after a sweep that deleted or failed to delete resources.
+	SweepSummary = "sweep_summary"
+
+	// ReaperPaused is sent when a reaper is paused because a sweep would exceed one of
+	// its deletion limits.
+	ReaperPaused = "reaper_paused"
+)
+
+// A Notification describes an event of a reaper. Resources lists the resources that a
+// DeletionWarning is about, Deleted and Failed list the resources that a sweep deleted
+// and failed to delete, and Reason explains why a reaper was paused.
+type Notification struct {
+	Event      string     `json:"event"`
+	ReaperUUID string     `json:"reaper_uuid"`
+	Resources  []Resource `json:"resources,omitempty"`
+	Deleted    []Resource `json:"deleted,omitempty"`
+	Failed     []Resource `json:"failed,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// A Resource is a resource named in a notification. DeletionTime is only set for
+// warnings, and Error is only set for resources that failed to be deleted.
+type Resource struct {
+	Name         string `json:"name"`
+	Zone         string `json:"zone"`
+	ProjectID    string `json:"project_id"`
+	Type         string `json:"type"`
+	DeletionTime string `json:"deletion_time,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// NewResource creates the notification Resource for a resource in the given project.
+func NewResource(projectID string, resource *resources.Resource) Resource {
+	return Resource{
+		Name:      resource.Name,
+		Zone:      resource.Zone,
+		ProjectID: projectID,
+		Type:      resource.Type.String(),
+	}
+}
+
+// NewWarningResource creates the notification Resource for a resource in the given project
+// that will be deleted at the given time.
+func NewWarningResource(projectID string, resource *resources.Resource, deletionTime time.Time) Resource {
+	notificationResource := NewResource(projectID, resource)
+	notificationResource.DeletionTime = deletionTime.Format(time.RFC3339)
+	return notificationResource
+}
+
+// NewFailedResource creates the notification Resource for a resource in the given project
+// that failed to be deleted with the given error.
+func NewFailedResource(projectID string, resource *resources.Resource, err error) Resource {
+	notificationResource := NewResource(projectID, resource)
+	notificationResource.Error = err.Error()
+	return notificationResource
+}
+
+// A Notifier sends notifications to a single destination.
+type Notifier interface {
+	Notify(ctx context.Context, notification *Notification) error
+}
+
+// New creates a Notifier for each of the webhooks in the NotificationConfig. A nil config
+// has no notifiers.
+func New(config *reaperconfig.NotificationConfig) []Notifier {
+	maxRetries := int(config.GetMaxRetries())
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	var notifiers []Notifier
+	for _, webhook := range config.GetWebhooks() {
+		poster := newPoster(webhook.GetUrl(), maxRetries)
+		switch webhook.GetFormat() {
+		case reaperconfig.WebhookFormat_SLACK:
+			notifiers = append(notifiers, &SlackNotifier{poster})
+		default:
+			notifiers = append(notifiers, &WebhookNotifier{poster})
+		}
+	}
+	return notifiers
+}
+
+// NotifyAll sends the notification with every notifier, and logs the notifications that
+// could not be sent. Each notifier has up to notificationTimeout to send the notification,
+// so that an unresponsive webhook cannot hold up the caller.
+func NotifyAll(ctx context.Context, notifiers []Notifier, notification *Notification) {
+	for _, notifier := range notifiers {
+		notifyCtx, cancel := context.WithTimeout(ctx, notificationTimeout)
+		err := notifier.Notify(notifyCtx, notification)
+		cancel()
+		if err != nil {
+			logger.Error(fmt.Errorf("Sending %s notification for reaper %s failed: %v", notification.Event, notification.ReaperUUID, err))
+		}
+	}
+}
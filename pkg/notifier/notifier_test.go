@@ -0,0 +1,53 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+var errTest = errors.New("permission denied")
+
+func TestNew(t *testing.T) {
+	if notifiers := New(nil); len(notifiers) != 0 {
+		t.Errorf("New with no config created %d notifiers; want none", len(notifiers))
+	}
+
+	config := &reaperconfig.NotificationConfig{
+		Webhooks: []*reaperconfig.Webhook{
+			&reaperconfig.Webhook{Url: "https://example.com/hook"},
+			&reaperconfig.Webhook{Url: "https://hooks.slack.com/services/token", Format: reaperconfig.WebhookFormat_SLACK},
+		},
+	}
+	notifiers := New(config)
+	if len(notifiers) != 2 {
+		t.Fatalf("New created %d notifiers; want 2", len(notifiers))
+	}
+	webhookNotifier, isWebhook := notifiers[0].(*WebhookNotifier)
+	if !isWebhook || webhookNotifier.url != "https://example.com/hook" || webhookNotifier.maxRetries != defaultMaxRetries {
+		t.Errorf("First notifier = %#v; want a JSON webhook with the default retries", notifiers[0])
+	}
+	if _, isSlack := notifiers[1].(*SlackNotifier); !isSlack {
+		t.Errorf("Second notifier = %#v; want a Slack webhook", notifiers[1])
+	}
+
+	config.MaxRetries = 5
+	if webhookNotifier := New(config)[0].(*WebhookNotifier); webhookNotifier.maxRetries != 5 {
+		t.Errorf("Notifier retries %d times; want 5", webhookNotifier.maxRetries)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMaxRetries is the number of times a failed notification is retried when
+	// the NotificationConfig does not set a maximum.
+	defaultMaxRetries = 3
+
+	// maxListedResources is the maximum number of resources listed in each section of
+	// a Slack message.
+	maxListedResources = 20
+
+	// requestTimeout is how long each request to a webhook may take.
+	requestTimeout = 30 * time.Second
+)
+
+var (
+	// retryDelay is how long to wait before the first retry of a failed notification. The
+	// delay doubles before each further retry.
+	retryDelay = time.Second
+
+	// notificationTimeout is how long NotifyAll spends sending a notification with each
+	// notifier, including its retries.
+	notificationTimeout = 2 * time.Minute
+)
+
+// WebhookNotifier posts notifications as JSON objects to a URL.
+type WebhookNotifier struct {
+	*poster
+}
+
+// Notify posts the notification to the webhook.
+func (notifier *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	return notifier.post(ctx, notification)
+}
+
+// SlackNotifier posts notifications as Slack-compatible messages to a URL, such as the
+// URL of a Slack incoming webhook.
+type SlackNotifier struct {
+	*poster
+}
+
+// slackMessage is the body of a Slack incoming webhook request.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Notify posts the notification to the webhook as a Slack message.
+func (notifier *SlackNotifier) Notify(ctx context.Context, notification *Notification) error {
+	return notifier.post(ctx, slackMessage{slackText(notification)})
+}
+
+// slackText returns the text of the Slack message for a notification.
+func slackText(notification *Notification) string {
+	var text strings.Builder
+	switch notification.Event {
+	case DeletionWarning:
+		fmt.Fprintf(&text, "Reaper %s will soon delete %d resources:\n", notification.ReaperUUID, len(notification.Resources))
+		writeSlackResources(&text, notification.Resources)
+	case ReaperPaused:
+		fmt.Fprintf(
+			&text, "Reaper %s was paused because %s. Update the reaper's config to resume it.\n",
+			notification.ReaperUUID, notification.Reason,
+		)
+	default:
+		fmt.Fprintf(
+			&text, "Reaper %s deleted %d resources and failed to delete %d resources.\n",
+			notification.ReaperUUID, len(notification.Deleted), len(notification.Failed),
+		)
+		if len(notification.Deleted) > 0 {
+			text.WriteString("Deleted:\n")
+			writeSlackResources(&text, notification.Deleted)
+		}
+		if len(notification.Failed) > 0 {
+			text.WriteString("Failed:\n")
+			writeSlackResources(&text, notification.Failed)
+		}
+	}
+	return strings.TrimSuffix(text.String(), "\n")
+}
+
+// writeSlackResources writes a line for each resource, listing at most maxListedResources.
+func writeSlackResources(text *strings.Builder, notificationResources []Resource) {
+	for idx, resource := range notificationResources {
+		if idx == maxListedResources {
+			fmt.Fprintf(text, "• and %d more\n", len(notificationResources)-maxListedResources)
+			return
+		}
+		fmt.Fprintf(text, "• %s %s in zone %s of project %s", resource.Type, resource.Name, resource.Zone, resource.ProjectID)
+		if len(resource.DeletionTime) > 0 {
+			fmt.Fprintf(text, " at %s", resource.DeletionTime)
+		}
+		if len(resource.Error) > 0 {
+			fmt.Fprintf(text, ": %s", resource.Error)
+		}
+		text.WriteString("\n")
+	}
+}
+
+// poster posts JSON bodies to a URL, retrying failed requests.
+type poster struct {
+	url        string
+	maxRetries int
+	client     *http.Client
+}
+
+func newPoster(url string, maxRetries int) *poster {
+	return &poster{url: url, maxRetries: maxRetries, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// post posts the body as JSON to the poster's URL. Requests that fail to be sent, or that
+// get a 429 or 5xx response, are retried with exponential backoff. Retrying stops early
+// when the next retry would start after the context's deadline.
+func (poster *poster) post(ctx context.Context, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		shouldRetry, err := poster.postOnce(ctx, payload)
+		if err == nil {
+			return nil
+		}
+		if !shouldRetry || attempt == poster.maxRetries {
+			return fmt.Errorf("posting to %s failed after %d attempts: %v", poster.host(), attempt+1, err)
+		}
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("posting to %s failed after %d attempts, with no time left to retry: %v", poster.host(), attempt+1, err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// postOnce posts the payload, and returns whether a failed request should be retried.
+func (poster *poster) postOnce(ctx context.Context, payload []byte) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, poster.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("invalid webhook URL")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := poster.client.Do(request)
+	if urlError, isURLError := err.(*url.Error); isURLError {
+		// The URL is left out of the error, as it may contain a secret.
+		return true, urlError.Err
+	}
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	shouldRetry := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+	return shouldRetry, fmt.Errorf("got status %s", response.Status)
+}
+
+// host returns the host of the poster's URL, so that errors do not include secrets that
+// webhook URLs often contain.
+func (poster *poster) host() string {
+	parsedURL, err := url.Parse(poster.url)
+	if err != nil {
+		return "webhook"
+	}
+	return parsedURL.Host
+}
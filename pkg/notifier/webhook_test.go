@@ -0,0 +1,208 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+var (
+	testContext  = context.Background()
+	testResource = resources.NewResource("debug-vm", "us-east1-b", time.Time{}, reaperconfig.ResourceType_GCE_VM)
+	deletionTime = time.Date(2020, 6, 17, 14, 0, 0, 0, time.UTC)
+
+	testWarning = &Notification{
+		Event:      DeletionWarning,
+		ReaperUUID: "TestUUID",
+		Resources:  []Resource{NewWarningResource("testProject", testResource, deletionTime)},
+	}
+)
+
+func init() {
+	logger.CreateLogger()
+	retryDelay = time.Millisecond
+}
+
+// receiver is an httptest server that records the bodies posted to it, and fails the
+// first failures requests with the given status.
+type receiver struct {
+	*httptest.Server
+	bodies   [][]byte
+	requests int32
+}
+
+func newReceiver(failures int32, failureStatus int) *receiver {
+	testReceiver := &receiver{}
+	testReceiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&testReceiver.requests, 1) <= failures {
+			w.WriteHeader(failureStatus)
+			return
+		}
+		var body json.RawMessage
+		json.NewDecoder(req.Body).Decode(&body)
+		testReceiver.bodies = append(testReceiver.bodies, body)
+	}))
+	return testReceiver
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	testReceiver := newReceiver(0, 0)
+	defer testReceiver.Close()
+
+	if err := (&WebhookNotifier{newPoster(testReceiver.URL, 0)}).Notify(testContext, testWarning); err != nil {
+		t.Fatal(err)
+	}
+	var received Notification
+	if len(testReceiver.bodies) != 1 || json.Unmarshal(testReceiver.bodies[0], &received) != nil {
+		t.Fatalf("Webhook received %d notifications; want 1", len(testReceiver.bodies))
+	}
+	if !reflect.DeepEqual(&received, testWarning) {
+		t.Errorf("Webhook received %v; want %v", received, testWarning)
+	}
+	expectedJSON := `{"event":"deletion_warning","reaper_uuid":"TestUUID","resources":[{"name":"debug-vm","zone":"us-east1-b",` +
+		`"project_id":"testProject","type":"GCE_VM","deletion_time":"2020-06-17T14:00:00Z"}]}`
+	if string(testReceiver.bodies[0]) != expectedJSON {
+		t.Errorf("Webhook received %s; want %s", testReceiver.bodies[0], expectedJSON)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	testReceiver := newReceiver(0, 0)
+	defer testReceiver.Close()
+
+	summary := &Notification{
+		Event:      SweepSummary,
+		ReaperUUID: "TestUUID",
+		Deleted:    []Resource{NewResource("testProject", testResource)},
+		Failed:     []Resource{NewFailedResource("testProject", testResource, errTest)},
+	}
+	paused := &Notification{
+		Event:      ReaperPaused,
+		ReaperUUID: "TestUUID",
+		Reason:     "4 resources are ready for deletion, over the limit of 3 per sweep",
+	}
+	for _, notification := range []*Notification{testWarning, summary, paused} {
+		if err := (&SlackNotifier{newPoster(testReceiver.URL, 0)}).Notify(testContext, notification); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectedTexts := []string{
+		"Reaper TestUUID will soon delete 1 resources:\n" +
+			"• GCE_VM debug-vm in zone us-east1-b of project testProject at 2020-06-17T14:00:00Z",
+		"Reaper TestUUID deleted 1 resources and failed to delete 1 resources.\n" +
+			"Deleted:\n• GCE_VM debug-vm in zone us-east1-b of project testProject\n" +
+			"Failed:\n• GCE_VM debug-vm in zone us-east1-b of project testProject: permission denied",
+		"Reaper TestUUID was paused because 4 resources are ready for deletion, over the limit of 3 per sweep. " +
+			"Update the reaper's config to resume it.",
+	}
+	if len(testReceiver.bodies) != len(expectedTexts) {
+		t.Fatalf("Slack received %d messages; want %d", len(testReceiver.bodies), len(expectedTexts))
+	}
+	for idx, body := range testReceiver.bodies {
+		var message slackMessage
+		json.Unmarshal(body, &message)
+		if message.Text != expectedTexts[idx] {
+			t.Errorf("Slack message = %q; want %q", message.Text, expectedTexts[idx])
+		}
+	}
+}
+
+type RetryTestCase struct {
+	Failures         int32
+	FailureStatus    int
+	MaxRetries       int
+	ExpectedRequests int32
+	ExpectedError    bool
+}
+
+var retryTestCases = []RetryTestCase{
+	RetryTestCase{2, http.StatusInternalServerError, 3, 3, false},
+	RetryTestCase{1, http.StatusTooManyRequests, 3, 2, false},
+	RetryTestCase{5, http.StatusServiceUnavailable, 3, 4, true},
+	RetryTestCase{5, http.StatusBadRequest, 3, 1, true},
+}
+
+func TestRetries(t *testing.T) {
+	for _, testCase := range retryTestCases {
+		testReceiver := newReceiver(testCase.Failures, testCase.FailureStatus)
+		err := (&WebhookNotifier{newPoster(testReceiver.URL, testCase.MaxRetries)}).Notify(testContext, testWarning)
+		testReceiver.Close()
+		if (err != nil) != testCase.ExpectedError {
+			t.Errorf("Notify with %d failures returned error %v; want error: %t", testCase.Failures, err, testCase.ExpectedError)
+		}
+		if testReceiver.requests != testCase.ExpectedRequests {
+			t.Errorf("Notify with %d failures sent %d requests; want %d", testCase.Failures, testReceiver.requests, testCase.ExpectedRequests)
+		}
+	}
+}
+
+func TestErrorHidesWebhookURL(t *testing.T) {
+	testReceiver := newReceiver(0, 0)
+	testReceiver.Close()
+
+	secretURL := testReceiver.URL + "/services/secret-token"
+	err := (&SlackNotifier{newPoster(secretURL, 0)}).Notify(testContext, testWarning)
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Notify to closed receiver returned error %v; want an error without the URL path", err)
+	}
+}
+
+// TestRetriesStopAtDeadline tests that a notification is not retried when the retry would
+// start after the context's deadline.
+func TestRetriesStopAtDeadline(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = time.Hour
+
+	testReceiver := newReceiver(5, http.StatusServiceUnavailable)
+	defer testReceiver.Close()
+	ctx, cancel := context.WithTimeout(testContext, time.Minute)
+	defer cancel()
+	if err := (&WebhookNotifier{newPoster(testReceiver.URL, 3)}).Notify(ctx, testWarning); err == nil {
+		t.Errorf("Notify past its deadline did not fail")
+	}
+	if testReceiver.requests != 1 {
+		t.Errorf("Notify past its deadline sent %d requests; want 1", testReceiver.requests)
+	}
+}
+
+// TestNotifyAllTimeout tests that NotifyAll gives up on a webhook that does not respond.
+func TestNotifyAllTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { notificationTimeout = timeout }(notificationTimeout)
+	notificationTimeout = 10 * time.Millisecond
+
+	release := make(chan struct{})
+	testReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer testReceiver.Close()
+	defer close(release)
+	start := time.Now()
+	NotifyAll(testContext, []Notifier{&WebhookNotifier{newPoster(testReceiver.URL, 3)}}, testWarning)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("NotifyAll to an unresponsive webhook took %s; want it to time out", elapsed)
+	}
+}
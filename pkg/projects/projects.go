@@ -0,0 +1,172 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projects
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	crmv1 "google.golang.org/api/cloudresourcemanager/v1"
+	crmv2 "google.golang.org/api/cloudresourcemanager/v2"
+	"google.golang.org/api/option"
+)
+
+// activeState is the lifecycle state of projects that have not been deleted.
+const activeState = "ACTIVE"
+
+// ProjectLister finds GCP projects through Resource Manager.
+type ProjectLister struct {
+	projects *crmv1.Service
+	folders  *crmv2.Service
+	ctx      context.Context
+}
+
+// NewProjectLister creates a new ProjectLister.
+func NewProjectLister() *ProjectLister {
+	return &ProjectLister{}
+}
+
+// Auth authenticates the lister to access Resource Manager. See
+// https://pkg.go.dev/google.golang.org/api/option?tab=doc for more
+// information about passing options.
+func (lister *ProjectLister) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	projectsService, err := crmv1.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	foldersService, err := crmv2.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	lister.projects = projectsService
+	lister.folders = foldersService
+	lister.ctx = ctx
+	return nil
+}
+
+// ListProjects returns the IDs of the active projects under the parent, which is either
+// a folder or an organization, including projects in nested folders. An empty parent
+// lists every active project the caller can access. Only projects whose ID matches the
+// project filter are returned, and an empty filter matches every project.
+func (lister *ProjectLister) ListProjects(parent, projectFilter string) ([]string, error) {
+	filterRegex, err := regexp.Compile(projectFilter)
+	if err != nil {
+		return nil, fmt.Errorf("parsing project filter %s failed: %v", projectFilter, err)
+	}
+
+	var parents []string
+	if len(parent) > 0 {
+		parents, err = lister.listFolders(parent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var projectIDs []string
+	addProjects := func(response *crmv1.ListProjectsResponse) error {
+		for _, project := range response.Projects {
+			if project.LifecycleState == activeState && filterRegex.MatchString(project.ProjectId) {
+				projectIDs = append(projectIDs, project.ProjectId)
+			}
+		}
+		return nil
+	}
+	if len(parents) == 0 {
+		err := lister.projects.Projects.List().Pages(lister.ctx, addProjects)
+		return projectIDs, err
+	}
+	for _, parent := range parents {
+		parentFilter, err := parentFilter(parent)
+		if err != nil {
+			return nil, err
+		}
+		if err := lister.projects.Projects.List().Filter(parentFilter).Pages(lister.ctx, addProjects); err != nil {
+			return nil, err
+		}
+	}
+	return projectIDs, nil
+}
+
+// listFolders returns the parent along with every folder nested under it.
+func (lister *ProjectLister) listFolders(parent string) ([]string, error) {
+	folders := []string{parent}
+	for idx := 0; idx < len(folders); idx++ {
+		listFoldersCall := lister.folders.Folders.List().Parent(folders[idx])
+		err := listFoldersCall.Pages(lister.ctx, func(response *crmv2.ListFoldersResponse) error {
+			for _, folder := range response.Folders {
+				if folder.LifecycleState == activeState {
+					folders = append(folders, folder.Name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return folders, nil
+}
+
+// parentFilter returns the Resource Manager filter for projects that are direct children
+// of the given folders/{id} or organizations/{id} parent.
+func parentFilter(parent string) (string, error) {
+	splitParent := strings.Split(parent, "/")
+	if len(splitParent) != 2 {
+		return "", fmt.Errorf("invalid parent %s", parent)
+	}
+	switch splitParent[0] {
+	case "folders":
+		return fmt.Sprintf("parent.type:folder parent.id:%s", splitParent[1]), nil
+	case "organizations":
+		return fmt.Sprintf("parent.type:organization parent.id:%s", splitParent[1]), nil
+	default:
+		return "", fmt.Errorf("invalid parent %s", parent)
+	}
+}
+
+// GetProjectIDs returns the IDs of all the projects targeted by the ReaperConfig, without
+// duplicates. Resource Manager is only used if the config has a project filter or parent,
+// and the projects named directly in the config are returned even if that lookup fails.
+func GetProjectIDs(ctx context.Context, config *reaperconfig.ReaperConfig, opts ...option.ClientOption) ([]string, error) {
+	var projectIDs []string
+	seen := make(map[string]bool)
+	addProjectIDs := func(ids ...string) {
+		for _, id := range ids {
+			if len(id) > 0 && !seen[id] {
+				seen[id] = true
+				projectIDs = append(projectIDs, id)
+			}
+		}
+	}
+	addProjectIDs(config.GetProjectId())
+	addProjectIDs(config.GetProjectIds()...)
+
+	if len(config.GetProjectFilter()) == 0 && len(config.GetParent()) == 0 {
+		return projectIDs, nil
+	}
+	lister := NewProjectLister()
+	if err := lister.Auth(ctx, opts...); err != nil {
+		return projectIDs, err
+	}
+	listedProjectIDs, err := lister.ListProjects(config.GetParent(), config.GetProjectFilter())
+	if err != nil {
+		return projectIDs, err
+	}
+	addProjectIDs(listedProjectIDs...)
+	return projectIDs, nil
+}
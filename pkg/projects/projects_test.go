@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projects
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// A mock object to represent a GCP project. Only the fields used by the lister are included.
+type TestProject struct {
+	ProjectId      string `json:"projectId"`
+	LifecycleState string `json:"lifecycleState"`
+}
+
+// A mock object to represent a folder. Only the fields used by the lister are included.
+type TestFolder struct {
+	Name           string `json:"name"`
+	LifecycleState string `json:"lifecycleState"`
+}
+
+var (
+	// Map of parent filter -> projects directly under the parent.
+	testProjects = map[string][]TestProject{
+		"": []TestProject{
+			TestProject{"test-project-1", "ACTIVE"},
+			TestProject{"test-project-2", "DELETE_REQUESTED"},
+			TestProject{"prod-project", "ACTIVE"},
+		},
+		"parent.type:organization parent.id:1": []TestProject{
+			TestProject{"org-test-project", "ACTIVE"},
+		},
+		"parent.type:folder parent.id:2": []TestProject{
+			TestProject{"folder-test-project", "ACTIVE"},
+			TestProject{"folder-prod-project", "ACTIVE"},
+		},
+	}
+	// Map of parent -> folders directly under the parent.
+	testFolders = map[string][]TestFolder{
+		"organizations/1": []TestFolder{
+			TestFolder{"folders/2", "ACTIVE"},
+			TestFolder{"folders/3", "DELETE_REQUESTED"},
+		},
+	}
+)
+
+type GetProjectIDsTestCase struct {
+	Config   *reaperconfig.ReaperConfig
+	Expected []string
+}
+
+var getProjectIDsTestCases = []GetProjectIDsTestCase{
+	GetProjectIDsTestCase{
+		&reaperconfig.ReaperConfig{ProjectId: "project-1", ProjectIds: []string{"project-2", "project-1"}},
+		[]string{"project-1", "project-2"},
+	},
+	GetProjectIDsTestCase{
+		&reaperconfig.ReaperConfig{ProjectFilter: "^test-"},
+		[]string{"test-project-1"},
+	},
+	GetProjectIDsTestCase{
+		&reaperconfig.ReaperConfig{ProjectId: "project-1", Parent: "organizations/1"},
+		[]string{"project-1", "org-test-project", "folder-test-project", "folder-prod-project"},
+	},
+	GetProjectIDsTestCase{
+		&reaperconfig.ReaperConfig{Parent: "organizations/1", ProjectFilter: "test"},
+		[]string{"org-test-project", "folder-test-project"},
+	},
+}
+
+func TestGetProjectIDs(t *testing.T) {
+	server := utils.CreateServer(resourceManagerHandler)
+	defer server.Close()
+
+	for _, testCase := range getProjectIDsTestCases {
+		result, err := GetProjectIDs(context.TODO(), testCase.Config, utils.GetTestOptions(server)...)
+		if err != nil {
+			t.Errorf("Getting project IDs failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(result, testCase.Expected) {
+			t.Errorf("Project IDs = %v; want %v", result, testCase.Expected)
+		}
+	}
+}
+
+func TestParentFilter(t *testing.T) {
+	for _, parent := range []string{"projects/1", "folders", "folders/1/2"} {
+		if _, err := parentFilter(parent); err == nil {
+			t.Errorf("Expected parent %s to be invalid", parent)
+		}
+	}
+}
+
+// Mock server's http handler for listing projects and folders.
+func resourceManagerHandler(w http.ResponseWriter, req *http.Request) {
+	if strings.HasSuffix(req.URL.Path, "/folders") {
+		utils.SendResponse(w, map[string][]TestFolder{"folders": testFolders[req.URL.Query().Get("parent")]})
+		return
+	}
+	utils.SendResponse(w, map[string][]TestProject{"projects": testProjects[req.URL.Query().Get("filter")]})
+}
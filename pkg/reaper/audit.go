@@ -0,0 +1,43 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/audit"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// SetAuditLog sets the audit log that the reaper records its attempts to delete resources
+// in. A nil audit log means the attempts are not audited.
+func (reaper *Reaper) SetAuditLog(auditLog *audit.Log) {
+	reaper.auditLog = auditLog
+}
+
+// audit records an attempt to delete a watched resource in the given project in the
+// reaper's audit log, logging any error writing the record.
+func (reaper *Reaper) audit(projectID string, watchedResource *resources.WatchedResource, outcome reaperconfig.AuditOutcome, err error) {
+	if reaper.auditLog == nil {
+		return
+	}
+	record := audit.NewRecord(reaper.UUID, projectID, watchedResource, outcome, err, reaper.Clock.Now())
+	if err := reaper.auditLog.Record(record); err != nil {
+		reaper.resourceLog(projectID, watchedResource.Resource).With(logger.Err(err)).Errorf(
+			"Writing audit record of %s deletion of %s failed with the following error: %s",
+			outcome.String(), watchedResource.Name, err.Error(),
+		)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/metrics"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+)
+
+// backupResources backs up the given resources that have a backup configured, and returns
+// the resources whose backup failed and the resources that can be deleted. Resources whose
+// client cannot back them up are deleted without a backup.
+func (reaper *Reaper) backupResources(resourceClient clients.Client, projectID string, watchedResources []*resources.WatchedResource, result *SweepResult) ([]*resources.WatchedResource, []*resources.WatchedResource) {
+	backupCreator, isBackupCreator := resourceClient.(clients.BackupCreator)
+
+	var failedResources, resourcesToDelete []*resources.WatchedResource
+	for _, watchedResource := range watchedResources {
+		if !isBackupCreator || watchedResource.Backup == nil {
+			resourcesToDelete = append(resourcesToDelete, watchedResource)
+			continue
+		}
+		err := reaper.backupResource(backupCreator, projectID, watchedResource)
+		if err != nil {
+			reaper.resourceLog(projectID, watchedResource.Resource).With(logger.Err(err)).Errorf(
+				"%s client failed to back up resource %s in project %s, so it was not deleted, with the following error: %s",
+				watchedResource.Type.String(), watchedResource.Name, projectID, err.Error(),
+			)
+			failedResources = append(failedResources, watchedResource)
+			result.failed(projectID, watchedResource.Resource, err)
+			continue
+		}
+		reaper.resourceLog(projectID, watchedResource.Resource).Infof(
+			"Backed up %s resource %s in zone %s of project %s",
+			watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone, projectID,
+		)
+		resourcesToDelete = append(resourcesToDelete, watchedResource)
+		result.BackedUp++
+	}
+	return failedResources, resourcesToDelete
+}
+
+// backupResource backs up a single resource, labeling the backup with its source, the
+// reaper's UUID and when it expires.
+func (reaper *Reaper) backupResource(backupCreator clients.BackupCreator, projectID string, watchedResource *resources.WatchedResource) error {
+	labels, err := resources.BackupLabels(watchedResource.Resource, reaper.UUID, watchedResource.Backup.GetTtl(), reaper.Clock.Now())
+	if err != nil {
+		return fmt.Errorf("parsing backup TTL failed: %s", err.Error())
+	}
+	start := time.Now()
+	err = backupCreator.Backup(projectID, watchedResource.Resource, watchedResource.Backup, labels)
+	metrics.ObserveAPICall(watchedResource.Type, metrics.BackupCall, start, err)
+	return err
+}
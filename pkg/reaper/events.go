@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"context"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// SetEventSink sets the sink that the reaper publishes its events to. A nil sink means
+// the reaper publishes no events.
+func (reaper *Reaper) SetEventSink(sink events.Sink) {
+	reaper.eventSink = sink
+}
+
+// publishWatchlistEvents publishes a RESOURCE_DISCOVERED event for each resource in the new
+// watchlist that is not in the reaper's current Watchlist, and a SCHEDULED_FOR_DELETION event
+// for each resource whose deletion time is new or has changed.
+func (reaper *Reaper) publishWatchlistEvents(ctx context.Context, newWatchlist []*resources.WatchedResource) {
+	if reaper.eventSink == nil {
+		return
+	}
+	deletionTimes := make(map[watchlistKey]time.Time)
+	for _, watchedResource := range reaper.Watchlist {
+		deletionTime, _ := watchedResource.GetDeletionTime()
+		deletionTimes[reaper.keyOf(watchedResource)] = deletionTime
+	}
+
+	now := reaper.Clock.Now()
+	var watchlistEvents []*reaperconfig.ReaperEvent
+	for _, watchedResource := range newWatchlist {
+		projectID := reaper.projectOf(watchedResource.Resource)
+		previousDeletionTime, isWatched := deletionTimes[reaper.keyOf(watchedResource)]
+		if !isWatched {
+			watchlistEvents = append(watchlistEvents, events.NewResourceEvent(
+				reaperconfig.EventType_RESOURCE_DISCOVERED, reaper.UUID, projectID, watchedResource.Resource, now,
+			))
+		}
+		deletionTime, err := watchedResource.GetDeletionTime()
+		if err != nil || (isWatched && deletionTime.Equal(previousDeletionTime)) {
+			continue
+		}
+		watchlistEvents = append(watchlistEvents, events.NewScheduledEvent(reaper.UUID, projectID, watchedResource.Resource, deletionTime, now))
+	}
+	events.Publish(ctx, reaper.eventSink, watchlistEvents...)
+}
+
+// publishSweepEvents publishes a RESOURCE_DELETED or DELETION_FAILED event for each resource
+// that the sweep tried to delete.
+func (reaper *Reaper) publishSweepEvents(ctx context.Context, result SweepResult) {
+	if reaper.eventSink == nil {
+		return
+	}
+	now := reaper.Clock.Now()
+	var sweepEvents []*reaperconfig.ReaperEvent
+	for _, outcome := range result.outcomes {
+		if outcome.err != nil {
+			sweepEvents = append(sweepEvents, events.NewFailedEvent(reaper.UUID, outcome.projectID, outcome.resource, outcome.err, now))
+		} else {
+			sweepEvents = append(sweepEvents, events.NewResourceEvent(
+				reaperconfig.EventType_RESOURCE_DELETED, reaper.UUID, outcome.projectID, outcome.resource, now,
+			))
+		}
+	}
+	events.Publish(ctx, reaper.eventSink, sweepEvents...)
+}
+
+// keyOf returns the key of a watched resource in the reaper's Watchlist.
+func (reaper *Reaper) keyOf(watchedResource *resources.WatchedResource) watchlistKey {
+	return newWatchlistKey(reaper.projectOf(watchedResource.Resource), watchedResource.Resource)
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/notifier"
+)
+
+// deletionBudgetWindow is the period that the daily deletion budget applies to.
+const deletionBudgetWindow = 24 * time.Hour
+
+// checkDeletionLimits returns an error describing the first deletion limit in the reaper's
+// config that would be exceeded by deleting numReady of numWatched watched resources, or nil
+// if the deletions are within all of the limits.
+func (reaper *Reaper) checkDeletionLimits(numReady, numWatched int) error {
+	limits := reaper.config.GetDeletionLimits()
+	if maxPerSweep := int(limits.GetMaxDeletionsPerSweep()); maxPerSweep > 0 && numReady > maxPerSweep {
+		return fmt.Errorf("%d resources are ready for deletion, over the limit of %d per sweep", numReady, maxPerSweep)
+	}
+	if maxPercentage := limits.GetMaxDeletionPercentage(); maxPercentage > 0 && numWatched > 0 {
+		percentage := 100 * float64(numReady) / float64(numWatched)
+		if percentage > maxPercentage {
+			return fmt.Errorf(
+				"%.1f%% of watched resources are ready for deletion, over the limit of %.1f%% per sweep",
+				percentage, maxPercentage,
+			)
+		}
+	}
+	if maxPerDay := int(limits.GetMaxDeletionsPerDay()); maxPerDay > 0 {
+		deletedToday := reaper.deletionsInBudgetWindow()
+		if deletedToday+numReady > maxPerDay {
+			return fmt.Errorf(
+				"%d resources are ready for deletion and %d were deleted in the last 24 hours, over the limit of %d per day",
+				numReady, deletedToday, maxPerDay,
+			)
+		}
+	}
+	return nil
+}
+
+// deletionsInBudgetWindow returns the number of resources the reaper deleted within the
+// last deletionBudgetWindow. The deletions are counted from the reaper's audit log, so
+// that the budget is kept across restarts of the server. Without an audit log, or if it
+// cannot be read, the deletions the reaper has recorded in memory are counted instead.
+func (reaper *Reaper) deletionsInBudgetWindow() int {
+	windowStart := reaper.Clock.Now().Add(-deletionBudgetWindow)
+	if reaper.auditLog != nil {
+		deletedInWindow, err := reaper.auditLog.DeletionsSince(reaper.UUID, windowStart)
+		if err == nil {
+			return deletedInWindow
+		}
+		logger.With(logger.Reaper(reaper.UUID), logger.Err(err)).Errorf(
+			"Counting deletions in the audit log failed, so only deletions since the reaper started count towards its daily limit: %s",
+			err.Error(),
+		)
+	}
+	var recentDeletions []time.Time
+	for _, deletionTime := range reaper.deletionTimes {
+		if deletionTime.After(windowStart) {
+			recentDeletions = append(recentDeletions, deletionTime)
+		}
+	}
+	reaper.deletionTimes = recentDeletions
+	return len(recentDeletions)
+}
+
+// recordDeletion records that the reaper deleted a resource, for the daily deletion budget.
+func (reaper *Reaper) recordDeletion() {
+	reaper.deletionTimes = append(reaper.deletionTimes, reaper.Clock.Now())
+}
+
+// pause stops the reaper from sweeping until its config is updated, and raises an alert
+// with the reason in the logs, to the reaper's notifiers and to its event sink.
+func (reaper *Reaper) pause(ctx context.Context, reason error) {
+	reaper.Paused = true
+	reaper.PauseReason = reason.Error()
+	logger.With(logger.Reaper(reaper.UUID)).Errorf(
+		"ALERT: Reaper %s paused because %s. Update the reaper's config to resume it",
+		reaper.UUID, reaper.PauseReason,
+	)
+	notifier.NotifyAll(ctx, reaper.notifiers, &notifier.Notification{
+		Event:      notifier.ReaperPaused,
+		ReaperUUID: reaper.UUID,
+		Reason:     reaper.PauseReason,
+	})
+	events.Publish(ctx, reaper.eventSink, events.NewPausedEvent(reaper.UUID, reason, reaper.Clock.Now()))
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/metrics"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// recordWatchlistMetrics records the number of resources of each type in the reaper's
+// Watchlist, and the age of the oldest one.
+func (reaper *Reaper) recordWatchlistMetrics() {
+	watchlist := make(map[reaperconfig.ResourceType]metrics.WatchedResources)
+	for _, watchedResource := range reaper.Watchlist {
+		watched := watchlist[watchedResource.Type]
+		watched.Count++
+		timeCreated := watchedResource.TimeCreated
+		if !timeCreated.IsZero() && (watched.OldestCreated.IsZero() || timeCreated.Before(watched.OldestCreated)) {
+			watched.OldestCreated = timeCreated
+		}
+		watchlist[watchedResource.Type] = watched
+	}
+	metrics.SetWatchlist(reaper.UUID, watchlist, reaper.Clock.Now())
+}
+
+// recordSweepMetrics records the deletions and failures of a sweep and how long it took.
+// A sweep is successful if it was not paused or cancelled and every resource it tried to
+// delete was deleted.
+func (reaper *Reaper) recordSweepMetrics(result SweepResult) {
+	for _, outcome := range result.outcomes {
+		if outcome.err != nil {
+			metrics.RecordFailed(reaper.UUID, outcome.resource.Type)
+		} else {
+			metrics.RecordDeleted(reaper.UUID, outcome.resource.Type)
+		}
+	}
+	metrics.RecordSweep(reaper.UUID, result.Duration, !result.Paused && !result.Cancelled && result.Failed == 0)
+	reaper.recordWatchlistMetrics()
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"context"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/notifier"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+)
+
+// A deletionWarning records when the reaper warned that a resource would be deleted, and
+// the deletion time of the resource when it did.
+type deletionWarning struct {
+	deletionTime time.Time
+	sentAt       time.Time
+}
+
+// warnUpcomingDeletions sends a DeletionWarning for the watched resources that will be
+// deleted within the warning lead time, including those already past their deletion time.
+// Each resource is warned about once, unless its deletion time changes. As a resource is
+// not deleted until the lead time has passed since it was warned about, the warning gives
+// the later of its deletion time and the end of the lead time.
+func (reaper *Reaper) warnUpcomingDeletions(ctx context.Context) {
+	leadTime := reaper.warningLeadTime()
+	if len(reaper.notifiers) == 0 || leadTime <= 0 {
+		return
+	}
+
+	warned := make(map[watchlistKey]deletionWarning)
+	var warningResources []notifier.Resource
+	now := reaper.Clock.Now()
+	warningCutoff := now.Add(leadTime)
+	for _, watchedResource := range reaper.Watchlist {
+		deletionTime, err := watchedResource.GetDeletionTime()
+		if err != nil || deletionTime.After(warningCutoff) {
+			continue
+		}
+		projectID := reaper.projectOf(watchedResource.Resource)
+		key := newWatchlistKey(projectID, watchedResource.Resource)
+		if warning, isWarned := reaper.warned[key]; isWarned && warning.deletionTime.Equal(deletionTime) {
+			warned[key] = warning
+			continue
+		}
+		warned[key] = deletionWarning{deletionTime: deletionTime, sentAt: now}
+		if deletionTime.Before(warningCutoff) {
+			deletionTime = warningCutoff
+		}
+		warningResources = append(warningResources, notifier.NewWarningResource(projectID, watchedResource.Resource, deletionTime))
+	}
+	reaper.warned = warned
+
+	if len(warningResources) == 0 {
+		return
+	}
+	notifier.NotifyAll(ctx, reaper.notifiers, &notifier.Notification{
+		Event:      notifier.DeletionWarning,
+		ReaperUUID: reaper.UUID,
+		Resources:  warningResources,
+	})
+}
+
+// awaitsWarning returns whether deleting the watched resource in the given project has to
+// wait because the reaper sends warnings and has not yet warned about the resource for at
+// least the warning lead time.
+func (reaper *Reaper) awaitsWarning(projectID string, watchedResource *resources.WatchedResource) bool {
+	leadTime := reaper.warningLeadTime()
+	if len(reaper.notifiers) == 0 || leadTime <= 0 {
+		return false
+	}
+	warning, isWarned := reaper.warned[newWatchlistKey(projectID, watchedResource.Resource)]
+	return !isWarned || reaper.Clock.Now().Sub(warning.sentAt) < leadTime
+}
+
+// notifySweep sends a SweepSummary of the resources that the sweep deleted and failed to
+// delete. Nothing is sent for sweeps that did neither.
+func (reaper *Reaper) notifySweep(ctx context.Context, result SweepResult) {
+	if len(reaper.notifiers) == 0 || len(result.outcomes) == 0 {
+		return
+	}
+	var deletedResources, failedResources []notifier.Resource
+	for _, outcome := range result.outcomes {
+		if outcome.err != nil {
+			failedResources = append(failedResources, notifier.NewFailedResource(outcome.projectID, outcome.resource, outcome.err))
+		} else {
+			deletedResources = append(deletedResources, notifier.NewResource(outcome.projectID, outcome.resource))
+		}
+	}
+	notifier.NotifyAll(ctx, reaper.notifiers, &notifier.Notification{
+		Event:      notifier.SweepSummary,
+		ReaperUUID: reaper.UUID,
+		Deleted:    deletedResources,
+		Failed:     failedResources,
+	})
+}
+
+// warningLeadTime returns how long before deleting a resource the reaper warns about it,
+// or zero if the reaper does not send warnings.
+func (reaper *Reaper) warningLeadTime() time.Duration {
+	leadTimeString := reaper.config.GetNotifications().GetWarningLeadTime()
+	if len(leadTimeString) == 0 {
+		return 0
+	}
+	leadTime, err := time.ParseDuration(leadTimeString)
+	if err != nil {
+		logger.With(logger.Reaper(reaper.UUID), logger.Err(err)).Errorf("Parsing warning lead time failed with the following error: %s", err.Error())
+		return 0
+	}
+	return leadTime
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/metrics"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+)
+
+// quarantineAction is what a sweep should do with a resource that has passed its TTL.
+type quarantineAction int
+
+const (
+	// deleteResource means the resource should be deleted, either because it has no
+	// quarantine period or because its quarantine is over.
+	deleteResource quarantineAction = iota
+	// quarantineResource means the resource should be quarantined.
+	quarantineResource
+	// keepResource means the resource is in quarantine, or its quarantine was aborted,
+	// and should be left alone.
+	keepResource
+)
+
+// quarantineActionFor returns what to do with the given resource, which has passed its TTL.
+// A resource that the reaper quarantined but that no longer has the QuarantineLabel has
+// had its quarantine aborted, and is never quarantined or deleted again by the reaper.
+// The abort is read from the resource's labels, so it survives reaper restarts.
+func (reaper *Reaper) quarantineActionFor(projectID string, watchedResource *resources.WatchedResource) quarantineAction {
+	if watchedResource.QuarantinePeriod <= 0 {
+		return deleteResource
+	}
+	if watchedResource.QuarantineAborted(reaper.UUID) {
+		reaper.resourceLog(projectID, watchedResource.Resource).Debugf(
+			"Kept %s resource %s in zone %s of project %s because its quarantine was aborted by removing its %s label",
+			watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone, projectID, resources.QuarantineLabel,
+		)
+		return keepResource
+	}
+	if quarantinedAt, isQuarantined := watchedResource.QuarantineTime(); isQuarantined {
+		if reaper.Clock.Now().After(quarantinedAt.Add(watchedResource.QuarantinePeriod)) {
+			return deleteResource
+		}
+		return keepResource
+	}
+	return quarantineResource
+}
+
+// quarantineResources quarantines the given resources that need quarantining, and returns
+// the resources to keep in the Watchlist, which were quarantined or failed to be quarantined,
+// and the resources that should be deleted. Resources whose client cannot quarantine them are
+// deleted straight away.
+func (reaper *Reaper) quarantineResources(resourceClient clients.Client, projectID string, watchedResources []*resources.WatchedResource, result *SweepResult) ([]*resources.WatchedResource, []*resources.WatchedResource) {
+	quarantiner, isQuarantiner := resourceClient.(clients.Quarantiner)
+
+	var keptResources, resourcesToDelete []*resources.WatchedResource
+	for _, watchedResource := range watchedResources {
+		if !isQuarantiner || reaper.quarantineActionFor(projectID, watchedResource) != quarantineResource {
+			resourcesToDelete = append(resourcesToDelete, watchedResource)
+			continue
+		}
+		start := time.Now()
+		err := quarantiner.Quarantine(projectID, watchedResource.Resource, resources.QuarantineLabels(reaper.UUID, reaper.Clock.Now()))
+		metrics.ObserveAPICall(watchedResource.Type, metrics.QuarantineCall, start, err)
+		if err != nil {
+			reaper.resourceLog(projectID, watchedResource.Resource).With(logger.Err(err)).Errorf(
+				"%s client failed to quarantine resource %s in project %s with the following error: %s",
+				watchedResource.Type.String(), watchedResource.Name, projectID, err.Error(),
+			)
+			result.failed(projectID, watchedResource.Resource, err)
+			keptResources = append(keptResources, watchedResource)
+			continue
+		}
+		reaper.resourceLog(projectID, watchedResource.Resource).Infof(
+			"Quarantined %s resource %s in zone %s of project %s for %s",
+			watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone, projectID, watchedResource.QuarantinePeriod,
+		)
+		keptResources = append(keptResources, watchedResource)
+		result.Quarantined++
+	}
+	return keptResources, resourcesToDelete
+}
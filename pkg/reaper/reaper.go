@@ -16,28 +16,54 @@ package reaper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/audit"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/credentials"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/metrics"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/notifier"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/projects"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
 	"github.com/robfig/cron/v3"
+	"go.opencensus.io/trace"
 	"google.golang.org/api/option"
 )
 
-// Reaper represents the resource reaper for a single GCP project. The reaper will
-// run on a given schedule defined in cron time format.
+// Reaper represents the resource reaper for one or more GCP projects. ProjectID is the
+// project named in the reaper's config, and any other projects are found from the config
+// each time the reaper gets resources. The reaper will run on a given schedule defined
+// in cron time format.
 type Reaper struct {
 	UUID      string
 	ProjectID string
 	Watchlist []*resources.WatchedResource
 	Schedule  cron.Schedule
 
-	config  *reaperconfig.ReaperConfig
-	lastRun time.Time
+	// Paused is set when a sweep would exceed one of the reaper's deletion limits, and
+	// PauseReason describes the limit. A paused reaper does not run until its config is
+	// updated.
+	Paused      bool
+	PauseReason string
+
+	config            *reaperconfig.ReaperConfig
+	lastRun           time.Time
+	firstSeen         *resources.FirstSeenTracker
+	credentialOptions []option.ClientOption
+	deletionTimes     []time.Time
+	protection        *resources.ProtectionPolicy
+	notifiers         []notifier.Notifier
+	eventSink         events.Sink
+	auditLog          *audit.Log
+	warned            map[watchlistKey]deletionWarning
+	configSpan        trace.SpanContext
 	*Clock
 }
 
@@ -65,57 +91,319 @@ func NewReaper() *Reaper {
 }
 
 // RunOnSchedule updates the reaper's watchlist and runs a sweep if the current time is equal to or after
-// the next schedule run time.
+// the next schedule run time, unless the reaper is paused. The given client options are the defaults,
+// which are combined with the credentials in the reaper's config. Each run is traced as its own span.
+// If the context is cancelled while the watchlist is updated, the sweep is skipped, and if it is
+// cancelled during the sweep, the sweep stops at its next safe point.
 func (reaper *Reaper) RunOnSchedule(ctx context.Context, clientOptions ...option.ClientOption) bool {
+	if reaper.Paused {
+		return false
+	}
 	nextRun := reaper.Schedule.Next(reaper.lastRun)
 	if reaper.lastRun.IsZero() || reaper.Clock.Now().After(nextRun) || reaper.Clock.Now().Equal(nextRun) {
-		logger.Logf("Running reaper with UUID: %s\n", reaper.UUID)
+		ctx, span := reaper.startRunSpan(ctx)
+		defer span.End()
+
+		reaperLog := logger.With(logger.Reaper(reaper.UUID))
+		reaperLog.Infof("Running reaper with UUID: %s", reaper.UUID)
+		clientOptions, err := reaper.clientOptions(clientOptions...)
+		if err != nil {
+			reaperLog.With(logger.Err(err)).Errorf("Reaper %s failed to get credentials with the following error: %s", reaper.UUID, err.Error())
+			tracing.RecordError(span, err)
+			return false
+		}
 		reaper.GetResources(ctx, clientOptions...)
+		if ctx.Err() != nil {
+			reaperLog.Warnf("Reaper %s skipped its sweep because it is stopping", reaper.UUID)
+			return false
+		}
 
-		logger.Logf("Reaper %s sweeping through the following resources: %s", reaper.UUID, reaper.WatchlistString())
-		reaper.SweepThroughResources(ctx, clientOptions...)
+		reaperLog.Debugf("Reaper %s sweeping through the following resources: %s", reaper.UUID, reaper.WatchlistString())
+		sweepResult := reaper.SweepThroughResources(ctx, clientOptions...)
+		reaperLog.With(
+			logger.F("deleted", sweepResult.Deleted), logger.F("failed", sweepResult.Failed), logger.F("blocked", sweepResult.Blocked),
+			logger.F("quarantined", sweepResult.Quarantined), logger.F("backed_up", sweepResult.BackedUp),
+			logger.F("duration_seconds", sweepResult.Duration.Seconds()),
+		).Infof(
+			"Reaper %s deleted %d, quarantined %d and backed up %d resources with %d failures and %d blocked in %s (%.1f resources/s)",
+			reaper.UUID, sweepResult.Deleted, sweepResult.Quarantined, sweepResult.BackedUp, sweepResult.Failed, sweepResult.Blocked,
+			sweepResult.Duration.Round(time.Millisecond), sweepResult.DeletesPerSecond(),
+		)
+		if sweepResult.Cancelled {
+			reaperLog.Warnf("Reaper %s stopped its sweep early because it is stopping", reaper.UUID)
+			return true
+		}
 		reaper.lastRun = reaper.Clock.Now()
 		return true
 	}
 	return false
 }
 
+// SweepResult summarizes the deletions made during a single sweep through a reaper's
+// Watchlist. Blocked counts the resources that the protection policy stopped from being
+// deleted, Quarantined counts the resources quarantined before deletion, and BackedUp counts
+// the resources backed up before deletion. Paused is set if the sweep exceeded a deletion
+// limit, in which case nothing was deleted, and Cancelled is set if the sweep stopped early
+// because its context was cancelled.
+type SweepResult struct {
+	Deleted     int
+	Failed      int
+	Blocked     int
+	Quarantined int
+	BackedUp    int
+	Duration    time.Duration
+	Paused      bool
+	Cancelled   bool
+
+	outcomes []sweepOutcome
+}
+
+// sweepOutcome is the outcome of trying to delete a resource during a sweep. The error is
+// nil if the resource was deleted.
+type sweepOutcome struct {
+	projectID string
+	resource  *resources.Resource
+	err       error
+}
+
+// deleted records that the sweep deleted the resource.
+func (result *SweepResult) deleted(projectID string, resource *resources.Resource) {
+	result.Deleted++
+	result.outcomes = append(result.outcomes, sweepOutcome{projectID, resource, nil})
+}
+
+// failed records that the sweep failed to delete the resource because of the error.
+func (result *SweepResult) failed(projectID string, resource *resources.Resource, err error) {
+	result.Failed++
+	result.outcomes = append(result.outcomes, sweepOutcome{projectID, resource, err})
+}
+
+// DeletesPerSecond returns the number of resources deleted per second during the sweep.
+func (result SweepResult) DeletesPerSecond() float64 {
+	if result.Duration <= 0 {
+		return 0
+	}
+	return float64(result.Deleted) / result.Duration.Seconds()
+}
+
 // SweepThroughResources goes through all the resources in the reaper's Watchlist, and for each resource
 // determines if it needs to be deleted. The necessary resources are deleted from GCP and the reaper's
-// Watchlist is updated accordingly.
-func (reaper *Reaper) SweepThroughResources(ctx context.Context, clientOptions ...option.ClientOption) {
-	var updatedWatchlist []*resources.WatchedResource
+// Watchlist is updated accordingly. Resources are deleted in batches for resource types whose client
+// supports it. Resources protected by the reaper's protection policy are never deleted, and each attempt
+// to delete one is logged as a policy violation. If deleting the remaining ready resources would exceed
+// one of the reaper's deletion limits, nothing is deleted and the reaper is paused, which is alerted to
+// the reaper's notifiers and event sink. Resources with a
+// quarantine period are quarantined when they pass their TTL, and deleted once the period is over.
+// Every attempt to delete a resource, including those blocked by the protection policy, is recorded in
+// the reaper's audit log. Before anything is deleted, the reaper's notifiers are warned about the
+// resources that will be deleted within the warning lead time, and a resource is only deleted once the
+// lead time has passed since it was warned about. Once the sweep is done, its deletions and failures
+// are summarized to the reaper's notifiers, published to the reaper's event sink and recorded in the
+// reaper's metrics. Each
+// deletion is traced as its own span. Cancelling the context does not cut off API calls that have
+// started. Instead, the sweep stops before the next batch or deletion, and the resources it did not
+// get to are kept in the Watchlist. Resources that were blocked or failed to be deleted are also kept,
+// so that the next run does not report them as newly discovered.
+func (reaper *Reaper) SweepThroughResources(ctx context.Context, clientOptions ...option.ClientOption) SweepResult {
+	ctx, span := tracing.StartSpan(ctx, "Reaper.SweepThroughResources", trace.StringAttribute(tracing.ReaperAttribute, reaper.UUID))
+	defer span.End()
+	stopCtx := ctx
+	ctx = uncancelledContext{ctx}
+
+	var result SweepResult
+	start := time.Now()
+	reaper.warnUpcomingDeletions(ctx)
 
+	var updatedWatchlist []*resources.WatchedResource
+	var batchKeys []sweepBatchKey
+	readyResources := make(map[sweepBatchKey][]*resources.WatchedResource)
+	numReady := 0
 	for _, watchedResource := range reaper.Watchlist {
-		if watchedResource.IsReadyForDeletion() {
-			resourceClient, err := getAuthedClient(ctx, reaper, watchedResource.Type, clientOptions...)
-			if err != nil {
-				logger.Error(err)
-				continue
+		if !watchedResource.IsReadyForDeletion() {
+			updatedWatchlist = append(updatedWatchlist, watchedResource)
+			continue
+		}
+		projectID := reaper.projectOf(watchedResource.Resource)
+		if violation := reaper.protection.Violation(projectID, watchedResource.Resource); len(violation) > 0 {
+			reaper.resourceLog(projectID, watchedResource.Resource).Errorf(
+				"POLICY VIOLATION: Reaper %s blocked from deleting %s resource %s in zone %s of project %s because %s",
+				reaper.UUID, watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone, projectID, violation,
+			)
+			reaper.audit(projectID, watchedResource, reaperconfig.AuditOutcome_BLOCKED, fmt.Errorf("protected by policy: %s", violation))
+			result.Blocked++
+			updatedWatchlist = append(updatedWatchlist, watchedResource)
+			continue
+		}
+		if reaper.awaitsWarning(projectID, watchedResource) {
+			reaper.resourceLog(projectID, watchedResource.Resource).Infof(
+				"Reaper %s deferred deleting %s resource %s in zone %s of project %s until the warning lead time has passed since it was warned about",
+				reaper.UUID, watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone, projectID,
+			)
+			updatedWatchlist = append(updatedWatchlist, watchedResource)
+			continue
+		}
+		if reaper.quarantineActionFor(projectID, watchedResource) == keepResource {
+			updatedWatchlist = append(updatedWatchlist, watchedResource)
+			continue
+		}
+		numReady++
+		batchKey := sweepBatchKey{watchedResource.Type, projectID}
+		if _, isBatchReady := readyResources[batchKey]; !isBatchReady {
+			batchKeys = append(batchKeys, batchKey)
+		}
+		readyResources[batchKey] = append(readyResources[batchKey], watchedResource)
+	}
+
+	if err := reaper.checkDeletionLimits(numReady, len(reaper.Watchlist)); err != nil {
+		reaper.pause(ctx, err)
+		result.Paused = true
+		result.Duration = time.Since(start)
+		reaper.recordSweepMetrics(result)
+		return result
+	}
+
+	for idx, batchKey := range batchKeys {
+		if stopCtx.Err() != nil {
+			for _, remainingKey := range batchKeys[idx:] {
+				updatedWatchlist = append(updatedWatchlist, readyResources[remainingKey]...)
 			}
+			result.Cancelled = true
+			break
+		}
+		watchedResources := readyResources[batchKey]
+		resourceClient, err := getAuthedClient(ctx, reaper, batchKey.resourceType, clientOptions...)
+		if err != nil {
+			logger.With(logger.Reaper(reaper.UUID), logger.ResourceType(batchKey.resourceType), logger.Project(batchKey.projectID)).Error(err)
+			for _, watchedResource := range watchedResources {
+				reaper.audit(batchKey.projectID, watchedResource, reaperconfig.AuditOutcome_FAILED, err)
+				result.failed(batchKey.projectID, watchedResource.Resource, err)
+			}
+			updatedWatchlist = append(updatedWatchlist, watchedResources...)
+			continue
+		}
+
+		keptResources, watchedResources := reaper.quarantineResources(resourceClient, batchKey.projectID, watchedResources, &result)
+		updatedWatchlist = append(updatedWatchlist, keptResources...)
+		failedBackups, watchedResources := reaper.backupResources(resourceClient, batchKey.projectID, watchedResources, &result)
+		updatedWatchlist = append(updatedWatchlist, failedBackups...)
 
-			if err := resourceClient.DeleteResource(reaper.ProjectID, watchedResource.Resource); err != nil {
+		deleteErrors := deleteResources(ctx, stopCtx, resourceClient, batchKey.resourceType, batchKey.projectID, watchedResources)
+		for idx, watchedResource := range watchedResources {
+			if errors.Is(deleteErrors[idx], errSweepStopped) {
+				updatedWatchlist = append(updatedWatchlist, watchedResource)
+				result.Cancelled = true
+				continue
+			}
+			if err := deleteErrors[idx]; err != nil {
 				deleteError := fmt.Errorf(
-					"%s client failed to delete resource %s with the following error: %s",
-					watchedResource.Type.String(), watchedResource.Name, err.Error(),
+					"%s client failed to delete resource %s in project %s with the following error: %s",
+					watchedResource.Type.String(), watchedResource.Name, batchKey.projectID, err.Error(),
 				)
-				logger.Error(deleteError)
+				reaper.resourceLog(batchKey.projectID, watchedResource.Resource).With(logger.Err(err)).Error(deleteError)
+				reaper.audit(batchKey.projectID, watchedResource, reaperconfig.AuditOutcome_FAILED, err)
+				result.failed(batchKey.projectID, watchedResource.Resource, err)
+				updatedWatchlist = append(updatedWatchlist, watchedResource)
 				continue
 			}
-			logger.Logf(
-				"Deleted %s resource %s in zone %s\n",
-				watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
+			reaper.resourceLog(batchKey.projectID, watchedResource.Resource).Infof(
+				"Deleted %s resource %s in zone %s of project %s",
+				watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone, batchKey.projectID,
 			)
-		} else {
-			updatedWatchlist = append(updatedWatchlist, watchedResource)
+			reaper.audit(batchKey.projectID, watchedResource, reaperconfig.AuditOutcome_DELETED, nil)
+			reaper.firstSeenTracker().Forget(reaper.UUID, batchKey.projectID, watchedResource.Resource)
+			reaper.recordDeletion()
+			result.deleted(batchKey.projectID, watchedResource.Resource)
 		}
 	}
 	reaper.Watchlist = updatedWatchlist
+	reaper.saveFirstSeen()
+	reaper.notifySweep(ctx, result)
+	reaper.publishSweepEvents(ctx, result)
+
+	result.Duration = time.Since(start)
+	reaper.recordSweepMetrics(result)
+	return result
+}
+
+// sweepBatchKey identifies a group of resources that are deleted together during a sweep.
+type sweepBatchKey struct {
+	resourceType reaperconfig.ResourceType
+	projectID    string
+}
+
+// errSweepStopped is returned for a resource that a sweep did not try to delete because the
+// sweep was stopped.
+var errSweepStopped = errors.New("sweep stopped before deleting the resource")
+
+// deleteResources deletes the given resources with the client, in a single batch if the
+// client is a BatchDeleter. The returned errors line up with the given resources. A batch
+// counts as a failed API call if any of its deletions failed. Resources that are deleted one
+// at a time are not deleted once stopCtx is done, and errSweepStopped is returned for them.
+func deleteResources(ctx, stopCtx context.Context, resourceClient clients.Client, resourceType reaperconfig.ResourceType, projectID string, watchedResources []*resources.WatchedResource) []error {
+	if batchDeleter, isBatchDeleter := resourceClient.(clients.BatchDeleter); isBatchDeleter && len(watchedResources) > 0 {
+		resourcesToDelete := make([]*resources.Resource, len(watchedResources))
+		for idx, watchedResource := range watchedResources {
+			resourcesToDelete[idx] = watchedResource.Resource
+		}
+		_, span := tracing.StartSpan(
+			ctx, "Client.DeleteResources",
+			resourceTypeAttribute(resourceType),
+			trace.StringAttribute(tracing.ProjectAttribute, projectID),
+			trace.Int64Attribute("reaper.batch_size", int64(len(resourcesToDelete))),
+		)
+		start := time.Now()
+		deleteErrors := batchDeleter.DeleteResources(projectID, resourcesToDelete)
+		metrics.ObserveAPICall(resourceType, metrics.DeleteResourcesCall, start, firstError(deleteErrors))
+		tracing.EndSpan(span, firstError(deleteErrors))
+		return deleteErrors
+	}
+
+	deleteErrors := make([]error, len(watchedResources))
+	for idx, watchedResource := range watchedResources {
+		if stopCtx.Err() != nil {
+			deleteErrors[idx] = errSweepStopped
+			continue
+		}
+		_, span := startResourceSpan(ctx, "Client.DeleteResource", projectID, watchedResource.Resource)
+		start := time.Now()
+		deleteErrors[idx] = resourceClient.DeleteResource(projectID, watchedResource.Resource)
+		metrics.ObserveAPICall(resourceType, metrics.DeleteResourceCall, start, deleteErrors[idx])
+		tracing.EndSpan(span, deleteErrors[idx])
+	}
+	return deleteErrors
+}
+
+// uncancelledContext has the values of its parent context, such as its trace span, but is never
+// cancelled. It is used for the API calls of a sweep, so that stopping the sweep never cuts off a
+// deletion that has started. Notifications sent during a sweep still time out, as NotifyAll gives
+// each notification its own deadline.
+type uncancelledContext struct {
+	context.Context
+}
+
+func (uncancelledContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (uncancelledContext) Done() <-chan struct{} { return nil }
+
+func (uncancelledContext) Err() error { return nil }
+
+// firstError returns the first of the errors that is not nil, or nil if there is none.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // UpdateReaperConfig updates the reaper from a given ReaperConfig proto.
 func (reaper *Reaper) UpdateReaperConfig(config *reaperconfig.ReaperConfig) error {
 	reaper.config = config
+	reaper.credentialOptions = nil
+	reaper.notifiers = notifier.New(config.GetNotifications())
+	reaper.Paused = false
+	reaper.PauseReason = ""
 
 	reaper.ProjectID = config.GetProjectId()
 	reaper.UUID = config.GetUuid()
@@ -125,59 +413,243 @@ func (reaper *Reaper) UpdateReaperConfig(config *reaperconfig.ReaperConfig) erro
 	return err
 }
 
-// GetResources gets all the GCP resources defined in the ReaperConfig, and adds them to the
-// reaper's Watchlist. Note, if the same resource is referenced by multiple ResourceConfigs,
-// then the TTL of that resource will be the one that deletes the resource the latest.
+// Config returns the reaper's current ReaperConfig.
+func (reaper *Reaper) Config() *reaperconfig.ReaperConfig {
+	return reaper.config
+}
+
+// GetResources gets all the GCP resources defined in the ReaperConfig from every project the
+// reaper targets, and adds them to the reaper's Watchlist. Note, if the same resource is
+// referenced by multiple ResourceConfigs, then the TTL of that resource will be the one that
+// deletes the resource the latest. Resources that are new to the Watchlist, or whose
+// deletion time has changed, are published to the reaper's event sink. The first seen times
+// of resources that were not listed are pruned.
 func (reaper *Reaper) GetResources(ctx context.Context, clientOptions ...option.ClientOption) {
 	var newWatchlist []*resources.WatchedResource
-	newWatchedResources := make(map[string]map[string]*resources.WatchedResource)
+	newWatchedResources := make(map[watchlistKey]*resources.WatchedResource)
+	failedListings := make(map[listingKey]bool)
+
+	projectIDs, err := projects.GetProjectIDs(ctx, reaper.config, clientOptions...)
+	if err != nil {
+		logger.With(logger.Reaper(reaper.UUID), logger.Err(err)).Errorf("Finding projects failed with the following error: %s", err.Error())
+	}
 
 	resourceConfigs := reaper.config.GetResources()
 	for _, resourceConfig := range resourceConfigs {
-		resourceType := resourceConfig.GetResourceType()
+		reaper.watchResources(ctx, resourceConfig, projectIDs, newWatchedResources, failedListings, clientOptions...)
+	}
+	// Converting resources map into list
+	for _, resource := range newWatchedResources {
+		newWatchlist = append(newWatchlist, resource)
+	}
+	reaper.publishWatchlistEvents(ctx, newWatchlist)
+	reaper.Watchlist = newWatchlist
+	reaper.pruneFirstSeen(projectIDs, newWatchlist, failedListings)
+	reaper.saveFirstSeen()
+	reaper.recordWatchlistMetrics()
+}
+
+// listingKey identifies the listing of the resources of a type in a project.
+type listingKey struct {
+	projectID    string
+	resourceType reaperconfig.ResourceType
+}
 
-		resourceClient, err := getAuthedClient(ctx, reaper, resourceType, clientOptions...)
+// pruneFirstSeen prunes the first seen times of the resources of each type in each project
+// that are not in the watchlist. Types and projects whose listing failed are not pruned, as
+// their resources may still exist.
+func (reaper *Reaper) pruneFirstSeen(projectIDs []string, watchlist []*resources.WatchedResource, failedListings map[listingKey]bool) {
+	listed := make(map[listingKey][]*resources.Resource)
+	for _, watchedResource := range watchlist {
+		key := listingKey{reaper.projectOf(watchedResource.Resource), watchedResource.Type}
+		listed[key] = append(listed[key], watchedResource.Resource)
+	}
+	for _, projectID := range projectIDs {
+		for _, resourceConfig := range reaper.config.GetResources() {
+			key := listingKey{projectID, resourceConfig.GetResourceType()}
+			if !failedListings[key] {
+				reaper.firstSeenTracker().Prune(reaper.UUID, projectID, key.resourceType, listed[key])
+			}
+		}
+	}
+}
+
+// watchResources gets the resources defined in a single ResourceConfig from each of the
+// projects, and adds them to the given resources by their watchlist keys. The projects whose
+// resources could not be listed are added to failedListings. Getting the resources is traced
+// as its own span.
+func (reaper *Reaper) watchResources(ctx context.Context, resourceConfig *reaperconfig.ResourceConfig, projectIDs []string, newWatchedResources map[watchlistKey]*resources.WatchedResource, failedListings map[listingKey]bool, clientOptions ...option.ClientOption) {
+	resourceType := resourceConfig.GetResourceType()
+	ctx, span := tracing.StartSpan(
+		ctx, "Reaper.GetResources",
+		trace.StringAttribute(tracing.ReaperAttribute, reaper.UUID), resourceTypeAttribute(resourceType),
+	)
+	defer span.End()
+	configLog := logger.With(logger.Reaper(reaper.UUID), logger.ResourceType(resourceType))
+
+	failAllListings := func() {
+		for _, projectID := range projectIDs {
+			failedListings[listingKey{projectID, resourceType}] = true
+		}
+	}
+	resourceClient, err := getAuthedClient(ctx, reaper, resourceType, clientOptions...)
+	if err != nil {
+		configLog.Error(err)
+		tracing.RecordError(span, err)
+		failAllListings()
+		return
+	}
+
+	var quarantinePeriod time.Duration
+	if len(resourceConfig.GetQuarantinePeriod()) > 0 {
+		quarantinePeriod, err = time.ParseDuration(resourceConfig.GetQuarantinePeriod())
 		if err != nil {
-			logger.Error(err)
-			continue
+			configLog.With(logger.Err(err)).Errorf("Parsing quarantine period failed with the following error: %s", err.Error())
+			tracing.RecordError(span, err)
+			failAllListings()
+			return
 		}
+	}
 
-		filteredResources, err := resourceClient.GetResources(reaper.ProjectID, resourceConfig)
+	for _, projectID := range projectIDs {
+		start := time.Now()
+		filteredResources, err := resourceClient.GetResources(projectID, resourceConfig)
+		metrics.ObserveAPICall(resourceType, metrics.GetResourcesCall, start, err)
 		if err != nil {
 			getResourcesError := fmt.Errorf(
-				"%s client failed to get resources with the following error: %s",
-				resourceType.String(), err.Error(),
+				"%s client failed to get resources in project %s with the following error: %s",
+				resourceType.String(), projectID, err.Error(),
 			)
-			logger.Error(getResourcesError)
+			configLog.With(logger.Project(projectID), logger.Err(err)).Error(getResourcesError)
+			span.Annotate([]trace.Attribute{trace.StringAttribute(tracing.ProjectAttribute, projectID)}, err.Error())
+			failedListings[listingKey{projectID, resourceType}] = true
 			continue
 		}
+		for _, resource := range filteredResources {
+			resource.ProjectID = projectID
+		}
+		reaper.setMissingCreationTimes(filteredResources)
 		watchedResources := resources.CreateWatchlist(filteredResources, resourceConfig.GetTtl())
+		for _, watchedResource := range watchedResources {
+			watchedResource.QuarantinePeriod = quarantinePeriod
+			watchedResource.Backup = resourceConfig.GetBackup()
+			watchedResource.Config = resourceConfig
+		}
 
-		// Check for duplicates. If one exists, update the TTL by the max
+		// Check for duplicates. If one exists, update the TTL and quarantine period by the max,
+		// and force delete or back up the resource if any of its ResourceConfigs do.
 		for _, resource := range watchedResources {
-			if _, isZoneWatched := newWatchedResources[resource.Zone]; !isZoneWatched {
-				newWatchedResources[resource.Zone] = make(map[string]*resources.WatchedResource)
-			}
-
-			if _, alreadyWatched := newWatchedResources[resource.Zone][resource.Name]; alreadyWatched {
-				newTTL, err := maxTTL(resource, newWatchedResources[resource.Zone][resource.Name])
+			key := newWatchlistKey(projectID, resource.Resource)
+			if watchedResource, alreadyWatched := newWatchedResources[key]; alreadyWatched {
+				newTTL, err := maxTTL(resource, watchedResource)
 				if err != nil {
-					logger.Error(err)
+					configLog.With(logger.Project(projectID), logger.Zone(resource.Zone), logger.Resource(resource.Name)).Error(err)
 					continue
 				}
-				newWatchedResources[resource.Zone][resource.Name].TTL = newTTL
+				if newTTL != watchedResource.TTL {
+					watchedResource.TTL = newTTL
+					watchedResource.Config = resource.Config
+				}
+				watchedResource.ForceDelete = watchedResource.ForceDelete || resource.ForceDelete
+				if resource.QuarantinePeriod > watchedResource.QuarantinePeriod {
+					watchedResource.QuarantinePeriod = resource.QuarantinePeriod
+				}
+				if watchedResource.Backup == nil {
+					watchedResource.Backup = resource.Backup
+				}
 			} else {
-				newWatchedResources[resource.Zone][resource.Name] = resource
+				newWatchedResources[key] = resource
 			}
 		}
 	}
-	// Converting resources map into list
-	for zone := range newWatchedResources {
-		for _, resource := range newWatchedResources[zone] {
-			newWatchlist = append(newWatchlist, resource)
+}
+
+// watchlistKey uniquely identifies a resource in the reaper's Watchlist. Resources of
+// different types may share a name and zone, such as a Pub/Sub topic and subscription,
+// and noncurrent versions of a GCS object share its name.
+type watchlistKey struct {
+	projectID    string
+	resourceType reaperconfig.ResourceType
+	zone         string
+	name         string
+	generation   int64
+}
+
+// newWatchlistKey returns the key of the resource in the given project.
+func newWatchlistKey(projectID string, resource *resources.Resource) watchlistKey {
+	return watchlistKey{projectID, resource.Type, resource.Zone, resource.Name, resource.Generation}
+}
+
+// setMissingCreationTimes sets the creation time of resources whose client could not
+// determine one, such as Pub/Sub resources without a creation time label or resources
+// with an unparsable creation timestamp, to when the reaper first saw the resource.
+func (reaper *Reaper) setMissingCreationTimes(resourcesToCheck []*resources.Resource) {
+	for _, resource := range resourcesToCheck {
+		if resource.TimeCreated.IsZero() {
+			resource.TimeCreated = reaper.firstSeenTracker().FirstSeen(reaper.UUID, reaper.projectOf(resource), resource, reaper.Clock.Now())
 		}
 	}
-	reaper.Watchlist = newWatchlist
+}
+
+// clientOptions returns the default client options combined with the credentials in the
+// reaper's config. The options are created once and reused until the config is updated, so
+// that impersonated access tokens are reused between runs.
+func (reaper *Reaper) clientOptions(defaultOptions ...option.ClientOption) ([]option.ClientOption, error) {
+	if reaper.credentialOptions == nil {
+		// The impersonated token source outlives any single run, so it is not tied to the
+		// context of a run.
+		credentialOptions, err := credentials.ClientOptions(context.Background(), reaper.config.GetCredentials(), defaultOptions...)
+		if err != nil {
+			return nil, err
+		}
+		reaper.credentialOptions = credentialOptions
+	}
+	return reaper.credentialOptions, nil
+}
+
+// projectOf returns the project of the given resource, which is the reaper's ProjectID if
+// the resource was not found in any other project.
+func (reaper *Reaper) projectOf(resource *resources.Resource) string {
+	if len(resource.ProjectID) > 0 {
+		return resource.ProjectID
+	}
+	return reaper.ProjectID
+}
+
+// resourceLog returns a log entry with fields identifying the reaper and a resource in the
+// given project.
+func (reaper *Reaper) resourceLog(projectID string, resource *resources.Resource) *logger.Entry {
+	return logger.With(
+		logger.Reaper(reaper.UUID), logger.Project(projectID), logger.ResourceType(resource.Type),
+		logger.Zone(resource.Zone), logger.Resource(resource.Name),
+	)
+}
+
+// SetProtectionPolicy sets the policy for resources that the reaper must never delete.
+func (reaper *Reaper) SetProtectionPolicy(policy *resources.ProtectionPolicy) {
+	reaper.protection = policy
+}
+
+// SetFirstSeenTracker sets the tracker used to record when the reaper first saw resources
+// that have no creation time.
+func (reaper *Reaper) SetFirstSeenTracker(tracker *resources.FirstSeenTracker) {
+	reaper.firstSeen = tracker
+}
+
+// firstSeenTracker returns the reaper's FirstSeenTracker, creating one that is only kept in
+// memory if none has been set.
+func (reaper *Reaper) firstSeenTracker() *resources.FirstSeenTracker {
+	if reaper.firstSeen == nil {
+		reaper.firstSeen, _ = resources.NewFirstSeenTracker("")
+	}
+	return reaper.firstSeen
+}
+
+// saveFirstSeen persists the reaper's first seen times, logging any error.
+func (reaper *Reaper) saveFirstSeen() {
+	if err := reaper.firstSeenTracker().Save(); err != nil {
+		logger.With(logger.Reaper(reaper.UUID), logger.Err(err)).Errorf("Saving first seen times failed with the following error: %s", err.Error())
+	}
 }
 
 // WatchlistString returns a near sting of the reaper's Watchlist.
@@ -215,6 +687,7 @@ func NewResourceConfig(resourceType reaperconfig.ResourceType, zones []string, n
 }
 
 // getAuthedClient is a helper method for getting an authenticated GCP client for a given resource type.
+// Clients that can delete more than the resources they are given enforce the reaper's protection policy.
 func getAuthedClient(ctx context.Context, reaper *Reaper, resourceType reaperconfig.ResourceType, clientOptions ...option.ClientOption) (clients.Client, error) {
 	resourceClient, err := clients.NewClient(resourceType)
 	if err != nil {
@@ -225,7 +698,9 @@ func getAuthedClient(ctx context.Context, reaper *Reaper, resourceType reapercon
 		return nil, clientError
 	}
 
+	start := time.Now()
 	err = resourceClient.Auth(ctx, clientOptions...)
+	metrics.ObserveAPICall(resourceType, metrics.AuthCall, start, err)
 	if err != nil {
 		authError := fmt.Errorf(
 			"%s client failed authenticate with the following error: %s",
@@ -234,6 +709,9 @@ func getAuthedClient(ctx context.Context, reaper *Reaper, resourceType reapercon
 		return nil, authError
 	}
 
+	if enforcer, isEnforcer := resourceClient.(clients.ProtectionEnforcer); isEnforcer {
+		enforcer.SetProtectionPolicy(reaper.protection)
+	}
 	return resourceClient, nil
 }
 
@@ -24,9 +24,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/audit"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/events"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/metrics"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/notifier"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"go.opencensus.io/trace"
 	"google.golang.org/api/option"
 )
 
@@ -91,10 +98,308 @@ func TestSweepThroughResources(t *testing.T) {
 		testReaper := createTestReaper("testProject", "* * * * *", testCase.Watchlist...)
 		testReaper.FreezeTime(currentTime)
 
-		testReaper.SweepThroughResources(testContext, testClientOptions...)
+		result := testReaper.SweepThroughResources(testContext, testClientOptions...)
 		if !areWatchlistsEqual(testReaper, testCase.Expected) {
 			t.Errorf("Reaper not updated correctly after sweep through watched resources")
 		}
+		expectedDeleted := len(testCase.Watchlist) - len(testCase.Expected.Watchlist)
+		if result.Deleted != expectedDeleted || result.Failed != 0 {
+			t.Errorf("Sweep result deleted %d and failed %d; want %d and 0", result.Deleted, result.Failed, expectedDeleted)
+		}
+	}
+}
+
+type DeletionLimitsTestCase struct {
+	Limits         *reaperconfig.DeletionLimits
+	PriorDeletions int
+	ExpectedPaused bool
+}
+
+var deletionLimitsTestCases = []DeletionLimitsTestCase{
+	DeletionLimitsTestCase{nil, 0, false},
+	DeletionLimitsTestCase{&reaperconfig.DeletionLimits{MaxDeletionsPerSweep: 2}, 0, false},
+	DeletionLimitsTestCase{&reaperconfig.DeletionLimits{MaxDeletionsPerSweep: 1}, 0, true},
+	DeletionLimitsTestCase{&reaperconfig.DeletionLimits{MaxDeletionPercentage: 75}, 0, false},
+	DeletionLimitsTestCase{&reaperconfig.DeletionLimits{MaxDeletionPercentage: 50}, 0, true},
+	DeletionLimitsTestCase{&reaperconfig.DeletionLimits{MaxDeletionsPerDay: 5}, 3, false},
+	DeletionLimitsTestCase{&reaperconfig.DeletionLimits{MaxDeletionsPerDay: 4}, 3, true},
+}
+
+func TestDeletesPerSecond(t *testing.T) {
+	if rate := (SweepResult{Deleted: 3}).DeletesPerSecond(); rate != 0 {
+		t.Errorf("Rate of a sweep that took no time = %v; want 0", rate)
+	}
+	if rate := (SweepResult{Deleted: 3, Duration: 2 * time.Second}).DeletesPerSecond(); rate != 1.5 {
+		t.Errorf("Rate of 3 deletions in 2s = %v; want 1.5", rate)
+	}
+}
+
+func TestDeletionLimits(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	for _, testCase := range deletionLimitsTestCases {
+		// Two of the three watched resources are ready for deletion.
+		testReaper := createTestReaper("testProject", "* * * * *", reaperRunTestCases[0].Watchlist...)
+		testReaper.config = createReaperConfig("testProject", "* * * * *")
+		testReaper.config.DeletionLimits = testCase.Limits
+		testReaper.FreezeClock(currentTime)
+		testReaper.FreezeTime(currentTime)
+		for i := 0; i < testCase.PriorDeletions; i++ {
+			testReaper.deletionTimes = append(testReaper.deletionTimes, twoMinutesAgo, earlyTime)
+		}
+
+		result := testReaper.SweepThroughResources(testContext, testClientOptions...)
+		if result.Paused != testCase.ExpectedPaused || testReaper.Paused != testCase.ExpectedPaused {
+			t.Errorf("Reaper paused = %t with limits %v; want %t", testReaper.Paused, testCase.Limits, testCase.ExpectedPaused)
+		}
+		if testCase.ExpectedPaused && (result.Deleted != 0 || len(testReaper.Watchlist) != 3) {
+			t.Errorf("Paused reaper deleted %d resources; want none", result.Deleted)
+		}
+		if testCase.ExpectedPaused && testReaper.RunOnSchedule(testContext, testClientOptions...) {
+			t.Errorf("Paused reaper ran")
+		}
+	}
+}
+
+func TestDeletionLimitsFromAuditLog(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+	var notifications []notifier.Notification
+	receiver := createServer(func(w http.ResponseWriter, req *http.Request) {
+		var notification notifier.Notification
+		json.NewDecoder(req.Body).Decode(&notification)
+		notifications = append(notifications, notification)
+	})
+	defer receiver.Close()
+
+	// The audit log, which outlives the reaper, records two deletions in the last day and
+	// one before it.
+	auditLog, _ := audit.NewLog("")
+	deletedResource := resources.NewWatchedResource(resources.NewResource("Deleted", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM), "* * * * *")
+	for _, deletionTime := range []time.Time{twoMinutesAgo, currentTime.Add(-time.Hour), currentTime.AddDate(0, 0, -2)} {
+		auditLog.Record(audit.NewRecord("TestUUID", "testProject", deletedResource, reaperconfig.AuditOutcome_DELETED, nil, deletionTime))
+	}
+
+	// Two of the three watched resources are ready for deletion, which would make four
+	// deletions in the last day.
+	testReaper := createTestReaper("testProject", "* * * * *", copyWatchlist(reaperRunTestCases[0].Watchlist)...)
+	config := createReaperConfig("testProject", "* * * * *")
+	config.DeletionLimits = &reaperconfig.DeletionLimits{MaxDeletionsPerDay: 3}
+	config.Notifications = &reaperconfig.NotificationConfig{Webhooks: []*reaperconfig.Webhook{&reaperconfig.Webhook{Url: receiver.URL}}}
+	testReaper.UpdateReaperConfig(config)
+	sink := events.NewMemorySink()
+	testReaper.SetEventSink(sink)
+	testReaper.SetAuditLog(auditLog)
+	testReaper.FreezeClock(currentTime)
+	testReaper.FreezeTime(currentTime)
+
+	result := testReaper.SweepThroughResources(testContext, getTestClientOptions(server)...)
+	if !result.Paused || result.Deleted != 0 {
+		t.Fatalf("Sweep paused = %t and deleted %d resources; want a pause and no deletions", result.Paused, result.Deleted)
+	}
+	if len(notifications) != 1 || notifications[0].Event != notifier.ReaperPaused || notifications[0].Reason != testReaper.PauseReason {
+		t.Errorf("Notifications = %v; want a %s notification with reason %q", notifications, notifier.ReaperPaused, testReaper.PauseReason)
+	}
+	reaperEvents := sink.Events()
+	if len(reaperEvents) != 1 || reaperEvents[0].GetType() != reaperconfig.EventType_REAPER_PAUSED || reaperEvents[0].GetError() != testReaper.PauseReason {
+		t.Errorf("Events = %v; want a REAPER_PAUSED event with reason %q", reaperEvents, testReaper.PauseReason)
+	}
+}
+
+func TestSweepWithProtectionPolicy(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	// TestEarly and TestTwoMinuteAgo are ready for deletion, and TestEarly is protected.
+	testReaper := createTestReaper("testProject", "* * * * *", reaperRunTestCases[0].Watchlist...)
+	testReaper.FreezeTime(currentTime)
+	policy, _ := resources.NewProtectionPolicy(nil, nil, []string{"Early"})
+	testReaper.SetProtectionPolicy(policy)
+
+	result := testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if result.Blocked != 1 || result.Deleted != 1 {
+		t.Errorf("Sweep blocked %d and deleted %d resources; want 1 and 1", result.Blocked, result.Deleted)
+	}
+}
+
+func TestSweepWithQuarantine(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	// TestEarly and TestTwoMinuteAgo are ready for deletion, so are quarantined first.
+	testReaper := createTestReaper("testProject", "* * * * *", copyWatchlist(reaperRunTestCases[0].Watchlist)...)
+	for _, watchedResource := range testReaper.Watchlist {
+		watchedResource.QuarantinePeriod = time.Hour
+	}
+	testReaper.FreezeClock(currentTime)
+	testReaper.FreezeTime(currentTime)
+
+	result := testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if result.Quarantined != 2 || result.Deleted != 0 || len(testReaper.Watchlist) != 3 {
+		t.Errorf("First sweep quarantined %d and deleted %d resources; want 2 and 0", result.Quarantined, result.Deleted)
+	}
+
+	// TestEarly's quarantine is over, and TestTwoMinuteAgo's quarantine label was removed.
+	for _, watchedResource := range testReaper.Watchlist {
+		switch watchedResource.Name {
+		case "TestEarly":
+			watchedResource.Labels = resources.QuarantineLabels(testReaper.UUID, currentTime.Add(-2*time.Hour))
+		case "TestTwoMinuteAgo":
+			watchedResource.Labels = map[string]string{resources.QuarantinedByLabel: resources.LabelValue(testReaper.UUID)}
+		}
+	}
+	result = testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if result.Quarantined != 0 || result.Deleted != 1 || len(testReaper.Watchlist) != 2 {
+		t.Errorf("Second sweep quarantined %d and deleted %d resources; want 0 and 1", result.Quarantined, result.Deleted)
+	}
+	for _, watchedResource := range testReaper.Watchlist {
+		if watchedResource.Name == "TestEarly" {
+			t.Errorf("Resource TestEarly not deleted after its quarantine")
+		}
+	}
+
+	result = testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if result.Quarantined != 0 || result.Deleted != 0 {
+		t.Errorf("Sweep quarantined %d and deleted %d resources after aborted quarantine; want 0 and 0", result.Quarantined, result.Deleted)
+	}
+
+	// The aborted quarantine is kept on the resource, so it survives a reaper restart.
+	restartedReaper := createTestReaper("testProject", "* * * * *", copyWatchlist(testReaper.Watchlist)...)
+	for _, watchedResource := range restartedReaper.Watchlist {
+		watchedResource.QuarantinePeriod = time.Hour
+	}
+	restartedReaper.FreezeClock(currentTime)
+	restartedReaper.FreezeTime(currentTime)
+	result = restartedReaper.SweepThroughResources(testContext, testClientOptions...)
+	if result.Quarantined != 0 || result.Deleted != 0 || len(restartedReaper.Watchlist) != 2 {
+		t.Errorf("Sweep quarantined %d and deleted %d resources after restart; want 0 and 0", result.Quarantined, result.Deleted)
+	}
+}
+
+func TestSweepWithBackup(t *testing.T) {
+	var snapshotLabels []map[string]string
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		// Endpoints of the form: /{ProjectID}/zones/{ZoneName}/{Collection}/{Name}[/{Action}]
+		splitEndpoint := strings.Split(req.URL.Path, "/")
+		switch {
+		case len(splitEndpoint) == 6 && req.Method == "GET":
+			disk := map[string]string{"source": "projects/testProject/zones/testZone/disks/" + splitEndpoint[5]}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": splitEndpoint[5], "disks": []interface{}{disk}})
+		case strings.HasSuffix(req.URL.Path, "/createSnapshot"):
+			var snapshot struct{ Labels map[string]string }
+			json.NewDecoder(req.Body).Decode(&snapshot)
+			snapshotLabels = append(snapshotLabels, snapshot.Labels)
+			json.NewEncoder(w).Encode(map[string]string{"name": splitEndpoint[5]})
+		case strings.HasSuffix(req.URL.Path, "/wait") && splitEndpoint[5] == "TestEarly":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "DONE", "error": map[string]interface{}{"errors": []map[string]string{{"message": "quota exceeded"}}},
+			})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"status": "DONE"})
+		}
+	})
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	// TestEarly and TestTwoMinuteAgo are ready for deletion, and snapshotting TestEarly fails.
+	testReaper := createTestReaper("testProject", "* * * * *", copyWatchlist(reaperRunTestCases[0].Watchlist)...)
+	for _, watchedResource := range testReaper.Watchlist {
+		watchedResource.Backup = &reaperconfig.BackupConfig{Ttl: "0 0 * * *"}
+	}
+	testReaper.FreezeClock(currentTime)
+	testReaper.FreezeTime(currentTime)
+
+	result := testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if result.BackedUp != 1 || result.Deleted != 1 || result.Failed != 1 {
+		t.Errorf("Sweep backed up %d, deleted %d and failed %d resources; want 1, 1 and 1", result.BackedUp, result.Deleted, result.Failed)
+	}
+	expected := createTestReaper("testProject", "* * * * *", reaperRunTestCases[0].Watchlist[:2]...)
+	if !areWatchlistsEqual(testReaper, expected) {
+		t.Errorf("Resource deleted after its backup failed")
+	}
+	for _, labels := range snapshotLabels {
+		if labels[resources.ReaperUUIDLabel] != "testuuid" || len(labels[resources.ExpiresLabel]) == 0 {
+			t.Errorf("Snapshot labels = %v; want reaper UUID and expiry labels", labels)
+		}
+	}
+}
+
+func TestSweepNotifications(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+	var notifications []notifier.Notification
+	receiver := createServer(func(w http.ResponseWriter, req *http.Request) {
+		var notification notifier.Notification
+		json.NewDecoder(req.Body).Decode(&notification)
+		notifications = append(notifications, notification)
+	})
+	defer receiver.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	// TestEarly and TestTwoMinuteAgo are already past their deletion time when they are first
+	// seen, and TestSoon is deleted within the lead time, so all three are warned about first.
+	watchlist := append(
+		copyWatchlist(reaperRunTestCases[0].Watchlist),
+		resources.NewWatchedResource(resources.NewResource("TestSoon", "testZone", twoMinutesAgo, reaperconfig.ResourceType_GCE_VM), "1 * * * *"),
+	)
+	testReaper := createTestReaper("testProject", "* * * * *", watchlist...)
+	config := createReaperConfig("testProject", "* * * * *")
+	config.Notifications = &reaperconfig.NotificationConfig{
+		Webhooks:        []*reaperconfig.Webhook{&reaperconfig.Webhook{Url: receiver.URL}},
+		WarningLeadTime: "1h",
+	}
+	testReaper.UpdateReaperConfig(config)
+	testReaper.FreezeClock(currentTime)
+	testReaper.FreezeTime(currentTime)
+
+	result := testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if len(notifications) != 1 {
+		t.Fatalf("Sweep sent %d notifications; want a warning", len(notifications))
+	}
+	warning := notifications[0]
+	if warning.Event != notifier.DeletionWarning || len(warning.Resources) != 3 {
+		t.Errorf("Deletion warning = %v; want a warning for TestEarly, TestTwoMinuteAgo and TestSoon", warning)
+	}
+	endOfLeadTime := currentTime.Add(time.Hour).Format(time.RFC3339)
+	for _, warningResource := range warning.Resources {
+		if warningResource.DeletionTime != endOfLeadTime {
+			t.Errorf("Warning for %s gives deletion time %s; want the end of the lead time %s", warningResource.Name, warningResource.DeletionTime, endOfLeadTime)
+		}
+	}
+	if result.Deleted != 0 || len(testReaper.Watchlist) != 4 {
+		t.Errorf("Sweep deleted %d resources and kept %d; want nothing deleted before the lead time has passed", result.Deleted, len(testReaper.Watchlist))
+	}
+
+	// Nothing is deleted or warned about again until the lead time has passed.
+	testReaper.FreezeClock(currentTime.Add(30 * time.Minute))
+	testReaper.FreezeTime(currentTime.Add(30 * time.Minute))
+	result = testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if len(notifications) != 1 || result.Deleted != 0 {
+		t.Errorf("Sweep within the lead time sent %d more notifications and deleted %d resources; want none", len(notifications)-1, result.Deleted)
+	}
+
+	testReaper.FreezeClock(currentTime.Add(time.Hour + time.Minute))
+	testReaper.FreezeTime(currentTime.Add(time.Hour + time.Minute))
+	testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if len(notifications) != 2 {
+		t.Fatalf("Sweep after the lead time sent %d more notifications; want a summary", len(notifications)-1)
+	}
+	if summary := notifications[1]; summary.Event != notifier.SweepSummary || len(summary.Deleted) != 3 || len(summary.Failed) != 0 {
+		t.Errorf("Sweep summary = %v; want 3 deleted resources", summary)
+	}
+
+	testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if len(notifications) != 2 {
+		t.Errorf("Last sweep sent %d more notifications; want none", len(notifications)-2)
 	}
 }
 
@@ -223,6 +528,400 @@ func TestGetResources(t *testing.T) {
 	}
 }
 
+func TestGetResourcesMultipleProjects(t *testing.T) {
+	server := createServer(getComputeEngineResourcesHandler)
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+	testReaper := &Reaper{}
+
+	setupTestData()
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "TestName", "", "* * * * *", "testZone1"),
+	)
+	testReaper.config.ProjectIds = []string{"anotherProject", "sampleProject"}
+	testReaper.ProjectID = testReaper.config.GetProjectId()
+
+	testReaper.GetResources(testContext, testClientOptions...)
+	watchedProjects := make(map[string]bool)
+	for _, resource := range testReaper.Watchlist {
+		watchedProjects[resource.ProjectID] = true
+	}
+	expectedProjects := map[string]bool{"sampleProject": true, "anotherProject": true}
+	if len(testReaper.Watchlist) != 2 || !reflect.DeepEqual(watchedProjects, expectedProjects) {
+		t.Errorf("Watched projects = %v with %d resources; want %v with 2 resources", watchedProjects, len(testReaper.Watchlist), expectedProjects)
+	}
+}
+
+func TestGetResourcesSameNameDifferentTypes(t *testing.T) {
+	// Every listing returns a resource named Shared, so the VM in the global zone and the
+	// global snapshot share a project, zone and name.
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GetResourcesResponse{[]TestData{TestData{"Shared", currentTime.Format(time.RFC3339)}}})
+	})
+	defer server.Close()
+
+	testReaper := &Reaper{}
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *",
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Shared", "", "* * * * *", "global"),
+		createResourceConfig(reaperconfig.ResourceType_GCE_SNAPSHOT, "Shared", "", "* * * * *"),
+	)
+	testReaper.ProjectID = testReaper.config.GetProjectId()
+
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+	watchedTypes := make(map[reaperconfig.ResourceType]bool)
+	for _, watchedResource := range testReaper.Watchlist {
+		watchedTypes[watchedResource.Type] = true
+	}
+	expectedTypes := map[reaperconfig.ResourceType]bool{reaperconfig.ResourceType_GCE_VM: true, reaperconfig.ResourceType_GCE_SNAPSHOT: true}
+	if len(testReaper.Watchlist) != 2 || !reflect.DeepEqual(watchedTypes, expectedTypes) {
+		t.Errorf("Watched types = %v with %d resources; want %v with 2 resources", watchedTypes, len(testReaper.Watchlist), expectedTypes)
+	}
+}
+
+// TestGetResourcesPrunesFirstSeen tests that the first seen time of a resource without a
+// creation time is forgotten once the resource is no longer listed.
+func TestGetResourcesPrunesFirstSeen(t *testing.T) {
+	listed := []TestData{TestData{"Untimed", "not a timestamp"}}
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GetResourcesResponse{listed})
+	})
+	defer server.Close()
+
+	tracker, _ := resources.NewFirstSeenTracker("")
+	testReaper := createTestReaper("sampleProject", "* * * * *")
+	testReaper.SetFirstSeenTracker(tracker)
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Untimed", "", "* * * * *", "testZone1"),
+	)
+	resource := resources.NewResource("Untimed", "testZone1", time.Time{}, reaperconfig.ResourceType_GCE_VM)
+
+	testReaper.FreezeClock(currentTime)
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+	if firstSeen := tracker.FirstSeen(testReaper.UUID, "sampleProject", resource, currentTime.Add(time.Hour)); !firstSeen.Equal(currentTime) {
+		t.Errorf("First seen of listed resource = %v; want %v", firstSeen, currentTime)
+	}
+
+	listed = nil
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+	if firstSeen := tracker.FirstSeen(testReaper.UUID, "sampleProject", resource, currentTime.Add(time.Hour)); !firstSeen.Equal(currentTime.Add(time.Hour)) {
+		t.Errorf("First seen of resource that is no longer listed = %v; want it forgotten", firstSeen)
+	}
+}
+
+func TestEventSink(t *testing.T) {
+	server := createServer(getComputeEngineResourcesHandler)
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+	sink := events.NewMemorySink()
+	testReaper := createTestReaper("sampleProject", "* * * * *")
+	testReaper.SetEventSink(sink)
+	testReaper.FreezeClock(currentTime)
+
+	setupTestData()
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "TestName", "", "0 12 * * *", "testZone1"),
+	)
+	testReaper.GetResources(testContext, testClientOptions...)
+	if eventTypes := eventTypesOf(sink.Events()); !reflect.DeepEqual(eventTypes, []reaperconfig.EventType{
+		reaperconfig.EventType_RESOURCE_DISCOVERED, reaperconfig.EventType_SCHEDULED_FOR_DELETION,
+	}) {
+		t.Errorf("Getting resources published %v; want a discovered and a scheduled event", eventTypes)
+	}
+
+	// Watching the same resource again publishes nothing, until its deletion time changes.
+	testReaper.GetResources(testContext, testClientOptions...)
+	if numEvents := len(sink.Events()); numEvents != 2 {
+		t.Errorf("Getting the same resources again published %d events; want none", numEvents-2)
+	}
+	testReaper.config.Resources[0].Ttl = "0 13 * * *"
+	testReaper.GetResources(testContext, testClientOptions...)
+	if eventTypes := eventTypesOf(sink.Events()[2:]); !reflect.DeepEqual(eventTypes, []reaperconfig.EventType{
+		reaperconfig.EventType_SCHEDULED_FOR_DELETION,
+	}) {
+		t.Errorf("Changing the TTL published %v; want a scheduled event", eventTypes)
+	}
+
+	deleteServer := createServer(deleteComputeEngineResourceHandler)
+	defer deleteServer.Close()
+	testReaper.FreezeTime(currentTime.AddDate(0, 0, 1))
+	testReaper.SweepThroughResources(testContext, getTestClientOptions(deleteServer)...)
+	deletedEvent := sink.Events()[len(sink.Events())-1]
+	if deletedEvent.GetType() != reaperconfig.EventType_RESOURCE_DELETED || deletedEvent.GetResource().GetName() != "TestName" {
+		t.Errorf("Sweep published %v; want a deleted event for TestName", deletedEvent)
+	}
+}
+
+func TestEventSinkFailedDeletion(t *testing.T) {
+	// The server lists the resources, but refuses to delete them.
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		getComputeEngineResourcesHandler(w, req)
+	})
+	defer server.Close()
+
+	sink := events.NewMemorySink()
+	testReaper := createTestReaper("sampleProject", "* * * * *")
+	testReaper.SetEventSink(sink)
+	testReaper.FreezeTime(currentTime.AddDate(0, 0, 1))
+
+	setupTestData()
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "TestName", "", "0 12 * * *", "testZone1"),
+	)
+	for run := 0; run < 2; run++ {
+		testReaper.GetResources(testContext, getTestClientOptions(server)...)
+		testReaper.SweepThroughResources(testContext, getTestClientOptions(server)...)
+	}
+	// The resource is only discovered and scheduled once, even though it is still watched
+	// because its deletion keeps failing.
+	if eventTypes := eventTypesOf(sink.Events()); !reflect.DeepEqual(eventTypes, []reaperconfig.EventType{
+		reaperconfig.EventType_RESOURCE_DISCOVERED, reaperconfig.EventType_SCHEDULED_FOR_DELETION,
+		reaperconfig.EventType_DELETION_FAILED, reaperconfig.EventType_DELETION_FAILED,
+	}) {
+		t.Errorf("Two runs failing to delete a resource published %v; want it discovered and scheduled once, and two failures", eventTypes)
+	}
+}
+
+func TestSweepAuditLog(t *testing.T) {
+	server := createServer(getComputeEngineResourcesHandler)
+	defer server.Close()
+
+	auditLog, _ := audit.NewLog("")
+	testReaper := createTestReaper("sampleProject", "* * * * *")
+	testReaper.SetAuditLog(auditLog)
+	testReaper.FreezeClock(currentTime)
+
+	setupTestData()
+	resourceConfig := createResourceConfig(reaperconfig.ResourceType_GCE_VM, "TestName", "", "0 12 * * *", "testZone1")
+	testReaper.config = createReaperConfig("sampleProject", "* * * * *", resourceConfig)
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+
+	deleteServer := createServer(deleteComputeEngineResourceHandler)
+	defer deleteServer.Close()
+	testReaper.FreezeTime(currentTime.AddDate(0, 0, 1))
+	testReaper.SweepThroughResources(testContext, getTestClientOptions(deleteServer)...)
+
+	records, _ := auditLog.Query(&reaperconfig.AuditLogQuery{})
+	if len(records) != 1 {
+		t.Fatalf("Sweep recorded %d audit records; want 1", len(records))
+	}
+	record := records[0]
+	if record.GetOutcome() != reaperconfig.AuditOutcome_DELETED || record.GetResource().GetName() != "TestName" ||
+		record.GetResource().GetProjectId() != "sampleProject" || record.GetReaperUuid() != testReaper.UUID {
+		t.Errorf("Sweep recorded %v; want the deletion of TestName in sampleProject", record)
+	}
+	if record.GetTtl() != "0 12 * * *" || !proto.Equal(record.GetResourceConfig(), resourceConfig) || record.GetDeletionTime() == nil {
+		t.Errorf("Audit record has TTL %q, resource config %v and deletion time %v", record.GetTtl(), record.GetResourceConfig(), record.GetDeletionTime())
+	}
+
+	// TestEarly is blocked by the protection policy, and TestTwoMinuteAgo is deleted.
+	testReaper = createTestReaper("testProject", "* * * * *", reaperRunTestCases[0].Watchlist...)
+	testReaper.SetAuditLog(auditLog)
+	testReaper.FreezeTime(currentTime)
+	policy, _ := resources.NewProtectionPolicy(nil, nil, []string{"Early"})
+	testReaper.SetProtectionPolicy(policy)
+	testReaper.SweepThroughResources(testContext, getTestClientOptions(deleteServer)...)
+
+	records, _ = auditLog.Query(&reaperconfig.AuditLogQuery{ProjectId: "testProject"})
+	outcomes := make(map[string]reaperconfig.AuditOutcome)
+	for _, record := range records {
+		outcomes[record.GetResource().GetName()] = record.GetOutcome()
+	}
+	expectedOutcomes := map[string]reaperconfig.AuditOutcome{
+		"TestEarly":        reaperconfig.AuditOutcome_BLOCKED,
+		"TestTwoMinuteAgo": reaperconfig.AuditOutcome_DELETED,
+	}
+	if !reflect.DeepEqual(outcomes, expectedOutcomes) {
+		t.Errorf("Sweep recorded outcomes %v; want %v", outcomes, expectedOutcomes)
+	}
+}
+
+func TestSweepCancelled(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+
+	// TestEarly and TestTwoMinuteAgo are ready for deletion, but the sweep is already stopping.
+	testReaper := createTestReaper("testProject", "* * * * *", reaperRunTestCases[0].Watchlist...)
+	testReaper.FreezeTime(currentTime)
+	ctx, cancel := context.WithCancel(testContext)
+	cancel()
+
+	result := testReaper.SweepThroughResources(ctx, getTestClientOptions(server)...)
+	if !result.Cancelled || result.Deleted != 0 || result.Failed != 0 {
+		t.Errorf("Cancelled sweep = %+v; want it cancelled without deleting or failing", result)
+	}
+	if len(testReaper.Watchlist) != len(reaperRunTestCases[0].Watchlist) {
+		t.Errorf("Cancelled sweep left %d resources in the watchlist; want %d", len(testReaper.Watchlist), len(reaperRunTestCases[0].Watchlist))
+	}
+	if testReaper.RunOnSchedule(ctx, getTestClientOptions(server)...) {
+		t.Errorf("Reaper swept after its context was cancelled")
+	}
+}
+
+func TestDeleteResourcesStopped(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+
+	testReaper := createTestReaper("testProject", "* * * * *")
+	resourceClient, err := getAuthedClient(testContext, testReaper, reaperconfig.ResourceType_GCE_VM, getTestClientOptions(server)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCtx, stop := context.WithCancel(testContext)
+	stop()
+	deleteErrors := deleteResources(testContext, stopCtx, resourceClient, reaperconfig.ResourceType_GCE_VM, "testProject", reaperRunTestCases[0].Watchlist)
+	for idx, err := range deleteErrors {
+		if err != errSweepStopped {
+			t.Errorf("Deleting resource %d after the sweep stopped returned %v; want errSweepStopped", idx, err)
+		}
+	}
+}
+
+func TestSweepMetrics(t *testing.T) {
+	server := createServer(getComputeEngineResourcesHandler)
+	defer server.Close()
+
+	testReaper := createTestReaper("sampleProject", "* * * * *")
+	testReaper.UUID = "metrics-reaper"
+	testReaper.FreezeClock(currentTime)
+	defer metrics.ForgetReaper(testReaper.UUID)
+
+	setupTestData()
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "TestName", "", "0 12 * * *", "testZone1"),
+	)
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+	if scraped := scrapeMetrics(t); !strings.Contains(scraped, `reaper_resources_watched{reaper="metrics-reaper",resource_type="GCE_VM"} 1`) {
+		t.Errorf("Getting resources did not record the watched resource")
+	}
+
+	deleteServer := createServer(deleteComputeEngineResourceHandler)
+	defer deleteServer.Close()
+	testReaper.FreezeTime(currentTime.AddDate(0, 0, 1))
+	testReaper.SweepThroughResources(testContext, getTestClientOptions(deleteServer)...)
+
+	scraped := scrapeMetrics(t)
+	expectedLines := []string{
+		`reaper_resources_deleted_total{reaper="metrics-reaper",resource_type="GCE_VM"} 1`,
+		`reaper_sweep_duration_seconds_count{reaper="metrics-reaper"} 1`,
+		`reaper_seconds_since_last_successful_sweep{reaper="metrics-reaper"}`,
+		`reaper_api_call_duration_seconds_count{call="get_resources",resource_type="GCE_VM"}`,
+	}
+	for _, expectedLine := range expectedLines {
+		if !strings.Contains(scraped, expectedLine) {
+			t.Errorf("Metrics missing %q after sweep", expectedLine)
+		}
+	}
+	if strings.Contains(scraped, `reaper_resources_watched{reaper="metrics-reaper"`) {
+		t.Errorf("Deleted resource still recorded as watched")
+	}
+}
+
+func TestSweepTracing(t *testing.T) {
+	exporter := tracing.NewMemoryExporter()
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	server := createServer(getComputeEngineResourcesHandler)
+	defer server.Close()
+	testReaper := createTestReaper("sampleProject", "* * * * *")
+	testReaper.FreezeClock(currentTime)
+
+	setupTestData()
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "TestName", "", "0 12 * * *", "testZone1", "testZone2"),
+	)
+	ctx, request := trace.StartSpan(testContext, "Request")
+	testReaper.GetResources(ctx, getTestClientOptions(server)...)
+
+	deleteServer := createServer(deleteComputeEngineResourceHandler)
+	defer deleteServer.Close()
+	testReaper.FreezeTime(currentTime.AddDate(0, 0, 1))
+	testReaper.SweepThroughResources(ctx, getTestClientOptions(deleteServer)...)
+	request.End()
+
+	spansByName := make(map[string][]*trace.SpanData)
+	spansByID := make(map[trace.SpanID]*trace.SpanData)
+	for _, span := range exporter.Spans() {
+		if span.TraceID != request.SpanContext().TraceID {
+			t.Errorf("Span %s is not in the request's trace", span.Name)
+		}
+		spansByName[span.Name] = append(spansByName[span.Name], span)
+		spansByID[span.SpanID] = span
+	}
+	expectedParents := map[string]string{
+		"Reaper.GetResources":          "Request",
+		"Client.GetResources":          "Reaper.GetResources",
+		"Reaper.SweepThroughResources": "Request",
+		"Client.DeleteResource":        "Reaper.SweepThroughResources",
+	}
+	for name, parentName := range expectedParents {
+		if len(spansByName[name]) == 0 {
+			t.Errorf("No %s span exported", name)
+			continue
+		}
+		for _, span := range spansByName[name] {
+			if parent := spansByID[span.ParentSpanID]; parent == nil || parent.Name != parentName {
+				t.Errorf("%s span is not a child of a %s span", name, parentName)
+			}
+		}
+	}
+	if numZoneSpans := len(spansByName["Client.GetResources"]); numZoneSpans != 2 {
+		t.Errorf("Exported %d zone spans; want one for each of the 2 zones", numZoneSpans)
+	}
+	if deleteSpans := spansByName["Client.DeleteResource"]; len(deleteSpans) > 0 && deleteSpans[0].Attributes[tracing.ResourceAttribute] != "TestName" {
+		t.Errorf("Delete span has attributes %v; want resource TestName", deleteSpans[0].Attributes)
+	}
+}
+
+func scrapeMetrics(t *testing.T) string {
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	return recorder.Body.String()
+}
+
+func eventTypesOf(reaperEvents []*reaperconfig.ReaperEvent) []reaperconfig.EventType {
+	var eventTypes []reaperconfig.EventType
+	for _, event := range reaperEvents {
+		eventTypes = append(eventTypes, event.GetType())
+	}
+	return eventTypes
+}
+
+func TestSetMissingCreationTimes(t *testing.T) {
+	testReaper := createTestReaper("sampleProject", "* * * * *")
+	testReaper.FreezeClock(twoMinutesAgo)
+	firstSweep := []*resources.Resource{
+		resources.NewResource("Unlabeled", "global", time.Time{}, reaperconfig.ResourceType_PUBSUB_TOPIC),
+		resources.NewResource("Labeled", "global", earlyTime, reaperconfig.ResourceType_PUBSUB_TOPIC),
+	}
+	testReaper.setMissingCreationTimes(firstSweep)
+	if !firstSweep[0].TimeCreated.Equal(twoMinutesAgo) {
+		t.Errorf("Missing creation time = %v; want first seen time %v", firstSweep[0].TimeCreated, twoMinutesAgo)
+	}
+	if !firstSweep[1].TimeCreated.Equal(earlyTime) {
+		t.Errorf("Existing creation time overwritten with %v", firstSweep[1].TimeCreated)
+	}
+
+	testReaper.FreezeClock(currentTime)
+	secondSweep := []*resources.Resource{
+		resources.NewResource("Unlabeled", "global", time.Time{}, reaperconfig.ResourceType_PUBSUB_TOPIC),
+	}
+	testReaper.setMissingCreationTimes(secondSweep)
+	if !secondSweep[0].TimeCreated.Equal(twoMinutesAgo) {
+		t.Errorf("Creation time on later sweep = %v; want first seen time %v", secondSweep[0].TimeCreated, twoMinutesAgo)
+	}
+}
+
 type RunScheduleTestCase struct {
 	Schedule string
 	LastRun  time.Time
@@ -319,6 +1018,13 @@ func setupTestData() {
 				},
 			},
 		},
+		"anotherProject": {
+			reaperconfig.ResourceType_GCE_VM: {
+				"testZone1": []TestData{
+					TestData{"TestName", currentTime.Format(time.RFC3339)},
+				},
+			},
+		},
 	}
 }
 
@@ -341,6 +1047,17 @@ func createResourceConfig(resourceType reaperconfig.ResourceType, nameFilter, sk
 	}
 }
 
+// copyWatchlist copies the watched resources, so that tests can change them without
+// affecting other tests.
+func copyWatchlist(watchlist []*resources.WatchedResource) []*resources.WatchedResource {
+	var copied []*resources.WatchedResource
+	for _, watchedResource := range watchlist {
+		resource := *watchedResource.Resource
+		copied = append(copied, resources.NewWatchedResource(&resource, watchedResource.TTL))
+	}
+	return copied
+}
+
 func createTestReaper(projectID, schedule string, watchlist ...*resources.WatchedResource) *Reaper {
 	parsedSchedule, _ := parseSchedule(schedule)
 	return &Reaper{
@@ -0,0 +1,60 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"context"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/tracing"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"go.opencensus.io/trace"
+)
+
+// SetConfigSpan records the span of the request that last configured the reaper, so that
+// the spans of the reaper's later runs link back to it.
+func (reaper *Reaper) SetConfigSpan(span trace.SpanContext) {
+	reaper.configSpan = span
+}
+
+// startRunSpan starts the span for a scheduled run of the reaper, linked to the span of the
+// request that last configured it.
+func (reaper *Reaper) startRunSpan(ctx context.Context) (context.Context, *trace.Span) {
+	ctx, span := tracing.StartSpan(ctx, "Reaper.RunOnSchedule", trace.StringAttribute(tracing.ReaperAttribute, reaper.UUID))
+	if reaper.configSpan != (trace.SpanContext{}) {
+		span.AddLink(trace.Link{
+			TraceID: reaper.configSpan.TraceID,
+			SpanID:  reaper.configSpan.SpanID,
+			Type:    trace.LinkTypeParent,
+		})
+	}
+	return ctx, span
+}
+
+// startResourceSpan starts a span for a client call on a single resource.
+func startResourceSpan(ctx context.Context, name, projectID string, resource *resources.Resource) (context.Context, *trace.Span) {
+	return tracing.StartSpan(
+		ctx, name,
+		trace.StringAttribute(tracing.ResourceTypeAttribute, resource.Type.String()),
+		trace.StringAttribute(tracing.ProjectAttribute, projectID),
+		trace.StringAttribute(tracing.ZoneAttribute, resource.Zone),
+		trace.StringAttribute(tracing.ResourceAttribute, resource.Name),
+	)
+}
+
+// resourceTypeAttribute returns the span attribute for a resource type.
+func resourceTypeAttribute(resourceType reaperconfig.ResourceType) trace.Attribute {
+	return trace.StringAttribute(tracing.ResourceTypeAttribute, resourceType.String())
+}
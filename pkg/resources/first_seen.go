@@ -0,0 +1,157 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// FirstSeenTracker records when each reaper first observed each resource. This is
+// used in place of the creation time for resources whose creation time is missing
+// or could not be parsed. The times are kept separately for each reaper, so that a
+// reaper pruning the resources it no longer lists never resets another reaper's
+// times. If the tracker has a file path, the times are persisted to that file so
+// that they survive restarts.
+type FirstSeenTracker struct {
+	path    string
+	seen    map[string]time.Time
+	changed bool
+	mux     *sync.Mutex
+}
+
+// NewFirstSeenTracker creates a FirstSeenTracker that persists to the file at path,
+// loading any times already stored there. An empty path creates a tracker that is
+// only kept in memory.
+func NewFirstSeenTracker(path string) (*FirstSeenTracker, error) {
+	tracker := &FirstSeenTracker{
+		path: path,
+		seen: make(map[string]time.Time),
+		mux:  &sync.Mutex{},
+	}
+	if len(path) == 0 {
+		return tracker, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tracker, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &tracker.seen); err != nil {
+		return nil, fmt.Errorf("parsing first seen file %s failed: %v", path, err)
+	}
+	return tracker, nil
+}
+
+// FirstSeen returns when the reaper with the given UUID first saw the given resource in
+// the project. If the resource has not been seen before, now is recorded as its first
+// seen time.
+func (tracker *FirstSeenTracker) FirstSeen(reaperUUID, projectID string, resource *Resource, now time.Time) time.Time {
+	tracker.mux.Lock()
+	defer tracker.mux.Unlock()
+
+	key := firstSeenKey(reaperUUID, projectID, resource.Type, resource.Zone, resource.VersionedName())
+	firstSeen, seen := tracker.seen[key]
+	if !seen {
+		firstSeen = now
+		tracker.seen[key] = firstSeen
+		tracker.changed = true
+	}
+	return firstSeen
+}
+
+// Forget removes the first seen time of the given resource in the project recorded for
+// the reaper with the given UUID. This should be called once the resource has been deleted.
+func (tracker *FirstSeenTracker) Forget(reaperUUID, projectID string, resource *Resource) {
+	tracker.mux.Lock()
+	defer tracker.mux.Unlock()
+
+	key := firstSeenKey(reaperUUID, projectID, resource.Type, resource.Zone, resource.VersionedName())
+	if _, seen := tracker.seen[key]; seen {
+		delete(tracker.seen, key)
+		tracker.changed = true
+	}
+}
+
+// Prune removes the first seen times recorded for the reaper with the given UUID of the
+// resources of the type in the project that are not in listed, which should be every
+// resource of the type that the reaper listed in the project. This forgets resources
+// that were deleted outside the reaper or that no longer match the reaper's config.
+func (tracker *FirstSeenTracker) Prune(reaperUUID, projectID string, resourceType reaperconfig.ResourceType, listed []*Resource) {
+	tracker.mux.Lock()
+	defer tracker.mux.Unlock()
+
+	listedKeys := make(map[string]bool)
+	for _, resource := range listed {
+		listedKeys[firstSeenKey(reaperUUID, projectID, resourceType, resource.Zone, resource.VersionedName())] = true
+	}
+	prefix := fmt.Sprintf("%s/%s/%s/", reaperUUID, projectID, resourceType.String())
+	for key := range tracker.seen {
+		if strings.HasPrefix(key, prefix) && !listedKeys[key] {
+			delete(tracker.seen, key)
+			tracker.changed = true
+		}
+	}
+}
+
+// Save writes the first seen times to the tracker's file if they have changed since
+// they were last saved. The file is replaced atomically, so a crash while saving
+// never leaves a partially written file behind.
+func (tracker *FirstSeenTracker) Save() error {
+	tracker.mux.Lock()
+	defer tracker.mux.Unlock()
+
+	if len(tracker.path) == 0 || !tracker.changed {
+		return nil
+	}
+	data, err := json.Marshal(tracker.seen)
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(tracker.path), filepath.Base(tracker.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile.Name(), tracker.path); err != nil {
+		return err
+	}
+	tracker.changed = false
+	return nil
+}
+
+// firstSeenKey returns the key identifying a resource in a project, as seen by the reaper
+// with the given UUID.
+func firstSeenKey(reaperUUID, projectID string, resourceType reaperconfig.ResourceType, zone, name string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", reaperUUID, projectID, resourceType.String(), zone, name)
+}
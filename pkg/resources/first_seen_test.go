@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestFirstSeenTracker tests that first seen times are kept between sweeps, and are
+// persisted across restarts of the tracker.
+func TestFirstSeenTracker(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "first_seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "first_seen.json")
+
+	tracker, err := NewFirstSeenTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := NewResource("testName", zone, time.Time{}, resourceType)
+	otherResource := NewResource("otherName", zone, time.Time{}, resourceType)
+
+	if firstSeen := tracker.FirstSeen("TestUUID", "project", resource, twoMinutesAgo); !firstSeen.Equal(twoMinutesAgo) {
+		t.Errorf("First seen = %v; want %v", firstSeen, twoMinutesAgo)
+	}
+	if firstSeen := tracker.FirstSeen("TestUUID", "project", resource, currentTime); !firstSeen.Equal(twoMinutesAgo) {
+		t.Errorf("First seen on later sweep = %v; want %v", firstSeen, twoMinutesAgo)
+	}
+	if firstSeen := tracker.FirstSeen("TestUUID", "otherProject", resource, currentTime); !firstSeen.Equal(currentTime) {
+		t.Errorf("First seen in another project = %v; want %v", firstSeen, currentTime)
+	}
+	tracker.FirstSeen("TestUUID", "project", otherResource, currentTime)
+	tracker.Forget("TestUUID", "project", otherResource)
+	if err := tracker.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	restartedTracker, err := NewFirstSeenTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstSeen := restartedTracker.FirstSeen("TestUUID", "project", resource, lateTime); !firstSeen.Equal(twoMinutesAgo) {
+		t.Errorf("First seen after restart = %v; want %v", firstSeen, twoMinutesAgo)
+	}
+	if firstSeen := restartedTracker.FirstSeen("TestUUID", "project", otherResource, lateTime); !firstSeen.Equal(lateTime) {
+		t.Errorf("First seen of forgotten resource after restart = %v; want %v", firstSeen, lateTime)
+	}
+	if firstSeen := restartedTracker.FirstSeen("OtherUUID", "project", resource, lateTime); !firstSeen.Equal(lateTime) {
+		t.Errorf("First seen by another reaper = %v; want %v", firstSeen, lateTime)
+	}
+}
+
+// TestPruneFirstSeen tests that pruning forgets the resources of the reaper, project and
+// type that were not listed, and keeps every other resource.
+func TestPruneFirstSeen(t *testing.T) {
+	tracker, err := NewFirstSeenTracker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := NewResource("listed", zone, time.Time{}, resourceType)
+	unlisted := NewResource("unlisted", zone, time.Time{}, resourceType)
+	for _, resource := range []*Resource{listed, unlisted} {
+		tracker.FirstSeen("TestUUID", "project", resource, twoMinutesAgo)
+		tracker.FirstSeen("TestUUID", "otherProject", resource, twoMinutesAgo)
+		tracker.FirstSeen("OtherUUID", "project", resource, twoMinutesAgo)
+	}
+
+	tracker.Prune("TestUUID", "project", resourceType, []*Resource{listed})
+	if firstSeen := tracker.FirstSeen("TestUUID", "project", listed, currentTime); !firstSeen.Equal(twoMinutesAgo) {
+		t.Errorf("First seen of listed resource after pruning = %v; want %v", firstSeen, twoMinutesAgo)
+	}
+	if firstSeen := tracker.FirstSeen("TestUUID", "project", unlisted, currentTime); !firstSeen.Equal(currentTime) {
+		t.Errorf("First seen of unlisted resource after pruning = %v; want %v", firstSeen, currentTime)
+	}
+	if firstSeen := tracker.FirstSeen("TestUUID", "otherProject", unlisted, currentTime); !firstSeen.Equal(twoMinutesAgo) {
+		t.Errorf("First seen in another project after pruning = %v; want %v", firstSeen, twoMinutesAgo)
+	}
+	if firstSeen := tracker.FirstSeen("OtherUUID", "project", unlisted, currentTime); !firstSeen.Equal(twoMinutesAgo) {
+		t.Errorf("First seen by another reaper after pruning = %v; want %v", firstSeen, twoMinutesAgo)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+)
+
+// ProtectionPolicy describes resources that must never be deleted, whatever the
+// configs of the reapers. A resource is protected if it is in one of the protected
+// projects, has one of the protected labels, or has a name matching one of the
+// protected name patterns. An empty label value protects any value of that label.
+// Policies should be created with NewProtectionPolicy or LoadProtectionPolicy.
+type ProtectionPolicy struct {
+	ProjectIDs   []string          `json:"project_ids"`
+	Labels       map[string]string `json:"labels"`
+	NamePatterns []string          `json:"name_patterns"`
+
+	nameRegexes []*regexp.Regexp
+}
+
+// NewProtectionPolicy creates a ProtectionPolicy, returning an error if any of the name
+// patterns is not a valid regex.
+func NewProtectionPolicy(projectIDs []string, labels map[string]string, namePatterns []string) (*ProtectionPolicy, error) {
+	policy := &ProtectionPolicy{ProjectIDs: projectIDs, Labels: labels, NamePatterns: namePatterns}
+	for _, pattern := range namePatterns {
+		nameRegex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("parsing protected name pattern %s failed: %v", pattern, err)
+		}
+		policy.nameRegexes = append(policy.nameRegexes, nameRegex)
+	}
+	return policy, nil
+}
+
+// LoadProtectionPolicy reads a ProtectionPolicy from the JSON file at path. For
+// example:
+//
+//	{
+//	  "project_ids": ["production-project"],
+//	  "labels": {"reaper-protect": "true"},
+//	  "name_patterns": ["^prod-"]
+//	}
+func LoadProtectionPolicy(path string) (*ProtectionPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy ProtectionPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parsing protection policy file %s failed: %v", path, err)
+	}
+	return NewProtectionPolicy(policy.ProjectIDs, policy.Labels, policy.NamePatterns)
+}
+
+// Violation returns why deleting the given resource in the project would violate the
+// policy, or an empty string if the resource is not protected. A nil policy protects
+// nothing.
+func (policy *ProtectionPolicy) Violation(projectID string, resource *Resource) string {
+	if policy == nil {
+		return ""
+	}
+	for _, protectedProjectID := range policy.ProjectIDs {
+		if projectID == protectedProjectID {
+			return fmt.Sprintf("project %s is protected", projectID)
+		}
+	}
+	for key, value := range policy.Labels {
+		resourceValue, hasLabel := resource.Labels[key]
+		if hasLabel && (len(value) == 0 || value == resourceValue) {
+			return fmt.Sprintf("label %s=%s is protected", key, resourceValue)
+		}
+	}
+	for _, nameRegex := range policy.nameRegexes {
+		if nameRegex.MatchString(resource.Name) {
+			return fmt.Sprintf("name matches protected pattern %s", nameRegex.String())
+		}
+	}
+	return ""
+}
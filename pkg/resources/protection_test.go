@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type ViolationTestCase struct {
+	ProjectID string
+	Name      string
+	Labels    map[string]string
+	Protected bool
+}
+
+var violationTestCases = []ViolationTestCase{
+	ViolationTestCase{"test-project", "test-instance", nil, false},
+	ViolationTestCase{"prod-project", "test-instance", nil, true},
+	ViolationTestCase{"test-project", "prod-instance", nil, true},
+	ViolationTestCase{"test-project", "test-instance", map[string]string{"reaper-protect": "true"}, true},
+	ViolationTestCase{"test-project", "test-instance", map[string]string{"reaper-protect": "false"}, false},
+	ViolationTestCase{"test-project", "test-instance", map[string]string{"owner": "anyone"}, true},
+}
+
+// TestProtectionPolicy tests that a policy loaded from a file protects resources by
+// project, label and name.
+func TestProtectionPolicy(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "protection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "protection.json")
+	policyJSON := `{"project_ids": ["prod-project"], "labels": {"reaper-protect": "true", "owner": ""}, "name_patterns": ["^prod-"]}`
+	if err := ioutil.WriteFile(path, []byte(policyJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadProtectionPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range violationTestCases {
+		resource := NewResource(testCase.Name, zone, time.Time{}, resourceType)
+		resource.Labels = testCase.Labels
+		violation := policy.Violation(testCase.ProjectID, resource)
+		if (len(violation) > 0) != testCase.Protected {
+			t.Errorf("Resource %s in %s with labels %v protected = %t; want %t", testCase.Name, testCase.ProjectID, testCase.Labels, len(violation) > 0, testCase.Protected)
+		}
+	}
+
+	var nilPolicy *ProtectionPolicy
+	if violation := nilPolicy.Violation("prod-project", NewResource("prod-instance", zone, time.Time{}, resourceType)); len(violation) > 0 {
+		t.Errorf("Nil policy protected a resource: %s", violation)
+	}
+	if _, err := NewProtectionPolicy(nil, nil, []string{"("}); err == nil {
+		t.Errorf("Expected invalid name pattern to fail")
+	}
+}
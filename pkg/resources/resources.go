@@ -15,7 +15,10 @@
 package resources
 
 import (
+	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
@@ -23,17 +26,93 @@ import (
 )
 
 // A Resource represents a single GCP resource instance of any
-// type supported by the Reaper.
+// type supported by the Reaper. A zero TimeCreated means that the
+// creation time of the resource is unknown. ForceDelete marks that
+// the resource should be deleted along with anything it contains,
+// such as the objects in a GCS bucket. Generation is only set for
+// noncurrent versions of GCS objects. ProjectID is the project the
+// resource was found in, and is set by the reaper. Labels holds the
+// resource's labels, or the custom metadata of a GCS object.
 type Resource struct {
 	Name        string
 	Zone        string
+	ProjectID   string
 	TimeCreated time.Time
 	Type        reaperconfig.ResourceType
+	ForceDelete bool
+	Generation  int64
+	Labels      map[string]string
 }
 
+const (
+	// QuarantineLabel is the label put on resources that have been quarantined before
+	// deletion. Its value is the Unix time in seconds when the resource was quarantined.
+	QuarantineLabel = "reaper-quarantined"
+
+	// QuarantinedByLabel is the label put on quarantined resources naming the reaper that
+	// quarantined them. It is left on a resource whose QuarantineLabel is removed, which
+	// records that its quarantine was aborted.
+	QuarantinedByLabel = "reaper-quarantined-by"
+
+	// BackupSourceLabel is the label put on backups naming the resource they were taken of.
+	BackupSourceLabel = "reaper-backup-source"
+
+	// ReaperUUIDLabel is the label put on backups naming the reaper that took them.
+	ReaperUUIDLabel = "reaper-uuid"
+
+	// ExpiresLabel is the label put on backups with the Unix time in seconds after which
+	// they may be deleted. A backup with this label is deleted once it expires, instead
+	// of by its TTL. The label is ignored on resources that are not backups.
+	ExpiresLabel = "reaper-expires"
+
+	// maxLabelLength is the maximum length of a GCP label value.
+	maxLabelLength = 63
+)
+
+// invalidLabelCharacters matches the characters that are not allowed in GCP label values.
+var invalidLabelCharacters = regexp.MustCompile(`[^a-z0-9_-]`)
+
 // NewResource constructs a Resource struct.
 func NewResource(name, zone string, timeCreated time.Time, resourceType reaperconfig.ResourceType) *Resource {
-	return &Resource{name, zone, timeCreated, resourceType}
+	return &Resource{Name: name, Zone: zone, TimeCreated: timeCreated, Type: resourceType}
+}
+
+// QuarantineTime returns when the resource was quarantined, and false if the resource
+// does not have a valid QuarantineLabel.
+func (resource *Resource) QuarantineTime() (time.Time, bool) {
+	quarantinedAt, err := strconv.ParseInt(resource.Labels[QuarantineLabel], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(quarantinedAt, 0), true
+}
+
+// QuarantineLabels returns the labels to put on a resource quarantined by the reaper with
+// the given UUID at the given time.
+func QuarantineLabels(reaperUUID string, quarantinedAt time.Time) map[string]string {
+	return map[string]string{
+		QuarantineLabel:    strconv.FormatInt(quarantinedAt.Unix(), 10),
+		QuarantinedByLabel: LabelValue(reaperUUID),
+	}
+}
+
+// QuarantineAborted returns whether the reaper with the given UUID quarantined the resource
+// and its QuarantineLabel has since been removed.
+func (resource *Resource) QuarantineAborted(reaperUUID string) bool {
+	if _, isQuarantined := resource.QuarantineTime(); isQuarantined {
+		return false
+	}
+	quarantinedBy, hasQuarantinedBy := resource.Labels[QuarantinedByLabel]
+	return hasQuarantinedBy && quarantinedBy == LabelValue(reaperUUID)
+}
+
+// VersionedName returns the resource's name, followed by its generation if it is a
+// noncurrent version of a GCS object, such as "object#1592402400000000".
+func (resource *Resource) VersionedName() string {
+	if resource.Generation != 0 {
+		return fmt.Sprintf("%s#%d", resource.Name, resource.Generation)
+	}
+	return resource.Name
 }
 
 // TimeAlive returns how long a resource has been running.
@@ -43,6 +122,51 @@ func (resource *Resource) TimeAlive() float64 {
 	return numSeconds
 }
 
+// IsBackup returns whether the resource is a backup taken by a reaper, that is whether it
+// has both a BackupSourceLabel and a ReaperUUIDLabel.
+func (resource *Resource) IsBackup() bool {
+	return len(resource.Labels[BackupSourceLabel]) > 0 && len(resource.Labels[ReaperUUIDLabel]) > 0
+}
+
+// ExpiryTime returns when the resource expires, and false if the resource is not a backup
+// or does not have a valid ExpiresLabel. Only backups may expire, so that labeling any
+// other resource cannot override its TTL.
+func (resource *Resource) ExpiryTime() (time.Time, bool) {
+	if !resource.IsBackup() {
+		return time.Time{}, false
+	}
+	expiresAt, err := strconv.ParseInt(resource.Labels[ExpiresLabel], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(expiresAt, 0), true
+}
+
+// BackupLabels returns the labels to put on a backup of the resource taken by the reaper
+// with the given UUID, which expires at the first time after takenAt that matches the
+// backup's TTL in cron time string format.
+func BackupLabels(resource *Resource, reaperUUID, ttl string, takenAt time.Time) (map[string]string, error) {
+	schedule, err := cron.ParseStandard(ttl)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		BackupSourceLabel: LabelValue(resource.Name),
+		ReaperUUIDLabel:   LabelValue(reaperUUID),
+		ExpiresLabel:      strconv.FormatInt(schedule.Next(takenAt).Unix(), 10),
+	}, nil
+}
+
+// LabelValue converts a string into a valid GCP label value by lower casing it, replacing
+// disallowed characters with dashes and truncating it to the maximum label length.
+func LabelValue(value string) string {
+	labelValue := invalidLabelCharacters.ReplaceAllString(strings.ToLower(value), "-")
+	if len(labelValue) > maxLabelLength {
+		labelValue = labelValue[:maxLabelLength]
+	}
+	return labelValue
+}
+
 // Clock is a mock struct for handling time dependency for tests.
 type Clock struct {
 	instant time.Time
@@ -57,11 +181,18 @@ func (c *Clock) Now() time.Time {
 	return c.instant
 }
 
-// WatchedResource represents a resource that the Reaper is monitoring.
+// WatchedResource represents a resource that the Reaper is monitoring. A non-zero
+// QuarantinePeriod means the resource is quarantined for that long once it passes
+// its TTL, and only then deleted. A non-nil Backup means the resource is backed up
+// before it is deleted. Config is the ResourceConfig whose TTL the resource is
+// watched by.
 type WatchedResource struct {
 	*Resource
-	TTL   string
-	clock *Clock
+	TTL              string
+	QuarantinePeriod time.Duration
+	Backup           *reaperconfig.BackupConfig
+	Config           *reaperconfig.ResourceConfig
+	clock            *Clock
 }
 
 // NewWatchedResource constructs a WatchedResource.
@@ -88,7 +219,12 @@ func (resource *WatchedResource) IsReadyForDeletion() bool {
 	return resource.clock.Now().After(deletionTime)
 }
 
+// GetDeletionTime returns when the resource should be deleted, which is its expiry time if
+// it is a backup with an ExpiresLabel, and otherwise the first time after its creation matching its TTL.
 func (resource *WatchedResource) GetDeletionTime() (time.Time, error) {
+	if expiresAt, hasExpiry := resource.ExpiryTime(); hasExpiry {
+		return expiresAt, nil
+	}
 	// Using Cron time format doesn't give a duration, but instead a format of what the time should
 	// look like when deleting
 	schedule, err := cron.ParseStandard(resource.TTL)
@@ -15,6 +15,8 @@
 package resources
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -101,6 +103,10 @@ var readyForDeletionTestCases = []ReadyForDeletionTestCase{
 	ReadyForDeletionTestCase{createTestWatchedResource(twoMinutesLater, "10 * * * *"), false},
 	ReadyForDeletionTestCase{createTestWatchedResource(lateTime, "* * * * *"), false},
 	ReadyForDeletionTestCase{createTestWatchedResource(lateTime, "1 5 * * *"), false},
+	ReadyForDeletionTestCase{createExpiringWatchedResource(earlyTime, twoMinutesLater), false},
+	ReadyForDeletionTestCase{createExpiringWatchedResource(lateTime, twoMinutesAgo), true},
+	ReadyForDeletionTestCase{createLabeledWatchedResource(lateTime, twoMinutesAgo), false},
+	ReadyForDeletionTestCase{createLabeledWatchedResource(earlyTime, twoMinutesLater), true},
 }
 
 func TestIsReadyForDeletion(t *testing.T) {
@@ -120,3 +126,53 @@ func createTestWatchedResource(creationTime time.Time, ttl string) *WatchedResou
 	resource.FreezeClock(currentTime)
 	return resource
 }
+
+func TestBackupLabels(t *testing.T) {
+	resource := NewResource("Test_Resource.With/A-Long-Name-That-Does-Not-Fit-In-A-GCP-Label-Value", zone, earlyTime, resourceType)
+	labels, err := BackupLabels(resource, "Reaper-UUID", "0 0 * * *", currentTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		BackupSourceLabel: "test_resource-with-a-long-name-that-does-not-fit-in-a-gcp-label",
+		ReaperUUIDLabel:   "reaper-uuid",
+		ExpiresLabel:      fmt.Sprint(time.Date(2020, 6, 18, 0, 0, 0, 0, currentTime.Location()).Unix()),
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Backup labels = %v; want %v", labels, expected)
+	}
+	if _, err := BackupLabels(resource, "Reaper-UUID", "not a ttl", currentTime); err == nil {
+		t.Errorf("Backup labels with an invalid TTL did not fail")
+	}
+}
+
+func TestQuarantineAborted(t *testing.T) {
+	resource := NewResource("TestResource", zone, earlyTime, resourceType)
+	resource.Labels = QuarantineLabels("Reaper-UUID", currentTime)
+	if resource.QuarantineAborted("Reaper-UUID") {
+		t.Errorf("Quarantined resource reported as aborted")
+	}
+	delete(resource.Labels, QuarantineLabel)
+	if !resource.QuarantineAborted("Reaper-UUID") {
+		t.Errorf("Resource without its quarantine label not reported as aborted")
+	}
+	if resource.QuarantineAborted("Other-UUID") {
+		t.Errorf("Resource quarantined by another reaper reported as aborted")
+	}
+}
+
+func createExpiringWatchedResource(creationTime, expiresAt time.Time) *WatchedResource {
+	resource := createTestWatchedResource(creationTime, "* * * * *")
+	resource.Labels = map[string]string{
+		BackupSourceLabel: "testresource", ReaperUUIDLabel: "reaper-uuid", ExpiresLabel: fmt.Sprint(expiresAt.Unix()),
+	}
+	return resource
+}
+
+// createLabeledWatchedResource returns a resource with an ExpiresLabel that is not a backup,
+// so whose label does not override its TTL.
+func createLabeledWatchedResource(creationTime, expiresAt time.Time) *WatchedResource {
+	resource := createTestWatchedResource(creationTime, "* * * * *")
+	resource.Labels = map[string]string{ExpiresLabel: fmt.Sprint(expiresAt.Unix())}
+	return resource
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"go.opencensus.io/trace"
+)
+
+// Names of the exporters that can be configured.
+const (
+	// LogExporter writes each finished span to the reaper's logs.
+	LogExporter = "log"
+)
+
+// exporters maps the name of each exporter that can be configured to a function that
+// creates it.
+var exporters = map[string]func() trace.Exporter{
+	LogExporter: func() trace.Exporter { return logExporter{} },
+}
+
+// Keys of the attributes recorded on spans.
+const (
+	ReaperAttribute       = "reaper.uuid"
+	ProjectAttribute      = "gcp.project_id"
+	ZoneAttribute         = "gcp.zone"
+	ResourceTypeAttribute = "reaper.resource_type"
+	ResourceAttribute     = "reaper.resource"
+)
+
+// Configure registers the named exporters and sets the fraction of traces that are
+// sampled, which is between 0 and 1.
+func Configure(exporterNames []string, sampleFraction float64) error {
+	if sampleFraction < 0 || sampleFraction > 1 {
+		return fmt.Errorf("trace sample fraction %v is not between 0 and 1", sampleFraction)
+	}
+	var toRegister []trace.Exporter
+	for _, name := range exporterNames {
+		newExporter, isExporter := exporters[name]
+		if !isExporter {
+			return fmt.Errorf("unknown trace exporter %q", name)
+		}
+		toRegister = append(toRegister, newExporter())
+	}
+	for _, exporter := range toRegister {
+		trace.RegisterExporter(exporter)
+	}
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(sampleFraction)})
+	return nil
+}
+
+// StartSpan starts a span with the given name and attributes, which is a child of the
+// span in the context if there is one.
+func StartSpan(ctx context.Context, name string, attributes ...trace.Attribute) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, name)
+	span.AddAttributes(attributes...)
+	return ctx, span
+}
+
+// EndSpan ends the span, recording the error as its status if it is not nil.
+func EndSpan(span *trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// RecordError records the error as the status of the span if it is not nil.
+func RecordError(span *trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+}
+
+// StartZoneSpan starts a span for listing the resources of a type in one zone of a project.
+func StartZoneSpan(ctx context.Context, resourceType reaperconfig.ResourceType, projectID, zone string) (context.Context, *trace.Span) {
+	return StartSpan(
+		ctx, "Client.GetResources",
+		trace.StringAttribute(ResourceTypeAttribute, resourceType.String()),
+		trace.StringAttribute(ProjectAttribute, projectID),
+		trace.StringAttribute(ZoneAttribute, zone),
+	)
+}
+
+// MemoryExporter keeps the spans exported to it in memory, so that tests can check them.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+// NewMemoryExporter creates an empty MemoryExporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// ExportSpan implements trace.Exporter.
+func (exporter *MemoryExporter) ExportSpan(span *trace.SpanData) {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.spans = append(exporter.spans, span)
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (exporter *MemoryExporter) Spans() []*trace.SpanData {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	return append([]*trace.SpanData(nil), exporter.spans...)
+}
+
+// logExporter writes each finished span to the reaper's logs.
+type logExporter struct{}
+
+// ExportSpan implements trace.Exporter.
+func (logExporter) ExportSpan(span *trace.SpanData) {
+	var attributes []string
+	for key, value := range span.Attributes {
+		attributes = append(attributes, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(attributes)
+	logger.Logf(
+		"Span %s (trace %s, span %s, parent %s) took %s with status %d %q and attributes [%s]\n",
+		span.Name, span.TraceID, span.SpanID, span.ParentSpanID, span.EndTime.Sub(span.StartTime),
+		span.Status.Code, span.Status.Message, strings.Join(attributes, ", "),
+	)
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"go.opencensus.io/trace"
+)
+
+type ConfigureTestCase struct {
+	Exporters      []string
+	SampleFraction float64
+	ShouldFail     bool
+}
+
+var configureTestCases = []ConfigureTestCase{
+	ConfigureTestCase{nil, 0.5, false},
+	ConfigureTestCase{[]string{"stdout"}, 1, true},
+	ConfigureTestCase{nil, 1.5, true},
+	ConfigureTestCase{nil, -1, true},
+}
+
+func TestConfigure(t *testing.T) {
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	for _, testCase := range configureTestCases {
+		err := Configure(testCase.Exporters, testCase.SampleFraction)
+		if (err != nil) != testCase.ShouldFail {
+			t.Errorf("Configure(%v, %v) returned error %v; want failure %v", testCase.Exporters, testCase.SampleFraction, err, testCase.ShouldFail)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	exporter := NewMemoryExporter()
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	ctx, parent := StartSpan(context.Background(), "Parent", trace.StringAttribute(ReaperAttribute, "UUID"))
+	_, zoneSpan := StartZoneSpan(ctx, reaperconfig.ResourceType_GCE_VM, "sampleProject", "us-east1-b")
+	EndSpan(zoneSpan, fmt.Errorf("listing failed"))
+	EndSpan(parent, nil)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Exported %d spans; want 2", len(spans))
+	}
+	zone, parentData := spans[0], spans[1]
+	if zone.ParentSpanID != parentData.SpanID || zone.TraceID != parentData.TraceID {
+		t.Errorf("Zone span is not a child of the parent span")
+	}
+	if zone.Attributes[ZoneAttribute] != "us-east1-b" || zone.Attributes[ResourceTypeAttribute] != "GCE_VM" {
+		t.Errorf("Zone span has attributes %v", zone.Attributes)
+	}
+	if zone.Status.Message != "listing failed" || zone.Status.Code == trace.StatusCodeOK {
+		t.Errorf("Zone span has status %v; want the listing error", zone.Status)
+	}
+	if parentData.Status.Code != trace.StatusCodeOK {
+		t.Errorf("Parent span has status %v; want OK", parentData.Status)
+	}
+}